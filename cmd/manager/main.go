@@ -2,10 +2,9 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"flag"
 	"fmt"
-	"net/http"
+	"io/ioutil"
 	"os"
 	"runtime"
 
@@ -14,6 +13,7 @@ import (
 	"k8s.io/client-go/rest"
 
 	"github.com/periklis/nop-operator/pkg/apis"
+	"github.com/periklis/nop-operator/pkg/channels"
 	"github.com/periklis/nop-operator/pkg/controller"
 
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
@@ -25,7 +25,9 @@ import (
 	sdkVersion "github.com/operator-framework/operator-sdk/version"
 	"github.com/spf13/pflag"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -40,6 +42,9 @@ var (
 )
 var log = logf.Log.WithName("cmd")
 
+// caBundleKey is the key of the CA bundle in the ConfigMap named by --ca-bundle-configmap.
+const caBundleKey = "ca-bundle.crt"
+
 func printVersion() {
 	log.Info(fmt.Sprintf("Go Version: %s", runtime.Version()))
 	log.Info(fmt.Sprintf("Go OS/Arch: %s/%s", runtime.GOOS, runtime.GOARCH))
@@ -55,6 +60,19 @@ func main() {
 	// controller-runtime)
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
 
+	caBundleFile := pflag.String("ca-bundle", "", "Path to a PEM encoded CA bundle trusted in addition to the system roots when fetching channels")
+	enableFileChannels := pflag.Bool("enable-file-channels", false, "Allow channels to read file:// and git+file:// URLs and local git repositories from the operator's filesystem, for local development only")
+	bundleCacheDir := pflag.String("bundle-cache-dir", channels.DefaultCacheDir, "Directory caching the archives fetched over HTTP")
+	gitCacheDir := pflag.String("git-cache-dir", channels.GitCacheDir, "Directory holding the mirrors of git repositories channels are read from")
+	maxArchiveSize := pflag.Int64("max-archive-size", channels.ArchiveLimits.MaxArchiveSize, "Size in bytes of the largest compressed archive read from a channel")
+	maxUnpackedSize := pflag.Int64("max-unpacked-size", channels.ArchiveLimits.MaxUnpackedSize, "Size in bytes of the largest archive read from a channel once decompressed")
+	maxArchiveEntries := pflag.Int("max-archive-entries", channels.ArchiveLimits.MaxEntries, "Number of entries of the largest archive read from a channel")
+	maxManifestSize := pflag.Int64("max-manifest-size", channels.ArchiveLimits.MaxFileSize, "Size in bytes of the largest file of an archive read from a channel")
+	bundleCacheSize := pflag.Int64("bundle-cache-size", channels.DefaultCacheSize, "Size in bytes of the archives kept in the bundle cache, 0 disables caching")
+	fetchTimeout := pflag.Duration("fetch-timeout", channels.FetchTimeout, "Timeout of each request fetching a channel and of each git command run for a channel")
+	bundleCacheMemory := pflag.Int64("bundle-cache-memory", channels.DefaultCacheMemory, "Size in bytes of the manifests of the bundles the bundle cache keeps decoded in memory")
+	caBundleConfigMap := pflag.String("ca-bundle-configmap", "", "Name of a ConfigMap in the operator's namespace holding a PEM encoded CA bundle under key "+caBundleKey+", trusted in addition to the system roots when fetching channels")
+
 	pflag.Parse()
 
 	// Use a zap logr.Logger implementation. If none of the zap
@@ -101,9 +119,41 @@ func main() {
 		os.Exit(1)
 	}
 
-	tlsConf := &tls.Config{InsecureSkipVerify: true}
-	tr := &http.Transport{TLSClientConfig: tlsConf}
-	client := &http.Client{Transport: tr}
+	channels.FetchTimeout = *fetchTimeout
+	caBundles, err := loadCABundles(ctx, mgr.GetAPIReader(), *caBundleFile, *caBundleConfigMap)
+	if err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+	channels.CABundles = caBundles
+	httpClient, err := channels.NewHTTPClient(caBundles...)
+	if err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+	if *enableFileChannels {
+		channels.RegisterReader("file", channels.NewFileReader)
+		channels.RegisterReader("git+file", channels.NewLocalGitReader)
+	}
+	channels.ArchiveLimits = channels.Limits{
+		MaxArchiveSize:  *maxArchiveSize,
+		MaxUnpackedSize: *maxUnpackedSize,
+		MaxEntries:      *maxArchiveEntries,
+		MaxFileSize:     *maxManifestSize,
+	}
+	channels.GitCacheDir = *gitCacheDir
+	if err := channels.CleanGitCache(); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+	channels.BundleCache = nil
+	if *bundleCacheSize > 0 {
+		channels.BundleCache = channels.NewCache(*bundleCacheDir, *bundleCacheSize, *bundleCacheMemory)
+		if err := channels.BundleCache.Clean(); err != nil {
+			log.Error(err, "")
+			os.Exit(1)
+		}
+	}
 
 	log.Info("Registering Components.")
 
@@ -114,7 +164,7 @@ func main() {
 	}
 
 	// Setup all Controllers
-	if err := controller.AddToManager(mgr, client); err != nil {
+	if err := controller.AddToManager(mgr, httpClient); err != nil {
 		log.Error(err, "")
 		os.Exit(1)
 	}
@@ -179,3 +229,33 @@ func serveCRMetrics(cfg *rest.Config) error {
 	}
 	return nil
 }
+
+// loadCABundles reads the CA bundles given by the --ca-bundle and --ca-bundle-configmap flags.
+// The cache of the manager is not started yet, thus the ConfigMap is read from the apiserver.
+func loadCABundles(ctx context.Context, c client.Reader, file, configMap string) ([][]byte, error) {
+	var bundles [][]byte
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading CA bundle: %s", err)
+		}
+		bundles = append(bundles, data)
+	}
+
+	if configMap != "" {
+		ns, err := k8sutil.GetOperatorNamespace()
+		if err != nil {
+			return nil, err
+		}
+		cm := &v1.ConfigMap{}
+		if err := c.Get(ctx, types.NamespacedName{Name: configMap, Namespace: ns}, cm); err != nil {
+			return nil, fmt.Errorf("Error reading CA bundle from configmap %s: %s", configMap, err)
+		}
+		data, ok := cm.Data[caBundleKey]
+		if !ok {
+			return nil, fmt.Errorf("Error reading CA bundle: configmap %s has no key %s", configMap, caBundleKey)
+		}
+		bundles = append(bundles, []byte(data))
+	}
+	return bundles, nil
+}
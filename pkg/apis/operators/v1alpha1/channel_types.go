@@ -0,0 +1,128 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ChannelSpec defines the desired state of Channel
+// +k8s:openapi-gen=true
+type ChannelSpec struct {
+	// URL of the archive to install or of an OCI artifact as oci://<registry>/<repository>[:<tag>|@<digest>].
+	// The scheme selects the reader, e.g. git+https://, configmap:// or secret://. Ignored if Index or Source is set
+	URL string `json:"url,omitempty"`
+	// Source reads the channel from other sources than archives
+	Source *SourceSpec `json:"source,omitempty"`
+	// Version to install, the latest version of the channel in Index if empty
+	Version string `json:"version,omitempty"`
+	// Index is the URL of an index document listing the released versions per channel
+	Index string `json:"index,omitempty"`
+	// Channel of Index to follow, defaults to "stable"
+	Channel string `json:"channel,omitempty"`
+	// PollInterval is the interval Index is polled for new versions, defaults to 10m
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+	// Constraint is a semver range the installed version must satisfy, e.g. "~1.2" or ">=1.2.0 <2.0.0"
+	Constraint string `json:"constraint,omitempty"`
+	// ApprovedVersion approves a major upgrade or a downgrade to this version
+	ApprovedVersion string `json:"approvedVersion,omitempty"`
+	// SHA256 is the hex encoded digest the archive must match, taken from Index if empty
+	SHA256 string `json:"sha256,omitempty"`
+	// Signature requires a detached signature of the archive made with the referenced public key
+	Signature *SignatureSpec `json:"signature,omitempty"`
+	// TLS configures how the servers of URL, Index and Signature are trusted
+	TLS *TLSSpec `json:"tls,omitempty"`
+	// AuthSecretRef names a Secret holding basic auth credentials, a bearer token or
+	// custom headers sent with every download of the channel
+	AuthSecretRef *corev1.LocalObjectReference `json:"authSecretRef,omitempty"`
+	Replicas      int                          `json:"replicas,omitempty"`
+}
+
+// TLSSpec configures the TLS client of a channel
+type TLSSpec struct {
+	// CA selects a PEM encoded CA bundle trusted instead of the operator's ones
+	CA *KeySource `json:"ca,omitempty"`
+	// ClientCertSecretRef names a kubernetes.io/tls Secret holding the client certificate presented to the servers
+	ClientCertSecretRef *corev1.LocalObjectReference `json:"clientCertSecretRef,omitempty"`
+	// InsecureSkipTLSVerify disables the verification of server certificates, reported in the channel's status
+	InsecureSkipTLSVerify bool `json:"insecureSkipTLSVerify,omitempty"`
+}
+
+// SourceSpec selects a source of channel manifests. Exactly one source must be set.
+type SourceSpec struct {
+	// Git reads the manifests from a directory of a git repository
+	Git *GitSource `json:"git,omitempty"`
+	// ConfigMap reads the manifests from a ConfigMap in the namespace of the object owning the channel
+	ConfigMap *ObjectSource `json:"configMap,omitempty"`
+	// Secret reads the manifests from a Secret in the namespace of the object owning the channel
+	Secret *ObjectSource `json:"secret,omitempty"`
+}
+
+// ObjectSource references a ConfigMap or Secret holding a manifest archive or plain manifests
+type ObjectSource struct {
+	Name string `json:"name"`
+	// Key holding a gzip compressed tar archive of manifests, all keys hold plain manifests if empty
+	Key string `json:"key,omitempty"`
+}
+
+// GitSource references a directory of a git repository
+type GitSource struct {
+	// Repo is the URL of the repository
+	Repo string `json:"repo"`
+	// Ref is a branch, tag or commit, defaults to the repository's HEAD
+	Ref string `json:"ref,omitempty"`
+	// Subdir is the directory holding the manifests, defaults to the repository's root
+	Subdir string `json:"subdir,omitempty"`
+}
+
+// SignatureSpec references the public key verifying the detached signature of a channel archive
+type SignatureSpec struct {
+	// URL of the detached signature, defaults to the archive URL with ".sig" appended
+	URL string `json:"url,omitempty"`
+	// PublicKey selects a PEM encoded ed25519 or ECDSA public key
+	PublicKey KeySource `json:"publicKey"`
+}
+
+// KeySource selects a key of a Secret or ConfigMap in the namespace of the object owning the channel.
+// Exactly one of both must be set.
+type KeySource struct {
+	SecretKeyRef    *corev1.SecretKeySelector    `json:"secretKeyRef,omitempty"`
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+}
+
+// ChannelStatus defines the observed state of Channel
+// +k8s:openapi-gen=true
+type ChannelStatus struct {
+	ObservedGeneration    int64 `json:"observedGeneration,omitempty"`
+	OperatorChannelStatus `json:",inline"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Channel is the Schema for the channels API
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=channels,scope=Namespaced
+// +kubebuilder:printcolumn:name="Desired",type="string",JSONPath=".status.desiredVersion",description="Version of the channel to install"
+// +kubebuilder:printcolumn:name="Installed",type="string",JSONPath=".status.installedVersion",description="Version of the channel installed"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type Channel struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ChannelSpec   `json:"spec,omitempty"`
+	Status ChannelStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ChannelList contains a list of Channel
+type ChannelList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Channel `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Channel{}, &ChannelList{})
+}
@@ -0,0 +1,50 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SetCondition adds or replaces the condition of the same type in conditions.
+// The transition time is only advanced if the condition status changes.
+func SetCondition(conditions []Condition, c Condition) []Condition {
+	for i := range conditions {
+		if conditions[i].Type != c.Type {
+			continue
+		}
+		if conditions[i].Status == c.Status {
+			c.LastTransitionTime = conditions[i].LastTransitionTime
+		}
+		if c.LastTransitionTime.IsZero() {
+			c.LastTransitionTime = metav1.Now()
+		}
+		conditions[i] = c
+		return conditions
+	}
+
+	if c.LastTransitionTime.IsZero() {
+		c.LastTransitionTime = metav1.Now()
+	}
+	return append(conditions, c)
+}
+
+// FindCondition returns the condition of the given type or nil.
+func FindCondition(conditions []Condition, t ConditionType) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == t {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// IsConditionTrue reports whether the condition of the given type is present and true.
+func IsConditionTrue(conditions []Condition, t ConditionType) bool {
+	c := FindCondition(conditions, t)
+	return c != nil && c.Status == corev1.ConditionTrue
+}
+
+// IsReady reports whether the channel is installed in its desired version without errors.
+func (s *OperatorChannelStatus) IsReady() bool {
+	return s.LastError == "" && s.InstalledVersion != "" && s.InstalledVersion == s.DesiredVersion
+}
@@ -1,25 +1,104 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// OperatorChannel is a channel embedded in a NopOperator
 type OperatorChannel struct {
-	Name     string `json:"name"`
-	URL      string `json:"url"`
-	Version  string `json:"version"`
-	Replicas int    `json:"replicas,omitempty"`
+	Name        string `json:"name"`
+	ChannelSpec `json:",inline"`
+	// Dependencies are channels of the same NopOperator installed and ready before this one
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+}
+
+// Dependency of a channel on another channel of the same NopOperator
+type Dependency struct {
+	// Name of the channel depended on
+	Name string `json:"name"`
+	// Constraint is a semver range the installed version of the channel must satisfy, e.g. ">=1.2", any version if empty
+	Constraint string `json:"constraint,omitempty"`
 }
 
 // NopOperatorSpec defines the desired state of NopOperator
 // +k8s:openapi-gen=true
 type NopOperatorSpec struct {
-	Operators []OperatorChannel `json:"operators"`
+	// Operators are channels reconciled as part of the NopOperator itself
+	Operators []OperatorChannel `json:"operators,omitempty"`
+	// Selector selects the Channels in the NopOperator's namespace reported in its status
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// ConditionType is the type of a NopOperator or Channel condition
+type ConditionType string
+
+const (
+	// ConditionReady is true when all channels are installed in their desired version
+	ConditionReady ConditionType = "Ready"
+	// ConditionProgressing is true while at least one channel is not yet installed in its desired version
+	ConditionProgressing ConditionType = "Progressing"
+	// ConditionDegraded is true when at least one channel failed to reconcile
+	ConditionDegraded ConditionType = "Degraded"
+	// ConditionBlocked is true when at least one channel's version change awaits approval or its dependencies cannot be satisfied
+	ConditionBlocked ConditionType = "Blocked"
+	// ConditionVerified is true when the archive of a channel matched its pinned digest
+	ConditionVerified ConditionType = "Verified"
+	// ConditionUpgradeAvailable is true when a channel following its index holds back a newer version awaiting approval
+	ConditionUpgradeAvailable ConditionType = "UpgradeAvailable"
+)
+
+// Condition describes the state of a NopOperator or Channel at a certain point
+type Condition struct {
+	Type               ConditionType          `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	ObservedGeneration int64                  `json:"observedGeneration,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+}
+
+// BundleMetadata describes a bundle in the bundle.yaml file of its root
+type BundleMetadata struct {
+	// Name of the operator shipped by the bundle, must match the channel's name
+	Name string `json:"name"`
+	// Version of the bundle, must match the channel's version if both are set
+	Version     string `json:"version,omitempty"`
+	Description string `json:"description,omitempty"`
+	// MinKubeVersion is the oldest Kubernetes version the bundle can be installed on, e.g. "1.14"
+	MinKubeVersion string `json:"minKubeVersion,omitempty"`
+	// MaxKubeVersion is the newest Kubernetes version the bundle can be installed on, e.g. "1.16"
+	MaxKubeVersion string `json:"maxKubeVersion,omitempty"`
+	// RequiredAPIGroups must be served by the cluster, e.g. "cert-manager.io" or "cert-manager.io/v1alpha2"
+	RequiredAPIGroups []string `json:"requiredAPIGroups,omitempty"`
+	// Dependencies are channels installed and ready before the bundle, in addition to the channel's ones
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+}
+
+// OperatorChannelStatus defines the observed state of a single OperatorChannel
+type OperatorChannelStatus struct {
+	Name                  string          `json:"name"`
+	DesiredVersion        string          `json:"desiredVersion,omitempty"`
+	InstalledVersion      string          `json:"installedVersion,omitempty"`
+	Digest                string          `json:"digest,omitempty"`
+	Commit                string          `json:"commit,omitempty"`
+	InsecureSkipTLSVerify bool            `json:"insecureSkipTLSVerify,omitempty"`
+	LastFetchTime         *metav1.Time    `json:"lastFetchTime,omitempty"`
+	ObjectCount           int             `json:"objectCount"`
+	SkippedFiles          []string        `json:"skippedFiles,omitempty"`
+	Bundle                *BundleMetadata `json:"bundle,omitempty"`
+	LastError             string          `json:"lastError,omitempty"`
+	Conditions            []Condition     `json:"conditions,omitempty"`
 }
 
 // NopOperatorStatus defines the observed state of NopOperator
 // +k8s:openapi-gen=true
 type NopOperatorStatus struct {
+	ObservedGeneration int64                   `json:"observedGeneration,omitempty"`
+	ReadyChannels      int                     `json:"readyChannels"`
+	TotalChannels      int                     `json:"totalChannels"`
+	Channels           []OperatorChannelStatus `json:"channels,omitempty"`
+	Conditions         []Condition             `json:"conditions,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -28,6 +107,9 @@ type NopOperatorStatus struct {
 // +k8s:openapi-gen=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:path=nopoperators,scope=Namespaced
+// +kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.readyChannels",description="Number of channels installed in their desired version"
+// +kubebuilder:printcolumn:name="Total",type="integer",JSONPath=".status.totalChannels",description="Number of channels"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type NopOperator struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
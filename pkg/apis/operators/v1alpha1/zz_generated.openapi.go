@@ -11,12 +11,234 @@ import (
 
 func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition {
 	return map[string]common.OpenAPIDefinition{
+		"./pkg/apis/operators/v1alpha1.Channel":           schema_pkg_apis_operators_v1alpha1_Channel(ref),
+		"./pkg/apis/operators/v1alpha1.ChannelSpec":       schema_pkg_apis_operators_v1alpha1_ChannelSpec(ref),
+		"./pkg/apis/operators/v1alpha1.ChannelStatus":     schema_pkg_apis_operators_v1alpha1_ChannelStatus(ref),
 		"./pkg/apis/operators/v1alpha1.NopOperator":       schema_pkg_apis_operators_v1alpha1_NopOperator(ref),
 		"./pkg/apis/operators/v1alpha1.NopOperatorSpec":   schema_pkg_apis_operators_v1alpha1_NopOperatorSpec(ref),
 		"./pkg/apis/operators/v1alpha1.NopOperatorStatus": schema_pkg_apis_operators_v1alpha1_NopOperatorStatus(ref),
 	}
 }
 
+func schema_pkg_apis_operators_v1alpha1_Channel(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "Channel is the Schema for the channels API",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("./pkg/apis/operators/v1alpha1.ChannelSpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("./pkg/apis/operators/v1alpha1.ChannelStatus"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"./pkg/apis/operators/v1alpha1.ChannelSpec", "./pkg/apis/operators/v1alpha1.ChannelStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_operators_v1alpha1_ChannelSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ChannelSpec defines the desired state of Channel",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"url": {
+						SchemaProps: spec.SchemaProps{
+							Description: "URL of the archive to install or of an OCI artifact as oci://<registry>/<repository>[:<tag>|@<digest>]. The scheme selects the reader, e.g. git+https://, configmap:// or secret://. Ignored if Index or Source is set",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"source": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Source reads the channel from other sources than archives",
+							Ref:         ref("./pkg/apis/operators/v1alpha1.SourceSpec"),
+						},
+					},
+					"version": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Version to install, the latest version of the channel in Index if empty",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"index": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Index is the URL of an index document listing the released versions per channel",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"channel": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Channel of Index to follow, defaults to \"stable\"",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"pollInterval": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PollInterval is the interval Index is polled for new versions, defaults to 10m",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"constraint": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Constraint is a semver range the installed version must satisfy, e.g. \"~1.2\" or \">=1.2.0 <2.0.0\"",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"approvedVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ApprovedVersion approves a major upgrade or a downgrade to this version",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"sha256": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SHA256 is the hex encoded digest the archive must match, taken from Index if empty",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"signature": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Signature requires a detached signature of the archive made with the referenced public key",
+							Ref:         ref("./pkg/apis/operators/v1alpha1.SignatureSpec"),
+						},
+					},
+					"tls": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TLS configures how the servers of URL, Index and Signature are trusted",
+							Ref:         ref("./pkg/apis/operators/v1alpha1.TLSSpec"),
+						},
+					},
+					"authSecretRef": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AuthSecretRef names a Secret holding basic auth credentials, a bearer token or custom headers sent with every download of the channel",
+							Ref:         ref("k8s.io/api/core/v1.LocalObjectReference"),
+						},
+					},
+					"replicas": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int32",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"./pkg/apis/operators/v1alpha1.SignatureSpec", "./pkg/apis/operators/v1alpha1.SourceSpec", "./pkg/apis/operators/v1alpha1.TLSSpec", "k8s.io/api/core/v1.LocalObjectReference", "k8s.io/apimachinery/pkg/apis/meta/v1.Duration"},
+	}
+}
+
+func schema_pkg_apis_operators_v1alpha1_ChannelStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ChannelStatus defines the observed state of Channel",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"observedGeneration": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int64",
+						},
+					},
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"desiredVersion": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"installedVersion": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"digest": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"lastFetchTime": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"objectCount": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int32",
+						},
+					},
+					"lastError": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"conditions": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("./pkg/apis/operators/v1alpha1.Condition"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"name", "objectCount"},
+			},
+		},
+		Dependencies: []string{
+			"./pkg/apis/operators/v1alpha1.Condition", "k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
 func schema_pkg_apis_operators_v1alpha1_NopOperator(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -70,7 +292,7 @@ func schema_pkg_apis_operators_v1alpha1_NopOperatorSpec(ref common.ReferenceCall
 				Properties: map[string]spec.Schema{
 					"operators": {
 						SchemaProps: spec.SchemaProps{
-							Description: "INSERT ADDITIONAL SPEC FIELDS - desired state of cluster Important: Run \"operator-sdk generate k8s\" to regenerate code after modifying this file Add custom validation using kubebuilder tags: https://book-v1.book.kubebuilder.io/beyond_basics/generating_crd.html",
+							Description: "Operators are channels reconciled as part of the NopOperator itself",
 							Type:        []string{"array"},
 							Items: &spec.SchemaOrArray{
 								Schema: &spec.Schema{
@@ -81,12 +303,17 @@ func schema_pkg_apis_operators_v1alpha1_NopOperatorSpec(ref common.ReferenceCall
 							},
 						},
 					},
+					"selector": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Selector selects the Channels in the NopOperator's namespace reported in its status",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.LabelSelector"),
+						},
+					},
 				},
-				Required: []string{"operators"},
 			},
 		},
 		Dependencies: []string{
-			"./pkg/apis/operators/v1alpha1.OperatorChannel"},
+			"./pkg/apis/operators/v1alpha1.OperatorChannel", "k8s.io/apimachinery/pkg/apis/meta/v1.LabelSelector"},
 	}
 }
 
@@ -96,7 +323,54 @@ func schema_pkg_apis_operators_v1alpha1_NopOperatorStatus(ref common.ReferenceCa
 			SchemaProps: spec.SchemaProps{
 				Description: "NopOperatorStatus defines the observed state of NopOperator",
 				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"observedGeneration": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int64",
+						},
+					},
+					"readyChannels": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int32",
+						},
+					},
+					"totalChannels": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int32",
+						},
+					},
+					"channels": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("./pkg/apis/operators/v1alpha1.OperatorChannelStatus"),
+									},
+								},
+							},
+						},
+					},
+					"conditions": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("./pkg/apis/operators/v1alpha1.Condition"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"readyChannels", "totalChannels"},
 			},
 		},
+		Dependencies: []string{
+			"./pkg/apis/operators/v1alpha1.Condition", "./pkg/apis/operators/v1alpha1.OperatorChannelStatus"},
 	}
 }
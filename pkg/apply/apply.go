@@ -0,0 +1,372 @@
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// LastAppliedAnnotation holds the manifest last applied by nop-operator. It is used
+// to compute client-side three-way merges when server-side apply is not available.
+const LastAppliedAnnotation = "operators.nefeli.eu/last-applied-configuration"
+
+// FieldManager returns the server-side apply field manager used for objects of a channel.
+func FieldManager(channel string) string {
+	return fmt.Sprintf("nop-operator/%s", channel)
+}
+
+// Applier creates and updates objects of any Group-Version-Kind through the dynamic client.
+// The REST resource for each object is resolved via the RESTMapper, so kinds
+// unknown at compile time are handled the same way as the built-in ones.
+type Applier struct {
+	client dynamic.Interface
+	mapper meta.RESTMapper
+	scheme *runtime.Scheme
+	log    logr.Logger
+
+	// noServerSide is set once the apiserver rejected a server-side apply request.
+	noServerSide int32
+}
+
+// NewApplier returns an Applier using the given dynamic client and RESTMapper.
+// The scheme is used to resolve the GVK of typed objects and owner references.
+func NewApplier(client dynamic.Interface, mapper meta.RESTMapper, scheme *runtime.Scheme, log logr.Logger) *Applier {
+	return &Applier{client: client, mapper: mapper, scheme: scheme, log: log}
+}
+
+// Apply makes sure obj exists in the cluster and matches the manifest. Namespaced objects
+// without a namespace are placed in the owner's namespace and get owner as their controller
+// reference. Objects are created and updated using server-side apply under the given field
+// manager, falling back to a create and client-side three-way merges if the apiserver lacks
+// support.
+// The returned reference identifies the object in the cluster.
+func (a *Applier) Apply(owner metav1.Object, manager string, obj runtime.Object) (Ref, error) {
+	u, err := a.toUnstructured(obj)
+	if err != nil {
+		return Ref{}, err
+	}
+
+	mapping, namespace, err := a.namespace(owner, u)
+	if err != nil {
+		return Ref{}, err
+	}
+
+	u.SetNamespace(namespace)
+	var ri dynamic.ResourceInterface = a.client.Resource(mapping.Resource)
+	if namespace != "" {
+		ri = a.client.Resource(mapping.Resource).Namespace(namespace)
+	}
+
+	ref := newRef(u)
+
+	// Owner references must not cross namespaces or point from cluster-scoped
+	// objects to namespaced ones, the garbage collector would treat them as orphans.
+	if u.GetNamespace() != "" && u.GetNamespace() == owner.GetNamespace() {
+		if err := controllerutil.SetControllerReference(owner, u, a.scheme); err != nil {
+			return ref, fmt.Errorf("Error setting controller reference: %s", err)
+		}
+	}
+
+	live, err := ri.Get(u.GetName(), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return ref, a.create(ri, manager, u)
+	} else if err != nil {
+		return ref, err
+	}
+
+	// nop-operator owns exactly the fields set in the channel manifest, minus the
+	// ignored ones. Everything else on the live object belongs to other actors.
+	ignored := ignoredFields(u, live)
+	removeFields(u, ignored)
+	if err := setLastApplied(u, nil); err != nil {
+		return ref, err
+	}
+	if isSubset(u.Object, live.Object) {
+		return ref, nil
+	}
+
+	if atomic.LoadInt32(&a.noServerSide) == 0 {
+		err := a.serverSideApply(ri, manager, u)
+		if !isUnsupported(err) {
+			return ref, err
+		}
+		a.log.Info("Server-side apply not supported, falling back to three-way merge patches")
+		atomic.StoreInt32(&a.noServerSide, 1)
+	}
+
+	return ref, a.threeWayMerge(ri, u, live, ignored)
+}
+
+// Namespace returns the namespace obj is applied to on behalf of owner, empty for cluster-scoped objects.
+func (a *Applier) Namespace(owner metav1.Object, obj runtime.Object) (string, error) {
+	u, err := a.toUnstructured(obj)
+	if err != nil {
+		return "", err
+	}
+	_, namespace, err := a.namespace(owner, u)
+	return namespace, err
+}
+
+// namespace resolves the REST mapping of u and the namespace it is applied to. Namespaced
+// objects without a namespace are placed in the owner's namespace.
+func (a *Applier) namespace(owner metav1.Object, u *unstructured.Unstructured) (*meta.RESTMapping, string, error) {
+	gvk := u.GroupVersionKind()
+	mapping, err := a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error mapping %s to a resource: %s", gvk, err)
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return mapping, "", nil
+	}
+	if u.GetNamespace() == "" {
+		return mapping, owner.GetNamespace(), nil
+	}
+	return mapping, u.GetNamespace(), nil
+}
+
+// create creates u through an apply patch, thus the fields of the manifest are owned by the
+// apply operation of manager and removed from the object once dropped from the manifest.
+// Ignored fields are still set to give them an initial value, by a merge patch owned by an
+// update operation of manager, thus later applies without them do not reset these fields.
+func (a *Applier) create(ri dynamic.ResourceInterface, manager string, u *unstructured.Unstructured) error {
+	ignored := ignoredFields(u)
+	if err := setLastApplied(u, ignored); err != nil {
+		return err
+	}
+
+	a.log.Info("Creating a new object", "Kind", u.GetKind(), "Namespace", u.GetNamespace(), "Name", u.GetName())
+	if atomic.LoadInt32(&a.noServerSide) == 0 {
+		applied := u.DeepCopy()
+		removeFields(applied, ignored)
+		err := a.serverSideApply(ri, manager, applied)
+		if err == nil {
+			return a.setIgnored(ri, manager, u, ignored)
+		}
+		if !isUnsupported(err) {
+			return err
+		}
+		a.log.Info("Server-side apply not supported, falling back to three-way merge patches")
+		atomic.StoreInt32(&a.noServerSide, 1)
+	}
+
+	if _, err := ri.Create(u, metav1.CreateOptions{FieldManager: manager}); err != nil {
+		return fmt.Errorf("Error creating new %s: %s", u.GetKind(), err)
+	}
+	return nil
+}
+
+// setIgnored sets the ignored fields of the manifest u on the object just created.
+func (a *Applier) setIgnored(ri dynamic.ResourceInterface, manager string, u *unstructured.Unstructured, ignored [][]string) error {
+	patch := map[string]interface{}{}
+	for _, path := range ignored {
+		if v, found, _ := unstructured.NestedFieldCopy(u.Object, path...); found {
+			unstructured.SetNestedField(patch, v, path...)
+		}
+	}
+	if len(patch) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("Error encoding ignored fields of %s: %s", u.GetKind(), err)
+	}
+	if _, err := ri.Patch(u.GetName(), types.MergePatchType, data, metav1.PatchOptions{FieldManager: manager}); err != nil {
+		return fmt.Errorf("Error setting ignored fields of %s: %s", u.GetKind(), err)
+	}
+	return nil
+}
+
+// serverSideApply sends the manifest as an apply patch. Conflicts with field managers outside of
+// nop-operator are forced, nop-operator takes back fields changed by others to correct drift.
+// Conflicts with other channels are returned instead, forcing them would make the channels take
+// the fields from each other on every reconcile. Fields that are meant to be managed elsewhere
+// have to be ignored, see ignoredFields.
+func (a *Applier) serverSideApply(ri dynamic.ResourceInterface, manager string, u *unstructured.Unstructured) error {
+	data, err := u.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("Error encoding %s: %s", u.GetKind(), err)
+	}
+
+	a.log.Info("Applying object", "Kind", u.GetKind(), "Namespace", u.GetNamespace(), "Name", u.GetName(), "FieldManager", manager)
+	_, err = ri.Patch(u.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: manager})
+	if errors.IsConflict(err) {
+		managers, ok := conflictingManagers(err)
+		if !ok || !forceable(manager, managers) {
+			return fmt.Errorf("Error applying %s %s: conflicting field managers: %s", u.GetKind(), u.GetName(), err)
+		}
+
+		force := true
+		a.log.Info("Taking over fields from other field managers", "Kind", u.GetKind(), "Namespace", u.GetNamespace(), "Name", u.GetName(), "FieldManagers", managers)
+		_, err = ri.Patch(u.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: manager, Force: &force})
+	}
+	if err != nil && !isUnsupported(err) {
+		return fmt.Errorf("Error applying %s: %s", u.GetKind(), err)
+	}
+	return err
+}
+
+// conflictPattern matches the field manager named by the cause of an apply conflict, e.g.
+// `conflict with "kubectl" using apps/v1`.
+var conflictPattern = regexp.MustCompile(`^conflict with ("(?:[^"\\]|\\.)*")`)
+
+// conflictingManagers returns the field managers named by the causes of the apply conflict err.
+// It reports false if the managers of some conflicting fields are unknown.
+func conflictingManagers(err error) ([]string, bool) {
+	se, ok := err.(errors.APIStatus)
+	if !ok || se.Status().Details == nil {
+		return nil, false
+	}
+
+	var managers []string
+	for _, cause := range se.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		m := conflictPattern.FindStringSubmatch(cause.Message)
+		if m == nil {
+			return nil, false
+		}
+		name, err := strconv.Unquote(m[1])
+		if err != nil {
+			return nil, false
+		}
+		managers = append(managers, name)
+	}
+	return managers, len(managers) > 0
+}
+
+// forceable reports whether manager may take over the fields of managers, that is none of them
+// is the field manager of another channel.
+func forceable(manager string, managers []string) bool {
+	for _, m := range managers {
+		if m != manager && strings.HasPrefix(m, FieldManager("")) {
+			return false
+		}
+	}
+	return true
+}
+
+// threeWayMerge patches the live object with the changes between the last applied
+// manifest, the current manifest and the live state. Fields removed from the manifest
+// are removed from the live object, fields never applied by nop-operator are kept.
+func (a *Applier) threeWayMerge(ri dynamic.ResourceInterface, u, live *unstructured.Unstructured, ignored [][]string) error {
+	original := []byte(live.GetAnnotations()[LastAppliedAnnotation])
+	if len(original) > 0 {
+		last := &unstructured.Unstructured{}
+		if err := last.UnmarshalJSON(original); err != nil {
+			return fmt.Errorf("Error decoding %s annotation: %s", LastAppliedAnnotation, err)
+		}
+		removeFields(last, ignored)
+		o, err := last.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		original = o
+	}
+
+	modified, err := u.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("Error encoding %s: %s", u.GetKind(), err)
+	}
+	current, err := live.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("Error encoding live %s: %s", u.GetKind(), err)
+	}
+
+	patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current)
+	if err != nil {
+		return fmt.Errorf("Error creating patch for %s: %s", u.GetKind(), err)
+	}
+	if string(patch) == "{}" {
+		return nil
+	}
+
+	a.log.Info("Patching drifted object", "Kind", u.GetKind(), "Namespace", u.GetNamespace(), "Name", u.GetName())
+	if _, err := ri.Patch(u.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("Error patching %s: %s", u.GetKind(), err)
+	}
+	return nil
+}
+
+// isUnsupported reports whether err is the apiserver's answer to a server-side apply
+// request when the ServerSideApply feature is disabled.
+func isUnsupported(err error) bool {
+	if errors.IsUnsupportedMediaType(err) {
+		return true
+	}
+	if se, ok := err.(errors.APIStatus); ok {
+		return se.Status().Code == http.StatusUnsupportedMediaType
+	}
+	return false
+}
+
+// setLastApplied records the manifest without the ignored fields in the LastAppliedAnnotation of itself.
+func setLastApplied(u *unstructured.Unstructured, ignored [][]string) error {
+	c := u.DeepCopy()
+	removeFields(c, ignored)
+	annotations := c.GetAnnotations()
+	delete(annotations, LastAppliedAnnotation)
+	if len(annotations) == 0 {
+		unstructured.RemoveNestedField(c.Object, "metadata", "annotations")
+	} else {
+		c.SetAnnotations(annotations)
+	}
+
+	data, err := c.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("Error encoding %s annotation: %s", LastAppliedAnnotation, err)
+	}
+
+	annotations = u.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[LastAppliedAnnotation] = string(data)
+	u.SetAnnotations(annotations)
+	return nil
+}
+
+// toUnstructured converts obj into an unstructured object carrying its GVK.
+// Server populated fields like status are dropped, they are never applied.
+func (a *Applier) toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	u := &unstructured.Unstructured{}
+	if uo, ok := obj.(*unstructured.Unstructured); ok {
+		u = uo.DeepCopy()
+	} else {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, fmt.Errorf("Error converting object to unstructured: %s", err)
+		}
+		u.SetUnstructuredContent(content)
+	}
+
+	if u.GetKind() == "" {
+		gvk, err := apiutil.GVKForObject(obj, a.scheme)
+		if err != nil {
+			return nil, fmt.Errorf("Error looking up object kind: %s", err)
+		}
+		u.SetGroupVersionKind(gvk)
+	}
+
+	unstructured.RemoveNestedField(u.Object, "status")
+	unstructured.RemoveNestedField(u.Object, "metadata", "creationTimestamp")
+
+	return u, nil
+}
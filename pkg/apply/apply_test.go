@@ -0,0 +1,507 @@
+package apply
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var (
+	serviceAccountGVR = schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"}
+	clusterRoleGVR    = schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}
+	widgetGVR         = schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+)
+
+func newTestMapper() meta.RESTMapper {
+	m := meta.NewDefaultRESTMapper(nil)
+	m.Add(schema.GroupVersionKind{Version: "v1", Kind: "ServiceAccount"}, meta.RESTScopeNamespace)
+	m.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+	m.Add(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}, meta.RESTScopeNamespace)
+	for _, kind := range []string{"Deployment", "StatefulSet", "DaemonSet"} {
+		m.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: kind}, meta.RESTScopeNamespace)
+	}
+	return m
+}
+
+// newTestClient returns a fake dynamic client rejecting server-side apply requests
+// like an apiserver without the ServerSideApply feature does.
+func newTestClient(objs ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	dc := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objs...)
+	dc.PrependReactor("patch", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		pa := action.(clienttesting.PatchAction)
+		if pa.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		gr := pa.GetResource().GroupResource()
+		return true, nil, errors.NewGenericServerResponse(http.StatusUnsupportedMediaType, "patch", gr, pa.GetName(), "", 0, false)
+	})
+	return dc
+}
+
+func mergePatches(dc *dynamicfake.FakeDynamicClient) int {
+	var count int
+	for _, action := range dc.Actions() {
+		if pa, ok := action.(clienttesting.PatchAction); ok && pa.GetPatchType() == types.MergePatchType {
+			count++
+		}
+	}
+	return count
+}
+
+func newTestWidget(color string, replicas int64, annotations map[string]string) *unstructured.Unstructured {
+	w := &unstructured.Unstructured{}
+	w.SetAPIVersion("example.com/v1")
+	w.SetKind("Widget")
+	w.SetName("a-widget")
+	w.SetNamespace("test-namespace")
+	w.SetAnnotations(annotations)
+	unstructured.SetNestedField(w.Object, color, "spec", "color")
+	unstructured.SetNestedField(w.Object, replicas, "spec", "replicas")
+	return w
+}
+
+func newTestOwner() *v1alpha1.NopOperator {
+	return &v1alpha1.NopOperator{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "NopOperator",
+			APIVersion: "operators.nefeli.eu/v1alpha1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nop-operator",
+			Namespace: "test-namespace",
+			UID:       "1234",
+		},
+	}
+}
+
+func TestApply(t *testing.T) {
+	s := runtime.NewScheme()
+	scheme.AddToScheme(s)
+	v1alpha1.SchemeBuilder.AddToScheme(s)
+
+	widget := &unstructured.Unstructured{}
+	widget.SetAPIVersion("example.com/v1")
+	widget.SetKind("Widget")
+	widget.SetName("a-widget")
+	unstructured.SetNestedField(widget.Object, "blue", "spec", "color")
+
+	tests := []struct {
+		desc      string
+		obj       runtime.Object
+		gvr       schema.GroupVersionResource
+		namespace string
+		wantOwner bool
+		wantErr   bool
+	}{
+		{
+			desc: "typed namespaced object defaults to owner namespace",
+			obj: &corev1.ServiceAccount{
+				TypeMeta:   metav1.TypeMeta{Kind: "ServiceAccount", APIVersion: "v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: "a-operator"},
+			},
+			gvr:       serviceAccountGVR,
+			namespace: "test-namespace",
+			wantOwner: true,
+		},
+		{
+			desc: "typed object in foreign namespace",
+			obj: &corev1.ServiceAccount{
+				TypeMeta:   metav1.TypeMeta{Kind: "ServiceAccount", APIVersion: "v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: "a-operator", Namespace: "default"},
+			},
+			gvr:       serviceAccountGVR,
+			namespace: "default",
+		},
+		{
+			desc: "cluster scoped object",
+			obj: &rbacv1.ClusterRole{
+				TypeMeta:   metav1.TypeMeta{Kind: "ClusterRole", APIVersion: "rbac.authorization.k8s.io/v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: "a-operator"},
+			},
+			gvr: clusterRoleGVR,
+		},
+		{
+			desc:      "unstructured custom resource",
+			obj:       widget,
+			gvr:       widgetGVR,
+			namespace: "test-namespace",
+			wantOwner: true,
+		},
+		{
+			desc: "unmapped kind",
+			obj: &corev1.ConfigMap{
+				TypeMeta:   metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: "a-operator"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			dc := newTestClient()
+			a := NewApplier(dc, newTestMapper(), s, logf.Log)
+
+			ref, err := a.Apply(newTestOwner(), FieldManager("a-operator"), test.obj)
+			if test.wantErr {
+				if err == nil {
+					t.Error("want error but got nothing")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got unexpected error: %s", err)
+			}
+
+			name := test.obj.(metav1.Object).GetName()
+			if ref.Namespace != test.namespace || ref.Name != name {
+				t.Errorf("got reference: %s, want namespace: %q, name: %q", ref, test.namespace, name)
+			}
+
+			got, err := dc.Resource(test.gvr).Namespace(test.namespace).Get(name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("object not created: %s", err)
+			}
+
+			gotOwner := len(got.GetOwnerReferences()) > 0
+			if gotOwner != test.wantOwner {
+				t.Errorf("got owner reference: %t, want owner reference: %t", gotOwner, test.wantOwner)
+			}
+
+			if _, found, _ := unstructured.NestedFieldNoCopy(got.Object, "status"); found {
+				t.Error("got status field on applied object")
+			}
+		})
+	}
+}
+
+func TestApplyExisting(t *testing.T) {
+	s := runtime.NewScheme()
+	scheme.AddToScheme(s)
+	v1alpha1.SchemeBuilder.AddToScheme(s)
+
+	existing := &unstructured.Unstructured{}
+	existing.SetAPIVersion("v1")
+	existing.SetKind("ServiceAccount")
+	existing.SetName("a-operator")
+	existing.SetNamespace("test-namespace")
+	existing.SetLabels(map[string]string{"app": "a-operator"})
+
+	dc := newTestClient(existing)
+	a := NewApplier(dc, newTestMapper(), s, logf.Log)
+
+	sa := &corev1.ServiceAccount{
+		TypeMeta:   metav1.TypeMeta{Kind: "ServiceAccount", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "a-operator"},
+	}
+	if _, err := a.Apply(newTestOwner(), FieldManager("a-operator"), sa); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	got, err := dc.Resource(serviceAccountGVR).Namespace("test-namespace").Get("a-operator", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got.GetLabels(), existing.GetLabels()); diff != "" {
+		t.Errorf("got diff: %s", diff)
+	}
+}
+
+func TestApplyDrift(t *testing.T) {
+	s := runtime.NewScheme()
+	scheme.AddToScheme(s)
+	v1alpha1.SchemeBuilder.AddToScheme(s)
+
+	tests := []struct {
+		desc         string
+		live         *unstructured.Unstructured
+		lastApplied  *unstructured.Unstructured
+		desired      *unstructured.Unstructured
+		wantColor    string
+		wantReplicas int64
+		wantPatch    bool
+	}{
+		{
+			desc:         "drifted owned field",
+			live:         newTestWidget("red", 1, nil),
+			desired:      newTestWidget("blue", 1, nil),
+			wantColor:    "blue",
+			wantReplicas: 1,
+			wantPatch:    true,
+		},
+		{
+			desc:         "ignored field on manifest",
+			live:         newTestWidget("blue", 5, nil),
+			desired:      newTestWidget("blue", 1, map[string]string{IgnoreFieldsAnnotation: "spec.replicas"}),
+			wantColor:    "blue",
+			wantReplicas: 5,
+			wantPatch:    true,
+		},
+		{
+			desc:         "ignored field on live object",
+			live:         newTestWidget("red", 5, map[string]string{IgnoreFieldsAnnotation: "spec.replicas"}),
+			desired:      newTestWidget("blue", 1, nil),
+			wantColor:    "blue",
+			wantReplicas: 5,
+			wantPatch:    true,
+		},
+		{
+			desc:         "ignored field previously applied",
+			live:         newTestWidget("red", 5, nil),
+			lastApplied:  newTestWidget("red", 1, nil),
+			desired:      newTestWidget("blue", 1, map[string]string{IgnoreFieldsAnnotation: "spec.replicas"}),
+			wantColor:    "blue",
+			wantReplicas: 5,
+			wantPatch:    true,
+		},
+		{
+			desc:        "field removed from manifest",
+			live:        newTestWidget("blue", 3, nil),
+			lastApplied: newTestWidget("blue", 3, nil),
+			desired: func() *unstructured.Unstructured {
+				w := newTestWidget("blue", 0, nil)
+				unstructured.RemoveNestedField(w.Object, "spec", "replicas")
+				return w
+			}(),
+			wantColor: "blue",
+			wantPatch: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			// Server populated fields are not part of the manifest and must not count as drift.
+			test.live.SetUID("5678")
+			test.live.SetOwnerReferences([]metav1.OwnerReference{
+				*metav1.NewControllerRef(newTestOwner(), v1alpha1.SchemeGroupVersion.WithKind("NopOperator")),
+			})
+			if test.lastApplied != nil {
+				if err := setLastApplied(test.lastApplied, nil); err != nil {
+					t.Fatal(err)
+				}
+				test.live.SetAnnotations(test.lastApplied.GetAnnotations())
+			}
+
+			dc := newTestClient(test.live)
+			a := NewApplier(dc, newTestMapper(), s, logf.Log)
+
+			if _, err := a.Apply(newTestOwner(), FieldManager("a-operator"), test.desired); err != nil {
+				t.Fatalf("got unexpected error: %s", err)
+			}
+
+			got, err := dc.Resource(widgetGVR).Namespace("test-namespace").Get("a-widget", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			color, _, _ := unstructured.NestedString(got.Object, "spec", "color")
+			if color != test.wantColor {
+				t.Errorf("got color: %s, want color: %s", color, test.wantColor)
+			}
+			replicas, _, _ := unstructured.NestedInt64(got.Object, "spec", "replicas")
+			if replicas != test.wantReplicas {
+				t.Errorf("got replicas: %d, want replicas: %d", replicas, test.wantReplicas)
+			}
+
+			gotPatch := mergePatches(dc) > 0
+			if gotPatch != test.wantPatch {
+				t.Errorf("got patch: %t, want patch: %t", gotPatch, test.wantPatch)
+			}
+		})
+	}
+}
+
+func TestApplyIdempotent(t *testing.T) {
+	s := runtime.NewScheme()
+	scheme.AddToScheme(s)
+	v1alpha1.SchemeBuilder.AddToScheme(s)
+
+	dc := newTestClient()
+	a := NewApplier(dc, newTestMapper(), s, logf.Log)
+
+	desired := newTestWidget("blue", 1, map[string]string{IgnoreFieldsAnnotation: "spec.replicas"})
+	for i := 0; i < 2; i++ {
+		if _, err := a.Apply(newTestOwner(), FieldManager("a-operator"), desired); err != nil {
+			t.Fatalf("got unexpected error: %s", err)
+		}
+	}
+
+	if got := mergePatches(dc); got != 0 {
+		t.Errorf("got %d patches for unchanged manifest, want none", got)
+	}
+}
+
+func TestServerSideApply(t *testing.T) {
+	s := runtime.NewScheme()
+	scheme.AddToScheme(s)
+	v1alpha1.SchemeBuilder.AddToScheme(s)
+
+	tests := []struct {
+		desc           string
+		missing        bool
+		applyStatus    int
+		applyReason    metav1.StatusReason
+		conflict       string
+		wantErr        bool
+		wantMergePatch bool
+		wantForce      []string
+	}{
+		{
+			desc:        "apply accepted",
+			applyStatus: http.StatusOK,
+			wantForce:   []string{""},
+		},
+		{
+			// Ignored fields are set by a merge patch, not owned by the apply operation
+			desc:           "missing object created by apply",
+			missing:        true,
+			applyStatus:    http.StatusOK,
+			wantMergePatch: true,
+			wantForce:      []string{""},
+		},
+		{
+			desc:        "conflict with other controller forced",
+			applyStatus: http.StatusOK,
+			conflict:    `conflict with "kubectl" using example.com/v1`,
+			wantForce:   []string{"", "true"},
+		},
+		{
+			desc:        "conflict with own update forced",
+			applyStatus: http.StatusOK,
+			conflict:    `conflict with "nop-operator/a-operator" using example.com/v1`,
+			wantForce:   []string{"", "true"},
+		},
+		{
+			desc:        "conflict with other channel",
+			applyStatus: http.StatusOK,
+			conflict:    `conflict with "nop-operator/b-operator"`,
+			wantErr:     true,
+			wantForce:   []string{""},
+		},
+		{
+			desc:        "conflict with unknown manager",
+			applyStatus: http.StatusConflict,
+			applyReason: metav1.StatusReasonConflict,
+			wantErr:     true,
+			wantForce:   []string{""},
+		},
+		{
+			desc:           "apply not supported",
+			applyStatus:    http.StatusUnsupportedMediaType,
+			wantMergePatch: true,
+			wantForce:      []string{""},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			live := newTestWidget("red", 1, nil)
+
+			var gotManager string
+			var gotForce []string
+			var gotApplied map[string]interface{}
+			var gotMergePatch bool
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.Method == http.MethodGet && test.missing:
+					w.WriteHeader(http.StatusNotFound)
+					json.NewEncoder(w).Encode(metav1.Status{
+						TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+						Status:   metav1.StatusFailure,
+						Code:     http.StatusNotFound,
+						Reason:   metav1.StatusReasonNotFound,
+					})
+				case r.Method == http.MethodGet:
+					json.NewEncoder(w).Encode(live.Object)
+				case r.Method == http.MethodPatch && r.Header.Get("Content-Type") == string(types.ApplyPatchType):
+					gotManager = r.URL.Query().Get("fieldManager")
+					gotForce = append(gotForce, r.URL.Query().Get("force"))
+					if test.conflict != "" && r.URL.Query().Get("force") != "true" {
+						w.WriteHeader(http.StatusConflict)
+						json.NewEncoder(w).Encode(metav1.Status{
+							TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+							Status:   metav1.StatusFailure,
+							Code:     http.StatusConflict,
+							Reason:   metav1.StatusReasonConflict,
+							Details: &metav1.StatusDetails{
+								Causes: []metav1.StatusCause{{Type: metav1.CauseTypeFieldManagerConflict, Message: test.conflict, Field: ".spec.color"}},
+							},
+						})
+						return
+					}
+					if test.applyStatus != http.StatusOK {
+						w.WriteHeader(test.applyStatus)
+						json.NewEncoder(w).Encode(metav1.Status{
+							TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+							Status:   metav1.StatusFailure,
+							Code:     int32(test.applyStatus),
+							Reason:   test.applyReason,
+						})
+						return
+					}
+					body, _ := ioutil.ReadAll(r.Body)
+					json.Unmarshal(body, &gotApplied)
+					w.Write(body)
+				case r.Method == http.MethodPatch && r.Header.Get("Content-Type") == string(types.MergePatchType):
+					gotMergePatch = true
+					json.NewEncoder(w).Encode(live.Object)
+				default:
+					w.WriteHeader(http.StatusMethodNotAllowed)
+				}
+			}))
+			defer ts.Close()
+
+			dc, err := dynamic.NewForConfig(&rest.Config{Host: ts.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := NewApplier(dc, newTestMapper(), s, logf.Log)
+
+			desired := newTestWidget("blue", 1, nil)
+			if test.missing {
+				desired = newTestWidget("blue", 3, map[string]string{IgnoreFieldsAnnotation: "spec.replicas"})
+			}
+			_, err = a.Apply(newTestOwner(), FieldManager("a-operator"), desired)
+			if test.wantErr && err == nil {
+				t.Error("want error but got nothing")
+			}
+			if !test.wantErr && err != nil {
+				t.Errorf("got unexpected error: %s", err)
+			}
+			if gotManager != "nop-operator/a-operator" {
+				t.Errorf("got field manager: %q, want: %q", gotManager, "nop-operator/a-operator")
+			}
+			if gotMergePatch != test.wantMergePatch {
+				t.Errorf("got merge patch: %t, want merge patch: %t", gotMergePatch, test.wantMergePatch)
+			}
+			// Only conflicts with managers outside of nop-operator are forced
+			if diff := cmp.Diff(test.wantForce, gotForce); diff != "" {
+				t.Errorf("got force diff (-want, +got): %s", diff)
+			}
+			if _, found, _ := unstructured.NestedFieldNoCopy(gotApplied, "spec", "replicas"); test.missing && found {
+				t.Error("got ignored field spec.replicas in apply patch")
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package apply
+
+import (
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// IgnoreFieldsAnnotation lists comma separated field paths (e.g. "spec.replicas")
+// that nop-operator leaves to other controllers. It is honored on both the
+// manifest shipped by the channel and the live object in the cluster.
+const IgnoreFieldsAnnotation = "operators.nefeli.eu/ignore-fields"
+
+// ignoredFields returns the field paths declared by IgnoreFieldsAnnotation on the given objects.
+func ignoredFields(objs ...*unstructured.Unstructured) [][]string {
+	var paths [][]string
+	for _, o := range objs {
+		if o == nil {
+			continue
+		}
+		for _, p := range strings.Split(o.GetAnnotations()[IgnoreFieldsAnnotation], ",") {
+			p = strings.TrimSpace(p)
+			if p == "" {
+				continue
+			}
+			paths = append(paths, strings.Split(p, "."))
+		}
+	}
+	return paths
+}
+
+// removeFields drops every path from the object's content.
+func removeFields(u *unstructured.Unstructured, paths [][]string) {
+	for _, p := range paths {
+		unstructured.RemoveNestedField(u.Object, p...)
+	}
+}
+
+// isSubset reports whether every field set in desired has the same value in live.
+// Fields only present in live (server defaults, fields written by other controllers)
+// are not taken into account. Lists are compared element-wise and must have equal length.
+func isSubset(desired, live interface{}) bool {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, dv := range d {
+			lv, found := l[k]
+			if !found {
+				if dv == nil {
+					continue
+				}
+				return false
+			}
+			if !isSubset(dv, lv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			return false
+		}
+		for i := range d {
+			if !isSubset(d[i], l[i]) {
+				return false
+			}
+		}
+		return true
+	case int64:
+		if f, ok := live.(float64); ok {
+			return float64(d) == f
+		}
+	case float64:
+		if i, ok := live.(int64); ok {
+			return d == float64(i)
+		}
+	}
+	return reflect.DeepEqual(desired, live)
+}
@@ -0,0 +1,117 @@
+package apply
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CheckHealth checks that the workloads among refs are rolled out, i.e. Deployments are
+// available with all replicas updated, and StatefulSets and DaemonSets have all replicas
+// ready and updated. Other kinds are healthy once applied. The returned error names the
+// workloads not yet rolled out.
+func (a *Applier) CheckHealth(refs []Ref) error {
+	var unhealthy []string
+	for _, ref := range refs {
+		if ref.Group != "apps" {
+			continue
+		}
+		check, ok := healthChecks[ref.Kind]
+		if !ok {
+			continue
+		}
+
+		gvk := schema.GroupVersionKind{Group: ref.Group, Version: ref.Version, Kind: ref.Kind}
+		mapping, err := a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return fmt.Errorf("Error mapping %s to a resource: %s", gvk, err)
+		}
+		live, err := a.client.Resource(mapping.Resource).Namespace(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("Error reading %s %s: %s", ref.Kind, ref.Name, err)
+		}
+
+		if msg := check(live); msg != "" {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s %s/%s %s", ref.Kind, ref.Namespace, ref.Name, msg))
+		}
+	}
+	if len(unhealthy) > 0 {
+		return fmt.Errorf("%s", strings.Join(unhealthy, ", "))
+	}
+	return nil
+}
+
+// healthChecks by kind of the apps group return why a workload is not rolled out, an empty
+// string once it is.
+var healthChecks = map[string]func(*unstructured.Unstructured) string{
+	"Deployment":  deploymentHealth,
+	"StatefulSet": statefulSetHealth,
+	"DaemonSet":   daemonSetHealth,
+}
+
+func deploymentHealth(u *unstructured.Unstructured) string {
+	if msg := observed(u); msg != "" {
+		return msg
+	}
+	replicas := specReplicas(u)
+	if updated, _, _ := unstructured.NestedInt64(u.Object, "status", "updatedReplicas"); updated < replicas {
+		return fmt.Sprintf("has %d/%d replicas updated", updated, replicas)
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+	for _, c := range conditions {
+		cm, ok := c.(map[string]interface{})
+		if ok && cm["type"] == "Available" && cm["status"] == "True" {
+			return ""
+		}
+	}
+	return "is not available"
+}
+
+func statefulSetHealth(u *unstructured.Unstructured) string {
+	if msg := observed(u); msg != "" {
+		return msg
+	}
+	replicas := specReplicas(u)
+	if ready, _, _ := unstructured.NestedInt64(u.Object, "status", "readyReplicas"); ready < replicas {
+		return fmt.Sprintf("has %d/%d replicas ready", ready, replicas)
+	}
+	if updated, _, _ := unstructured.NestedInt64(u.Object, "status", "updatedReplicas"); updated < replicas {
+		return fmt.Sprintf("has %d/%d replicas updated", updated, replicas)
+	}
+	return ""
+}
+
+func daemonSetHealth(u *unstructured.Unstructured) string {
+	if msg := observed(u); msg != "" {
+		return msg
+	}
+	desired, _, _ := unstructured.NestedInt64(u.Object, "status", "desiredNumberScheduled")
+	if ready, _, _ := unstructured.NestedInt64(u.Object, "status", "numberReady"); ready < desired {
+		return fmt.Sprintf("has %d/%d pods ready", ready, desired)
+	}
+	if updated, _, _ := unstructured.NestedInt64(u.Object, "status", "updatedNumberScheduled"); updated < desired {
+		return fmt.Sprintf("has %d/%d pods updated", updated, desired)
+	}
+	return ""
+}
+
+// observed reports a workload whose controller has not yet seen its latest spec.
+func observed(u *unstructured.Unstructured) string {
+	if gen, _, _ := unstructured.NestedInt64(u.Object, "status", "observedGeneration"); gen < u.GetGeneration() {
+		return "is not yet observed by its controller"
+	}
+	return ""
+}
+
+// specReplicas returns the desired replicas of a workload, defaulting to 1.
+func specReplicas(u *unstructured.Unstructured) int64 {
+	replicas, found, _ := unstructured.NestedInt64(u.Object, "spec", "replicas")
+	if !found {
+		return 1
+	}
+	return replicas
+}
@@ -0,0 +1,103 @@
+package apply
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func newTestWorkload(kind string, generation int64, spec, status map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec, "status": status}}
+	u.SetAPIVersion("apps/v1")
+	u.SetKind(kind)
+	u.SetNamespace("test-namespace")
+	u.SetName("a-operator")
+	u.SetGeneration(generation)
+	return u
+}
+
+func TestCheckHealth(t *testing.T) {
+	available := []interface{}{map[string]interface{}{"type": "Available", "status": "True"}}
+	unavailable := []interface{}{map[string]interface{}{"type": "Available", "status": "False"}}
+
+	tests := []struct {
+		desc    string
+		obj     *unstructured.Unstructured
+		wantErr string
+	}{
+		{
+			desc: "available deployment",
+			obj: newTestWorkload("Deployment", 2, map[string]interface{}{"replicas": int64(2)},
+				map[string]interface{}{"observedGeneration": int64(2), "updatedReplicas": int64(2), "conditions": available}),
+		},
+		{
+			desc: "deployment without replicas",
+			obj: newTestWorkload("Deployment", 1, map[string]interface{}{},
+				map[string]interface{}{"observedGeneration": int64(1), "updatedReplicas": int64(1), "conditions": available}),
+		},
+		{
+			desc:    "deployment not yet observed",
+			obj:     newTestWorkload("Deployment", 2, map[string]interface{}{}, map[string]interface{}{"observedGeneration": int64(1)}),
+			wantErr: "Deployment test-namespace/a-operator is not yet observed by its controller",
+		},
+		{
+			desc: "deployment rolling out",
+			obj: newTestWorkload("Deployment", 1, map[string]interface{}{"replicas": int64(3)},
+				map[string]interface{}{"observedGeneration": int64(1), "updatedReplicas": int64(1), "conditions": available}),
+			wantErr: "has 1/3 replicas updated",
+		},
+		{
+			desc: "unavailable deployment",
+			obj: newTestWorkload("Deployment", 1, map[string]interface{}{},
+				map[string]interface{}{"observedGeneration": int64(1), "updatedReplicas": int64(1), "conditions": unavailable}),
+			wantErr: "is not available",
+		},
+		{
+			desc: "ready statefulset",
+			obj: newTestWorkload("StatefulSet", 1, map[string]interface{}{"replicas": int64(2)},
+				map[string]interface{}{"observedGeneration": int64(1), "readyReplicas": int64(2), "updatedReplicas": int64(2)}),
+		},
+		{
+			desc: "statefulset not ready",
+			obj: newTestWorkload("StatefulSet", 1, map[string]interface{}{"replicas": int64(2)},
+				map[string]interface{}{"observedGeneration": int64(1), "readyReplicas": int64(1), "updatedReplicas": int64(2)}),
+			wantErr: "has 1/2 replicas ready",
+		},
+		{
+			desc: "ready daemonset",
+			obj: newTestWorkload("DaemonSet", 1, map[string]interface{}{},
+				map[string]interface{}{"observedGeneration": int64(1), "desiredNumberScheduled": int64(3), "numberReady": int64(3), "updatedNumberScheduled": int64(3)}),
+		},
+		{
+			desc: "daemonset rolling out",
+			obj: newTestWorkload("DaemonSet", 1, map[string]interface{}{},
+				map[string]interface{}{"observedGeneration": int64(1), "desiredNumberScheduled": int64(3), "numberReady": int64(3), "updatedNumberScheduled": int64(2)}),
+			wantErr: "has 2/3 pods updated",
+		},
+		{
+			desc: "other kinds",
+			obj:  newTestWidget("blue", 1, nil),
+		},
+	}
+
+	s := runtime.NewScheme()
+	scheme.AddToScheme(s)
+	v1alpha1.SchemeBuilder.AddToScheme(s)
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			a := NewApplier(newTestClient(test.obj), newTestMapper(), s, logf.Log)
+			err := a.CheckHealth([]Ref{newRef(test.obj)})
+			if got := fmt.Sprint(err); test.wantErr == "" && err != nil || !strings.Contains(got, test.wantErr) {
+				t.Errorf("got error %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
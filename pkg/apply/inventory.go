@@ -0,0 +1,246 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// PruneAnnotation set to "false" on a live object keeps it in the cluster
+// after it disappeared from its channel.
+const PruneAnnotation = "operators.nefeli.eu/prune"
+
+// Finalizer keeps the owner of an inventory until the objects of its inventory are pruned.
+// Cluster-scoped objects and objects in other namespaces than the owner's are not garbage
+// collected along with it.
+const Finalizer = "operators.nefeli.eu/inventory"
+
+// Ref identifies an object applied to the cluster.
+type Ref struct {
+	Group     string
+	Version   string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func newRef(u *unstructured.Unstructured) Ref {
+	gvk := u.GroupVersionKind()
+	return Ref{
+		Group:     gvk.Group,
+		Version:   gvk.Version,
+		Kind:      gvk.Kind,
+		Namespace: u.GetNamespace(),
+		Name:      u.GetName(),
+	}
+}
+
+// ParseRef parses the string representation of a Ref.
+func ParseRef(s string) (Ref, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 5 {
+		return Ref{}, fmt.Errorf("Error parsing object reference %q", s)
+	}
+	return Ref{Group: parts[0], Version: parts[1], Kind: parts[2], Namespace: parts[3], Name: parts[4]}, nil
+}
+
+// String returns the Ref as group/version/kind/namespace/name.
+func (r Ref) String() string {
+	return strings.Join([]string{r.Group, r.Version, r.Kind, r.Namespace, r.Name}, "/")
+}
+
+// key identifies the object independent of the API version it was applied with.
+func (r Ref) key() string {
+	return strings.Join([]string{r.Group, r.Kind, r.Namespace, r.Name}, "/")
+}
+
+// Inventory records the objects applied per channel name.
+type Inventory map[string][]Ref
+
+// Stale returns all objects of the inventory missing in current, regardless of
+// the channel they are recorded for. Objects moving between channels are not stale.
+func (inv Inventory) Stale(current Inventory) []Ref {
+	keep := map[string]bool{}
+	for _, refs := range current {
+		for _, ref := range refs {
+			keep[ref.key()] = true
+		}
+	}
+
+	var stale []Ref
+	for _, refs := range inv {
+		for _, ref := range refs {
+			if !keep[ref.key()] {
+				stale = append(stale, ref)
+			}
+		}
+	}
+	return stale
+}
+
+// InventoryName returns the name of the ConfigMap holding the inventory of owner. The kind
+// of owner is part of the name, thus owners of different kinds may share the same name.
+func InventoryName(kind string, owner metav1.Object) string {
+	return fmt.Sprintf("%s-%s-inventory", owner.GetName(), strings.ToLower(kind))
+}
+
+// LoadInventory reads the inventory of owner. A missing inventory is returned empty.
+func LoadInventory(ctx context.Context, c client.Client, kind string, owner metav1.Object) (Inventory, error) {
+	cm := &corev1.ConfigMap{}
+	key := types.NamespacedName{Name: InventoryName(kind, owner), Namespace: owner.GetNamespace()}
+	if err := c.Get(ctx, key, cm); err != nil {
+		if errors.IsNotFound(err) {
+			return Inventory{}, nil
+		}
+		return nil, fmt.Errorf("Error reading inventory: %s", err)
+	}
+
+	inv := Inventory{}
+	for channel, data := range cm.Data {
+		for _, line := range strings.Split(data, "\n") {
+			if line == "" {
+				continue
+			}
+			ref, err := ParseRef(line)
+			if err != nil {
+				return nil, err
+			}
+			inv[channel] = append(inv[channel], ref)
+		}
+	}
+	return inv, nil
+}
+
+// SaveInventory stores inv as the inventory of owner. The inventory ConfigMap
+// is controlled by owner and removed along with it.
+func SaveInventory(ctx context.Context, c client.Client, scheme *runtime.Scheme, kind string, owner metav1.Object, inv Inventory) error {
+	data := map[string]string{}
+	for channel, refs := range inv {
+		lines := make([]string, 0, len(refs))
+		for _, ref := range refs {
+			lines = append(lines, ref.String())
+		}
+		sort.Strings(lines)
+		data[channel] = strings.Join(lines, "\n")
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      InventoryName(kind, owner),
+			Namespace: owner.GetNamespace(),
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, c, cm, func() error {
+		cm.Data = data
+		return controllerutil.SetControllerReference(owner, cm, scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("Error writing inventory: %s", err)
+	}
+	return nil
+}
+
+// Prune deletes the referenced objects from the cluster. Objects already gone, including
+// objects of kinds no longer served, e.g. custom resources of a definition pruned before, or
+// annotated with PruneAnnotation set to "false" are skipped. Failing objects do not stop the
+// others from being pruned, their errors are returned together.
+func (a *Applier) Prune(refs []Ref) error {
+	var errs []error
+	for _, ref := range refs {
+		if err := a.prune(ref); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// prune deletes the referenced object, see Prune.
+func (a *Applier) prune(ref Ref) error {
+	gvk := schema.GroupVersionKind{Group: ref.Group, Version: ref.Version, Kind: ref.Kind}
+	mapping, err := a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		a.log.Info("Skipping object of kind no longer served", "Kind", ref.Kind, "Namespace", ref.Namespace, "Name", ref.Name)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Error mapping %s to a resource: %s", gvk, err)
+	}
+
+	ri := a.client.Resource(mapping.Resource).Namespace(ref.Namespace)
+	live, err := ri.Get(ref.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Error reading %s %s: %s", ref.Kind, ref.Name, err)
+	}
+
+	if live.GetAnnotations()[PruneAnnotation] == "false" {
+		a.log.Info("Keeping object removed from channel", "Kind", ref.Kind, "Namespace", ref.Namespace, "Name", ref.Name)
+		return nil
+	}
+
+	a.log.Info("Pruning object removed from channel", "Kind", ref.Kind, "Namespace", ref.Namespace, "Name", ref.Name)
+	policy := metav1.DeletePropagationBackground
+	err = ri.Delete(ref.Name, &metav1.DeleteOptions{PropagationPolicy: &policy})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("Error pruning %s %s: %s", ref.Kind, ref.Name, err)
+	}
+	return nil
+}
+
+// AddFinalizer adds the Finalizer to owner and reports whether it was missing.
+func AddFinalizer(owner metav1.Object) bool {
+	for _, f := range owner.GetFinalizers() {
+		if f == Finalizer {
+			return false
+		}
+	}
+	owner.SetFinalizers(append(owner.GetFinalizers(), Finalizer))
+	return true
+}
+
+// Finalize prunes all objects of the inventory of obj, an owner being deleted, and removes the
+// Finalizer from it once they are gone, see Prune. The inventory itself is garbage collected
+// along with obj.
+func (a *Applier) Finalize(ctx context.Context, c client.Client, kind string, obj runtime.Object) error {
+	owner, err := meta.Accessor(obj)
+	if err != nil {
+		return fmt.Errorf("Error accessing object metadata: %s", err)
+	}
+
+	var finalizers []string
+	for _, f := range owner.GetFinalizers() {
+		if f != Finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	if len(finalizers) == len(owner.GetFinalizers()) {
+		return nil
+	}
+
+	inv, err := LoadInventory(ctx, c, kind, owner)
+	if err != nil {
+		return err
+	}
+	if err := a.Prune(inv.Stale(Inventory{})); err != nil {
+		return err
+	}
+
+	owner.SetFinalizers(finalizers)
+	if err := c.Update(ctx, obj); err != nil {
+		return fmt.Errorf("Error removing finalizer: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package apply
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestInventoryStale(t *testing.T) {
+	sa := Ref{Version: "v1", Kind: "ServiceAccount", Namespace: "default", Name: "a-operator"}
+	rb := Ref{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding", Namespace: "default", Name: "a-operator"}
+	rbBeta := Ref{Group: "rbac.authorization.k8s.io", Version: "v1beta1", Kind: "RoleBinding", Namespace: "default", Name: "a-operator"}
+	cr := Ref{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole", Name: "a-operator"}
+
+	tests := []struct {
+		desc    string
+		prev    Inventory
+		current Inventory
+		want    []Ref
+	}{
+		{
+			desc:    "nothing removed",
+			prev:    Inventory{"a-operator": {sa, rb}},
+			current: Inventory{"a-operator": {sa, rb}},
+		},
+		{
+			desc:    "object removed from channel",
+			prev:    Inventory{"a-operator": {sa, rb, cr}},
+			current: Inventory{"a-operator": {sa, rb}},
+			want:    []Ref{cr},
+		},
+		{
+			desc:    "channel removed",
+			prev:    Inventory{"a-operator": {sa}, "b-operator": {cr}},
+			current: Inventory{"a-operator": {sa}},
+			want:    []Ref{cr},
+		},
+		{
+			desc:    "object moved between channels",
+			prev:    Inventory{"a-operator": {sa, cr}},
+			current: Inventory{"a-operator": {sa}, "b-operator": {cr}},
+		},
+		{
+			desc:    "object changed api version",
+			prev:    Inventory{"a-operator": {rbBeta}},
+			current: Inventory{"a-operator": {rb}},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			if diff := cmp.Diff(test.prev.Stale(test.current), test.want); diff != "" {
+				t.Errorf("got diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestInventoryRoundTrip(t *testing.T) {
+	s := runtime.NewScheme()
+	scheme.AddToScheme(s)
+	v1alpha1.SchemeBuilder.AddToScheme(s)
+
+	c := fake.NewFakeClientWithScheme(s)
+	owner := newTestOwner()
+	ctx := context.TODO()
+
+	got, err := LoadInventory(ctx, c, "NopOperator", owner)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got inventory %v, want empty inventory", got)
+	}
+
+	want := Inventory{
+		"a-operator": {
+			{Version: "v1", Kind: "ServiceAccount", Namespace: "default", Name: "a-operator"},
+			{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole", Name: "a-operator"},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if err := SaveInventory(ctx, c, s, "NopOperator", owner, want); err != nil {
+			t.Fatalf("got unexpected error: %s", err)
+		}
+	}
+
+	got, err = LoadInventory(ctx, c, "NopOperator", owner)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got diff: %s", diff)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	s := runtime.NewScheme()
+	scheme.AddToScheme(s)
+	v1alpha1.SchemeBuilder.AddToScheme(s)
+
+	pruned := newTestWidget("blue", 1, nil)
+	pruned.SetName("pruned-widget")
+	kept := newTestWidget("blue", 1, map[string]string{PruneAnnotation: "false"})
+	kept.SetName("kept-widget")
+
+	dc := newTestClient(pruned, kept)
+	a := NewApplier(dc, newTestMapper(), s, logf.Log)
+
+	refs := []Ref{
+		newRef(pruned),
+		newRef(kept),
+		{Group: "example.com", Version: "v1", Kind: "Widget", Namespace: "test-namespace", Name: "gone-widget"},
+		// The definition of gadgets was removed along with all gadgets
+		{Group: "example.com", Version: "v1", Kind: "Gadget", Namespace: "test-namespace", Name: "a-gadget"},
+	}
+	if err := a.Prune(refs); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	list, err := dc.Resource(widgetGVR).Namespace("test-namespace").List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range list.Items {
+		got = append(got, item.GetName())
+	}
+	if diff := cmp.Diff(got, []string{"kept-widget"}); diff != "" {
+		t.Errorf("got diff: %s", diff)
+	}
+}
+
+func TestPruneContinuesOnError(t *testing.T) {
+	s := runtime.NewScheme()
+	scheme.AddToScheme(s)
+	v1alpha1.SchemeBuilder.AddToScheme(s)
+
+	failing := newTestWidget("blue", 1, nil)
+	failing.SetName("failing-widget")
+	pruned := newTestWidget("blue", 1, nil)
+	pruned.SetName("pruned-widget")
+
+	dc := newTestClient(failing, pruned)
+	dc.PrependReactor("delete", "widgets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.(clienttesting.DeleteAction).GetName() != "failing-widget" {
+			return false, nil, nil
+		}
+		return true, nil, errors.NewForbidden(widgetGVR.GroupResource(), "failing-widget", fmt.Errorf("denied"))
+	})
+	a := NewApplier(dc, newTestMapper(), s, logf.Log)
+
+	err := a.Prune([]Ref{newRef(failing), newRef(pruned)})
+	if err == nil || !strings.Contains(err.Error(), "failing-widget") {
+		t.Errorf("got error %v, want error pruning failing-widget", err)
+	}
+
+	if _, err := dc.Resource(widgetGVR).Namespace("test-namespace").Get("pruned-widget", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("want pruned-widget pruned despite failing-widget, got: %v", err)
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	s := runtime.NewScheme()
+	scheme.AddToScheme(s)
+	v1alpha1.SchemeBuilder.AddToScheme(s)
+
+	// Objects in other namespaces are not garbage collected along with the owner
+	widget := newTestWidget("blue", 1, nil)
+	widget.SetNamespace("other-namespace")
+	dc := newTestClient(widget)
+	a := NewApplier(dc, newTestMapper(), s, logf.Log)
+
+	owner := newTestOwner()
+	if !AddFinalizer(owner) || AddFinalizer(owner) {
+		t.Fatalf("got finalizers %v, want finalizer added once", owner.GetFinalizers())
+	}
+	c := fake.NewFakeClientWithScheme(s, owner)
+	ctx := context.TODO()
+	if err := SaveInventory(ctx, c, s, "NopOperator", owner, Inventory{"a-operator": {newRef(widget)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Finalize(ctx, c, "NopOperator", owner); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	if _, err := dc.Resource(widgetGVR).Namespace("other-namespace").Get(widget.GetName(), metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("got widget in other namespace not pruned: %v", err)
+	}
+	got := &v1alpha1.NopOperator{}
+	if err := c.Get(ctx, types.NamespacedName{Name: owner.Name, Namespace: owner.Namespace}, got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.GetFinalizers()) != 0 {
+		t.Errorf("got finalizers %v, want none", got.GetFinalizers())
+	}
+}
@@ -0,0 +1,172 @@
+package channels
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Limits bound what is read from a channel archive to defend against decompression bombs.
+type Limits struct {
+	// MaxArchiveSize is the size of a compressed archive
+	MaxArchiveSize int64
+	// MaxUnpackedSize is the size of the tar stream of an archive once decompressed
+	MaxUnpackedSize int64
+	// MaxEntries is the number of entries of an archive
+	MaxEntries int
+	// MaxFileSize is the size of a single file of an archive
+	MaxFileSize int64
+}
+
+// ArchiveLimits bound every archive read from channels.
+var ArchiveLimits = Limits{
+	MaxArchiveSize:  32 << 20,
+	MaxUnpackedSize: 128 << 20,
+	MaxEntries:      4096,
+	MaxFileSize:     8 << 20,
+}
+
+// manifestFile is a file of a channel bundle by its slash separated path within the bundle.
+type manifestFile struct {
+	name string
+	data []byte
+}
+
+// limitedReader reads from r like io.LimitReader, but fails with err once more than n bytes
+// are read instead of silently truncating the stream.
+type limitedReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, l.err
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, l.err
+	}
+	return n, err
+}
+
+// readAll reads r into memory like ioutil.ReadAll, but fails once what is read exceeds n bytes.
+func readAll(r io.Reader, n int64, what string) ([]byte, error) {
+	return ioutil.ReadAll(&limitedReader{r: r, n: n, err: fmt.Errorf("%s exceeds %d bytes", what, n)})
+}
+
+// readArchive reads a compressed archive from r into memory, failing for archives exceeding
+// the MaxArchiveSize of limits. Archives are held in memory as they are verified before
+// anything of them is unpacked.
+func readArchive(r io.Reader, limits Limits) ([]byte, error) {
+	data, err := readAll(r, limits.MaxArchiveSize, "archive")
+	if err != nil {
+		return nil, fmt.Errorf("Error reading archive: %s", err)
+	}
+	return data, nil
+}
+
+// untarGzip reads the regular files of the gzip compressed tar stream r.
+func untarGzip(r io.Reader, limits Limits) ([]manifestFile, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("Error unarchiving manifests: %s", err)
+	}
+	defer gz.Close()
+
+	return untar(gz, limits)
+}
+
+// untar reads the regular files of the tar stream r into memory, sorted by their path. Files
+// occurring more than once, e.g. in several layers of an OCI artifact, are read from their
+// last occurrence.
+func untar(r io.Reader, limits Limits) ([]manifestFile, error) {
+	tr := tar.NewReader(&limitedReader{
+		r:   r,
+		n:   limits.MaxUnpackedSize,
+		err: fmt.Errorf("unpacked archive exceeds %d bytes", limits.MaxUnpackedSize),
+	})
+
+	files := map[string][]byte{}
+	for entries := 0; ; entries++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error unarchiving manifests: %s", err)
+		}
+		if entries >= limits.MaxEntries {
+			return nil, fmt.Errorf("Error unarchiving manifests: archive exceeds %d entries", limits.MaxEntries)
+		}
+		if err := checkEntry(hdr); err != nil {
+			return nil, fmt.Errorf("Error unarchiving manifests: %s", err)
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if hdr.Size > limits.MaxFileSize {
+			return nil, fmt.Errorf("Error unarchiving manifests: %s exceeds %d bytes", hdr.Name, limits.MaxFileSize)
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("Error unarchiving %s: %s", hdr.Name, err)
+		}
+		files[path.Clean(strings.TrimPrefix(hdr.Name, "./"))] = data
+	}
+
+	return sortedFiles(files), nil
+}
+
+// checkEntry refuses entries of an archive that could escape the bundle once extracted, i.e.
+// paths outside the bundle, links and special files. Only regular files and directories
+// are allowed.
+func checkEntry(hdr *tar.Header) error {
+	name := strings.TrimPrefix(hdr.Name, "./")
+	if path.IsAbs(name) || strings.HasPrefix(name, `\`) || len(name) > 1 && name[1] == ':' {
+		return fmt.Errorf("entry %q has an absolute path", hdr.Name)
+	}
+	for _, elem := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if elem == ".." {
+			return fmt.Errorf("entry %q points outside of the archive", hdr.Name)
+		}
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeDir, tar.TypeXGlobalHeader:
+		return nil
+	case tar.TypeSymlink:
+		return fmt.Errorf("entry %q is a symlink to %q, only regular files and directories are allowed", hdr.Name, hdr.Linkname)
+	case tar.TypeLink:
+		return fmt.Errorf("entry %q is a hardlink to %q, only regular files and directories are allowed", hdr.Name, hdr.Linkname)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		return fmt.Errorf("entry %q is a device or fifo, only regular files and directories are allowed", hdr.Name)
+	}
+	return fmt.Errorf("entry %q has unsupported type %q, only regular files and directories are allowed", hdr.Name, hdr.Typeflag)
+}
+
+// sortedFiles returns files sorted by their path.
+func sortedFiles(files map[string][]byte) []manifestFile {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sorted := make([]manifestFile, 0, len(names))
+	for _, name := range names {
+		sorted = append(sorted, manifestFile{name: name, data: files[name]})
+	}
+	return sorted
+}
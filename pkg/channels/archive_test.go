@@ -0,0 +1,220 @@
+package channels
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+)
+
+// testEntry is an entry of an archive built by tarGz.
+type testEntry struct {
+	hdr  tar.Header
+	data string
+}
+
+// tarGz returns a gzip compressed tar archive of entries. Regular files get their size from data.
+func tarGz(t *testing.T, entries ...testEntry) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := e.hdr
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.data))
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func file(name, data string) testEntry {
+	return testEntry{hdr: tar.Header{Typeflag: tar.TypeReg, Name: name}, data: data}
+}
+
+func TestUntarGzip(t *testing.T) {
+	limits := Limits{MaxArchiveSize: 1 << 20, MaxUnpackedSize: 64 << 10, MaxEntries: 4, MaxFileSize: 1024}
+
+	tests := []struct {
+		desc    string
+		archive []byte
+		// maxSize overrides the MaxUnpackedSize of limits
+		maxSize   int64
+		wantFiles []string
+		wantErr   bool
+	}{
+		{
+			desc: "sorted files",
+			archive: tarGz(t,
+				testEntry{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "deploy/"}},
+				file("deploy/sa.yaml", testServiceAccount),
+				file("./deploy/cm.yaml", testConfigMap),
+			),
+			wantFiles: []string{"deploy/cm.yaml", "deploy/sa.yaml"},
+		},
+		{
+			desc:      "duplicate file",
+			archive:   tarGz(t, file("sa.yaml", "old"), file("sa.yaml", testServiceAccount)),
+			wantFiles: []string{"sa.yaml"},
+		},
+		{
+			desc:    "too many entries",
+			archive: tarGz(t, file("1", ""), file("2", ""), file("3", ""), file("4", ""), file("5", "")),
+			wantErr: true,
+		},
+		{
+			desc:    "file too large",
+			archive: tarGz(t, file("large.yaml", strings.Repeat("a", 1025))),
+			wantErr: true,
+		},
+		{
+			desc:    "unpacked archive too large",
+			archive: tarGz(t, file("1", strings.Repeat("a", 1000)), file("2", strings.Repeat("a", 1000)), file("3", strings.Repeat("a", 1000))),
+			maxSize: 2048,
+			wantErr: true,
+		},
+		{
+			desc:    "not compressed",
+			archive: []byte(testServiceAccount),
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			l := limits
+			if test.maxSize != 0 {
+				l.MaxUnpackedSize = test.maxSize
+			}
+			files, err := untarGzip(bytes.NewReader(test.archive), l)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error: %v, want error: %t", err, test.wantErr)
+			}
+			var names []string
+			for _, f := range files {
+				names = append(names, f.name)
+			}
+			if strings.Join(names, ",") != strings.Join(test.wantFiles, ",") {
+				t.Errorf("got files %v, want %v", names, test.wantFiles)
+			}
+			if test.desc == "duplicate file" && string(files[0].data) != testServiceAccount {
+				t.Errorf("got content %q of the first occurrence, want the last one", files[0].data)
+			}
+		})
+	}
+}
+
+func TestReadArchive(t *testing.T) {
+	limits := Limits{MaxArchiveSize: 10}
+
+	if _, err := readArchive(strings.NewReader(strings.Repeat("a", 10)), limits); err != nil {
+		t.Errorf("got error %v for archive at the limit", err)
+	}
+	if _, err := readArchive(strings.NewReader(strings.Repeat("a", 11)), limits); err == nil {
+		t.Error("got no error for archive exceeding the limit")
+	}
+}
+
+func TestUntarMalicious(t *testing.T) {
+	tests := []struct {
+		archive string
+		wantErr string
+	}{
+		{archive: "traversal.tar.gz", wantErr: `entry "a-operator/../../evil.yaml" points outside of the archive`},
+		{archive: "absolute.tar.gz", wantErr: `entry "/tmp/evil.yaml" has an absolute path`},
+		{archive: "symlink.tar.gz", wantErr: `entry "a-operator/passwd" is a symlink to "/etc/passwd"`},
+		{archive: "hardlink.tar.gz", wantErr: `entry "a-operator/passwd" is a hardlink to "/etc/passwd"`},
+		{archive: "device.tar.gz", wantErr: `entry "a-operator/null" is a device or fifo`},
+		{archive: "fifo.tar.gz", wantErr: `entry "a-operator/fifo" is a device or fifo`},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.archive, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", test.archive))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			files, err := untarGzip(f, ArchiveLimits)
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got error: %v, want error containing: %s", err, test.wantErr)
+			}
+			if files != nil {
+				t.Errorf("got files %v of a malicious archive", files)
+			}
+		})
+	}
+}
+
+func TestBoundedReads(t *testing.T) {
+	tests := []struct {
+		desc  string
+		limit int64
+		read  func(client *http.Client, url string) error
+		want  string
+	}{
+		{
+			desc:  "index",
+			limit: maxIndexSize,
+			read: func(client *http.Client, url string) error {
+				_, err := FetchIndex(client, url, nil)
+				return err
+			},
+			want: "channel index exceeds",
+		},
+		{
+			desc:  "signature",
+			limit: maxSignatureSize,
+			read: func(client *http.Client, url string) error {
+				_, err := fetchSignature(client, url, nil)
+				return err
+			},
+			want: "signature exceeds",
+		},
+		{
+			desc:  "manifest",
+			limit: maxManifestSize,
+			read: func(client *http.Client, rawurl string) error {
+				ref := &ociReference{Registry: strings.TrimPrefix(rawurl, "https://"), Repository: "team/a-operator", Tag: "1.2.3"}
+				_, err := (&ociReader{client: client, channel: v1alpha1.OperatorChannel{Name: "a-operator"}}).fetchManifest(ref)
+				return err
+			},
+			want: "manifest exceeds",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(bytes.Repeat([]byte("a"), int(test.limit)+1))
+			}))
+			defer ts.Close()
+
+			if err := test.read(ts.Client(), ts.URL); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package channels
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// TokenKey is the key of a bearer token in a channel's auth Secret
+	TokenKey = "token"
+	// HeaderKeyPrefix prefixes keys of a channel's auth Secret holding custom request headers,
+	// e.g. "header.X-Api-Key"
+	HeaderKeyPrefix = "header."
+)
+
+// loadAuth returns the request headers authenticating the channel's downloads with the
+// credentials of the referenced Secret. The Secret holds either corev1.BasicAuthUsernameKey
+// and corev1.BasicAuthPasswordKey for basic auth or TokenKey for a bearer token, and any
+// number of custom headers.
+func loadAuth(ctx context.Context, c client.Client, namespace string, ref *corev1.LocalObjectReference) (http.Header, error) {
+	if ref == nil {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, secret); err != nil {
+		return nil, fmt.Errorf("Error loading credentials from secret %s: %s", ref.Name, err)
+	}
+
+	header := http.Header{}
+	for k, v := range secret.Data {
+		if strings.HasPrefix(k, HeaderKeyPrefix) {
+			header.Set(strings.TrimPrefix(k, HeaderKeyPrefix), string(v))
+		}
+	}
+
+	username, hasUsername := secret.Data[corev1.BasicAuthUsernameKey]
+	password, hasPassword := secret.Data[corev1.BasicAuthPasswordKey]
+	token, hasToken := secret.Data[TokenKey]
+	switch {
+	case hasToken && (hasUsername || hasPassword):
+		return nil, fmt.Errorf("Error loading credentials: secret %s holds both basic auth credentials and a bearer token", ref.Name)
+	case hasPassword && !hasUsername:
+		return nil, fmt.Errorf("Error loading credentials: secret %s holds a password without username", ref.Name)
+	case hasUsername:
+		creds := base64.StdEncoding.EncodeToString([]byte(string(username) + ":" + string(password)))
+		header.Set("Authorization", "Basic "+creds)
+	case hasToken:
+		header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	if len(header) == 0 {
+		return nil, fmt.Errorf("Error loading credentials: secret %s holds no credentials", ref.Name)
+	}
+	return header, nil
+}
+
+// authHost returns the host the channel's credentials are sent to, the host of its index if
+// the channel is resolved through one, of its git repository or of its url otherwise.
+func authHost(channel v1alpha1.OperatorChannel) string {
+	rawurl := channel.URL
+	switch {
+	case channel.Source != nil && channel.Source.Git != nil:
+		rawurl = channel.Source.Git.Repo
+	case channel.Index != "":
+		rawurl = channel.Index
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// headerFor returns header for requests to rawurl if rawurl is on host, nil otherwise. It keeps
+// credentials from archives, signatures or token services an index or registry points to on
+// other hosts.
+func headerFor(rawurl, host string, header http.Header) http.Header {
+	u, err := url.Parse(rawurl)
+	if err != nil || host == "" || strings.ToLower(u.Host) != host {
+		return nil
+	}
+	return header
+}
+
+// get issues a GET request for url carrying header.
+func get(client *http.Client, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return authClient(client, header).Do(req)
+}
+
+// authClient returns client dropping header from requests redirected to another host than
+// the one of the original request. net/http drops the Authorization header only, custom
+// headers of a channel's auth Secret would survive such redirects.
+func authClient(client *http.Client, header http.Header) *http.Client {
+	if len(header) == 0 {
+		return client
+	}
+
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+			for k := range header {
+				req.Header.Del(k)
+			}
+		}
+		if client.CheckRedirect != nil {
+			return client.CheckRedirect(req, via)
+		}
+		// The default policy of net/http
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &c
+}
@@ -0,0 +1,187 @@
+package channels
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestLoadAuth(t *testing.T) {
+	tests := []struct {
+		desc    string
+		data    map[string][]byte
+		want    http.Header
+		wantErr bool
+	}{
+		{
+			desc: "basic auth",
+			data: map[string][]byte{"username": []byte("jane"), "password": []byte("secret")},
+			want: http.Header{"Authorization": {"Basic amFuZTpzZWNyZXQ="}},
+		},
+		{
+			desc: "bearer token",
+			data: map[string][]byte{"token": []byte("abc\n")},
+			want: http.Header{"Authorization": {"Bearer abc"}},
+		},
+		{
+			desc: "custom headers",
+			data: map[string][]byte{"header.x-api-key": []byte("abc"), "header.X-Tenant": []byte("team-a")},
+			want: http.Header{"X-Api-Key": {"abc"}, "X-Tenant": {"team-a"}},
+		},
+		{
+			desc: "bearer token and custom header",
+			data: map[string][]byte{"token": []byte("abc"), "header.X-Tenant": []byte("team-a")},
+			want: http.Header{"Authorization": {"Bearer abc"}, "X-Tenant": {"team-a"}},
+		},
+		{
+			desc:    "basic auth and bearer token",
+			data:    map[string][]byte{"username": []byte("jane"), "token": []byte("abc")},
+			wantErr: true,
+		},
+		{
+			desc:    "password without username",
+			data:    map[string][]byte{"password": []byte("secret")},
+			wantErr: true,
+		},
+		{
+			desc:    "no credentials",
+			data:    map[string][]byte{"other": []byte("value")},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "repo-auth", Namespace: "team-a"},
+				Data:       test.data,
+			}
+			c := fake.NewFakeClientWithScheme(scheme.Scheme, secret)
+
+			got, err := loadAuth(context.TODO(), c, "team-a", &corev1.LocalObjectReference{Name: "repo-auth"})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error: %v, want error: %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("got diff: %s", diff)
+			}
+		})
+	}
+
+	c := fake.NewFakeClientWithScheme(scheme.Scheme)
+	if _, err := loadAuth(context.TODO(), c, "team-a", &corev1.LocalObjectReference{Name: "missing"}); err == nil {
+		t.Error("want error for missing secret, got nothing")
+	}
+}
+
+func TestReadAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.ServeFile(w, r, "./testdata/valid.tar.gz")
+	}))
+	defer ts.Close()
+
+	channel := v1alpha1.OperatorChannel{
+		Name:        "a-operator",
+		ChannelSpec: v1alpha1.ChannelSpec{URL: ts.URL, Version: "1.2.3"},
+	}
+
+	tests := []struct {
+		desc    string
+		header  http.Header
+		wantErr bool
+	}{
+		{desc: "anonymous", wantErr: true},
+		{desc: "wrong token", header: http.Header{"Authorization": {"Bearer xyz"}}, wantErr: true},
+		{desc: "valid token", header: http.Header{"Authorization": {"Bearer abc"}}},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			_, _, err := newTestReader(t, ts.Client(), channel, ReaderOptions{Header: test.header, AuthHost: authHost(channel)}).Read()
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error: %v, want error: %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestHeaderFor(t *testing.T) {
+	header := http.Header{"Authorization": {"Bearer abc"}}
+
+	tests := []struct {
+		desc    string
+		channel v1alpha1.ChannelSpec
+		url     string
+		want    http.Header
+	}{
+		{desc: "channel url", channel: v1alpha1.ChannelSpec{URL: "https://example.com/a.tar.gz"}, url: "https://example.com/a.tar.gz.sig", want: header},
+		{desc: "host case", channel: v1alpha1.ChannelSpec{URL: "https://Example.com/a.tar.gz"}, url: "https://EXAMPLE.com/a.tar.gz", want: header},
+		{desc: "other host", channel: v1alpha1.ChannelSpec{URL: "https://example.com/a.tar.gz"}, url: "https://sigs.example.com/a.tar.gz.sig"},
+		{desc: "other port", channel: v1alpha1.ChannelSpec{URL: "https://example.com/a.tar.gz"}, url: "https://example.com:8443/a.tar.gz"},
+		{desc: "index host", channel: v1alpha1.ChannelSpec{Index: "https://index.example.com/index.yaml"}, url: "https://index.example.com/a.tar.gz", want: header},
+		{desc: "archive of index on other host", channel: v1alpha1.ChannelSpec{Index: "https://index.example.com/index.yaml", URL: "https://cdn.example.com/a.tar.gz"}, url: "https://cdn.example.com/a.tar.gz"},
+		{desc: "git repository", channel: v1alpha1.ChannelSpec{Source: &v1alpha1.SourceSpec{Git: &v1alpha1.GitSource{Repo: "https://git.example.com/a.git"}}}, url: "https://git.example.com/a.git", want: header},
+		{desc: "oci registry", channel: v1alpha1.ChannelSpec{URL: "oci://registry.example.com/team/a:1.2.3"}, url: "https://registry.example.com/v2/team/a/manifests/1.2.3", want: header},
+		{desc: "token service on other host", channel: v1alpha1.ChannelSpec{URL: "oci://registry.example.com/team/a:1.2.3"}, url: "https://auth.example.com/token"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			host := authHost(v1alpha1.OperatorChannel{Name: "a-operator", ChannelSpec: test.channel})
+			if diff := cmp.Diff(headerFor(test.url, host, header), test.want); diff != "" {
+				t.Errorf("got diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestGetDropsHeaderOnCrossHostRedirect(t *testing.T) {
+	var got http.Header
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer other.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/same" {
+			got = r.Header
+			return
+		}
+		http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+	}))
+	defer ts.Close()
+
+	header := http.Header{"Authorization": {"Bearer abc"}, "X-Api-Key": {"secret"}}
+	tests := []struct {
+		desc     string
+		to       string
+		wantAuth bool
+	}{
+		{desc: "same host", to: ts.URL + "/same", wantAuth: true},
+		{desc: "other host", to: other.URL},
+	}
+	for _, test := range tests {
+		got = nil
+		resp, err := get(ts.Client(), ts.URL+"/redirect?to="+test.to, header)
+		if err != nil {
+			t.Fatalf("%s: got unexpected error: %s", test.desc, err)
+		}
+		resp.Body.Close()
+		for _, k := range []string{"Authorization", "X-Api-Key"} {
+			if (got.Get(k) != "") != test.wantAuth {
+				t.Errorf("%s: got header %s %q, want sent %t", test.desc, k, got.Get(k), test.wantAuth)
+			}
+		}
+	}
+}
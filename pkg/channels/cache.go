@@ -0,0 +1,363 @@
+package channels
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// DefaultCacheSize is the size in bytes of the archives kept by BundleCache by default.
+const DefaultCacheSize = 256 << 20
+
+// DefaultCacheMemory is the size in bytes of the manifests of the bundles BundleCache keeps
+// decoded in memory by default.
+const DefaultCacheMemory = 64 << 20
+
+// DefaultCacheDir is the directory BundleCache keeps archives in by default.
+var DefaultCacheDir = filepath.Join(os.TempDir(), "nop-operator", "bundles")
+
+// BundleCache keeps the archives fetched over HTTP and their decoded objects, nil disables
+// caching. It is shared by all channels, thus channels pointing to the same archive share
+// one copy.
+var BundleCache = NewCache(DefaultCacheDir, DefaultCacheSize, DefaultCacheMemory)
+
+var (
+	cacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "nop_operator_bundle_cache_hits_total",
+		Help: "Number of channel reads served from the bundle cache",
+	})
+	cacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "nop_operator_bundle_cache_misses_total",
+		Help: "Number of channel reads unpacking a fetched archive",
+	})
+	cacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "nop_operator_bundle_cache_size_bytes",
+		Help: "Size of the archives kept in the bundle cache",
+	})
+	cacheMemory = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "nop_operator_bundle_cache_memory_bytes",
+		Help: "Size of the manifests of the bundles kept decoded in the bundle cache",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(cacheHits, cacheMisses, cacheSize, cacheMemory)
+}
+
+// Cache stores archives on disk by their digest along with their decoded bundles. The
+// validators of the last response per URL and credentials allow conditional requests, a
+// server answering 304 Not Modified is served from the cache. Once the archives exceed the
+// cache's size, the least recently used ones are evicted. Decoded bundles are kept in memory
+// as long as their manifests fit the cache's memory, the least recently used ones are
+// dropped and decoded from their archive again when needed.
+type Cache struct {
+	dir       string
+	maxSize   int64
+	maxMemory int64
+
+	mu      sync.Mutex
+	size    int64
+	memory  int64
+	entries map[string]*cacheEntry
+	// validators by validatorKey
+	validators map[string]validator
+}
+
+type cacheEntry struct {
+	path string
+	size int64
+	// bundle decoded from the archive, nil once dropped from memory
+	bundle   *Bundle
+	lastUsed time.Time
+}
+
+// validator holds what a server sent to identify the archive at a URL.
+type validator struct {
+	etag         string
+	lastModified string
+	digest       string
+}
+
+// NewCache returns a cache keeping up to maxSize bytes of archives in dir and the bundles
+// of up to maxMemory bytes of manifests decoded in memory.
+func NewCache(dir string, maxSize, maxMemory int64) *Cache {
+	return &Cache{
+		dir:        dir,
+		maxSize:    maxSize,
+		maxMemory:  maxMemory,
+		entries:    map[string]*cacheEntry{},
+		validators: map[string]validator{},
+	}
+}
+
+// cachedArchiveName matches the names of archives in a cache's directory, see add.
+var cachedArchiveName = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// Clean removes the archives left in the cache's directory, e.g. by a previous run of the
+// operator with the same volume. Such archives are not known to the cache, thus never
+// evicted. Other files of the directory are left as is.
+func (c *Cache) Clean() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files, err := ioutil.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error reading bundle cache: %s", err)
+	}
+	for _, f := range files {
+		if _, known := c.entries["sha256:"+f.Name()]; known || !f.Mode().IsRegular() || !cachedArchiveName.MatchString(f.Name()) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, f.Name())); err != nil {
+			return fmt.Errorf("Error cleaning bundle cache: %s", err)
+		}
+	}
+	return nil
+}
+
+// validatorKey returns the key of the validators of responses for url to requests carrying
+// header. Responses for other credentials may differ, e.g. per tenant, thus they are not
+// shared. Credentials are kept by their digest only.
+func validatorKey(url string, header http.Header) string {
+	if len(header) == 0 {
+		return url
+	}
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s: %q\n", k, header[k])
+	}
+	return fmt.Sprintf("%s %x", url, h.Sum(nil))
+}
+
+// conditionalHeader returns header extended by the conditional request headers for key, if
+// the archive last fetched for key is still cached.
+func (c *Cache) conditionalHeader(key string, header http.Header) http.Header {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.validators[key]
+	if _, cached := c.entries[v.digest]; !ok || !cached {
+		return header
+	}
+
+	h := http.Header{}
+	for k, vs := range header {
+		h[k] = vs
+	}
+	if v.etag != "" {
+		h.Set("If-None-Match", v.etag)
+	}
+	if v.lastModified != "" {
+		h.Set("If-Modified-Since", v.lastModified)
+	}
+	return h
+}
+
+// notModified returns the digest of the archive last fetched for key, for a server
+// answering a conditional request with 304 Not Modified.
+func (c *Cache) notModified(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.validators[key]
+	if _, cached := c.entries[v.digest]; !ok || !cached {
+		return "", false
+	}
+	return v.digest, true
+}
+
+// bundle returns a copy of the bundle decoded from the archive with the given digest. Bundles
+// dropped from memory are decoded from their archive again.
+func (c *Cache) bundle(digest string) (*Bundle, bool) {
+	c.mu.Lock()
+	e, ok := c.entries[digest]
+	var b *Bundle
+	if ok {
+		e.lastUsed = time.Now()
+		if e.bundle != nil {
+			b = copyBundle(e.bundle)
+		}
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	if b != nil {
+		return b, true
+	}
+
+	b, err := c.decode(digest)
+	if err != nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[digest]; ok && e.bundle == nil {
+		c.keep(e, b)
+	}
+	return b, true
+}
+
+// decode decodes the bundle of the cached archive with the given digest.
+func (c *Cache) decode(digest string) (*Bundle, error) {
+	data, err := c.archive(digest)
+	if err != nil {
+		return nil, err
+	}
+	files, err := untarGzip(bytes.NewReader(data), ArchiveLimits)
+	if err != nil {
+		return nil, err
+	}
+	b, err := decodeBundle(files)
+	if err != nil {
+		return nil, err
+	}
+	b.Digest = digest
+	return b, nil
+}
+
+// archive returns the content of the cached archive with the given digest.
+func (c *Cache) archive(digest string) ([]byte, error) {
+	c.mu.Lock()
+	e, ok := c.entries[digest]
+	c.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Error reading cached archive %s: evicted", digest)
+	}
+
+	data, err := ioutil.ReadFile(e.path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading cached archive %s: %s", digest, err)
+	}
+	return data, nil
+}
+
+// remember records the validators of resp for key as the ones of the archive with the given
+// digest.
+func (c *Cache) remember(key string, resp *http.Response, digest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[digest]; !ok {
+		return
+	}
+	c.validators[key] = validator{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		digest:       digest,
+	}
+}
+
+// add stores the archive in the cache along with its decoded bundle and evicts the least
+// recently used archives exceeding the cache's size. Archives larger than the cache are not
+// kept.
+func (c *Cache) add(digest string, archive []byte, b *Bundle) error {
+	size := int64(len(archive))
+	if size > c.maxSize {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[digest]; ok {
+		return nil
+	}
+
+	path := filepath.Join(c.dir, strings.TrimPrefix(digest, "sha256:"))
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return fmt.Errorf("Error creating bundle cache: %s", err)
+	}
+	if err := ioutil.WriteFile(path, archive, 0600); err != nil {
+		return fmt.Errorf("Error caching archive %s: %s", digest, err)
+	}
+
+	e := &cacheEntry{path: path, size: size, lastUsed: time.Now()}
+	c.entries[digest] = e
+	c.size += size
+	c.keep(e, b)
+	c.evict()
+	cacheSize.Set(float64(c.size))
+	return nil
+}
+
+// keep keeps a copy of b decoded in memory as the bundle of e and drops the least recently
+// used bundles from memory until they fit the cache's memory.
+func (c *Cache) keep(e *cacheEntry, b *Bundle) {
+	e.bundle = copyBundle(b)
+	c.memory += e.bundle.size
+	for c.memory > c.maxMemory {
+		var oldest *cacheEntry
+		for _, e := range c.entries {
+			if e.bundle != nil && (oldest == nil || e.lastUsed.Before(oldest.lastUsed)) {
+				oldest = e
+			}
+		}
+		c.memory -= oldest.bundle.size
+		oldest.bundle = nil
+	}
+	cacheMemory.Set(float64(c.memory))
+}
+
+// evict removes the least recently used archives until the cache fits its size.
+func (c *Cache) evict() {
+	for c.size > c.maxSize {
+		var oldest string
+		for digest, e := range c.entries {
+			if oldest == "" || e.lastUsed.Before(c.entries[oldest].lastUsed) {
+				oldest = digest
+			}
+		}
+
+		e := c.entries[oldest]
+		os.Remove(e.path)
+		delete(c.entries, oldest)
+		c.size -= e.size
+		if e.bundle != nil {
+			c.memory -= e.bundle.size
+			cacheMemory.Set(float64(c.memory))
+		}
+		for key, v := range c.validators {
+			if v.digest == oldest {
+				delete(c.validators, key)
+			}
+		}
+	}
+}
+
+// copyBundle returns a deep copy of b, cached bundles are never handed out.
+func copyBundle(b *Bundle) *Bundle {
+	c := *b
+	c.Objects = make([]runtime.Object, 0, len(b.Objects))
+	for _, obj := range b.Objects {
+		c.Objects = append(c.Objects, obj.DeepCopyObject())
+	}
+	c.Skipped = append([]string(nil), b.Skipped...)
+	if b.Metadata != nil {
+		c.Metadata = b.Metadata.DeepCopy()
+	}
+	return &c
+}
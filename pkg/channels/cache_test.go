@@ -0,0 +1,319 @@
+package channels
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testArchiveServer serves an archive with an ETag and Last-Modified header, answering
+// conditional requests for an unchanged archive with 304 Not Modified.
+type testArchiveServer struct {
+	archive     []byte
+	conditional bool
+}
+
+func (s *testArchiveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.conditional = r.Header.Get("If-None-Match") != ""
+	w.Header().Set("ETag", `"`+digestOf(s.archive)+`"`)
+	http.ServeContent(w, r, "archive.tar.gz", time.Unix(0, 0), bytes.NewReader(s.archive))
+}
+
+func TestReadCached(t *testing.T) {
+	valid, err := ioutil.ReadFile("./testdata/valid.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := ioutil.ReadFile("./testdata/empty.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "bundle-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		desc    string
+		archive []byte
+		sha256  string
+		// maxSize of the cache, the cache is kept between steps unless it changes
+		maxSize         int64
+		wantConditional bool
+		wantHit         bool
+		wantObjects     int
+		wantErr         bool
+	}{
+		{
+			desc:        "first fetch",
+			archive:     valid,
+			maxSize:     1024,
+			wantObjects: 2,
+		},
+		{
+			desc:            "not modified",
+			archive:         valid,
+			maxSize:         1024,
+			wantConditional: true,
+			wantHit:         true,
+			wantObjects:     2,
+		},
+		{
+			desc:            "not modified but pinned to other digest",
+			archive:         valid,
+			sha256:          digestOf(empty),
+			maxSize:         1024,
+			wantConditional: true,
+			wantErr:         true,
+		},
+		{
+			desc:            "modified",
+			archive:         empty,
+			maxSize:         1024,
+			wantConditional: true,
+		},
+		{
+			desc:            "modified back to a cached archive",
+			archive:         valid,
+			maxSize:         1024,
+			wantConditional: true,
+			wantHit:         true,
+			wantObjects:     2,
+		},
+		{
+			desc:        "archive larger than the cache",
+			archive:     valid,
+			maxSize:     100,
+			wantObjects: 2,
+		},
+		{
+			desc:        "archive larger than the cache fetched again",
+			archive:     valid,
+			maxSize:     100,
+			wantObjects: 2,
+		},
+	}
+
+	srv := &testArchiveServer{}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	var cache *Cache
+	for _, test := range tests {
+		if cache == nil || cache.maxSize != test.maxSize {
+			cache = NewCache(dir, test.maxSize, DefaultCacheMemory)
+		}
+		srv.archive = test.archive
+
+		channel := v1alpha1.OperatorChannel{
+			Name:        "a-operator",
+			ChannelSpec: v1alpha1.ChannelSpec{URL: ts.URL, Version: "1.2.3", SHA256: test.sha256},
+		}
+		hits, misses := testutil.ToFloat64(cacheHits), testutil.ToFloat64(cacheMisses)
+
+		b, _, err := newTestReader(t, ts.Client(), channel, ReaderOptions{Cache: cache}).Read()
+		if (err != nil) != test.wantErr {
+			t.Fatalf("%s: got error: %v, want error: %t", test.desc, err, test.wantErr)
+		}
+		if srv.conditional != test.wantConditional {
+			t.Errorf("%s: got conditional request: %t, want: %t", test.desc, srv.conditional, test.wantConditional)
+		}
+		if err != nil {
+			continue
+		}
+
+		gotHit := testutil.ToFloat64(cacheHits) == hits+1
+		gotMiss := testutil.ToFloat64(cacheMisses) == misses+1
+		if gotHit != test.wantHit || gotMiss == test.wantHit {
+			t.Errorf("%s: got cache hit: %t, miss: %t, want hit: %t", test.desc, gotHit, gotMiss, test.wantHit)
+		}
+		if len(b.Objects) != test.wantObjects {
+			t.Errorf("%s: got %d objects, want %d", test.desc, len(b.Objects), test.wantObjects)
+		}
+		if b.Digest != digestOf(test.archive) {
+			t.Errorf("%s: got digest: %s, want digest: %s", test.desc, b.Digest, digestOf(test.archive))
+		}
+	}
+}
+
+func TestCacheEvict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := NewCache(dir, 150, DefaultCacheMemory)
+	for _, digest := range []string{"sha256:a", "sha256:b", "sha256:c"} {
+		if err := cache.add(digest, make([]byte, 60), &Bundle{}); err != nil {
+			t.Fatal(err)
+		}
+		// a is used more recently than b
+		cache.bundle("sha256:a")
+	}
+
+	for digest, want := range map[string]bool{"sha256:a": true, "sha256:b": false, "sha256:c": true} {
+		if _, ok := cache.bundle(digest); ok != want {
+			t.Errorf("got %s cached: %t, want: %t", digest, ok, want)
+		}
+	}
+	if cache.size != 120 {
+		t.Errorf("got cache size %d, want 120", cache.size)
+	}
+}
+
+func TestCacheMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var archives [][]byte
+	var bundles []*Bundle
+	var digests []string
+	for _, name := range []string{"valid", "multidoc"} {
+		archive, err := ioutil.ReadFile("./testdata/" + name + ".tar.gz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := untarGzip(bytes.NewReader(archive), ArchiveLimits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := decodeBundle(files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Digest = digestOf(archive)
+		archives = append(archives, archive)
+		bundles = append(bundles, b)
+		digests = append(digests, b.Digest)
+	}
+
+	// room for the manifests of the second bundle only
+	cache := NewCache(dir, 1<<20, bundles[1].size)
+	for i, b := range bundles {
+		if err := cache.add(digests[i], archives[i], b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if cache.entries[digests[0]].bundle != nil {
+		t.Errorf("got first bundle kept in memory, want dropped")
+	}
+	if cache.memory != bundles[1].size {
+		t.Errorf("got cache memory %d, want %d", cache.memory, bundles[1].size)
+	}
+
+	got, ok := cache.bundle(digests[0])
+	if !ok {
+		t.Fatalf("got dropped bundle not cached")
+	}
+	if got.Digest != digests[0] || len(got.Objects) != len(bundles[0].Objects) {
+		t.Errorf("got bundle %s with %d objects, want %s with %d objects", got.Digest, len(got.Objects), digests[0], len(bundles[0].Objects))
+	}
+	if cache.entries[digests[1]].bundle != nil {
+		t.Errorf("got second bundle kept in memory after decoding the first again, want dropped")
+	}
+	if cache.memory > cache.maxMemory {
+		t.Errorf("got cache memory %d exceeding %d", cache.memory, cache.maxMemory)
+	}
+}
+
+func TestCacheValidatorsByCredentials(t *testing.T) {
+	valid, err := ioutil.ReadFile("./testdata/valid.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "bundle-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := &testArchiveServer{archive: valid}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	cache := NewCache(dir, 1024, DefaultCacheMemory)
+	channel := v1alpha1.OperatorChannel{
+		Name:        "a-operator",
+		ChannelSpec: v1alpha1.ChannelSpec{URL: ts.URL, Version: "1.2.3"},
+	}
+
+	tests := []struct {
+		desc            string
+		header          http.Header
+		wantConditional bool
+	}{
+		{desc: "first tenant", header: http.Header{"Authorization": {"Bearer tenant-a"}}},
+		{desc: "first tenant again", header: http.Header{"Authorization": {"Bearer tenant-a"}}, wantConditional: true},
+		{desc: "second tenant", header: http.Header{"Authorization": {"Bearer tenant-b"}}},
+		{desc: "anonymous", header: nil},
+		{desc: "first tenant once more", header: http.Header{"Authorization": {"Bearer tenant-a"}}, wantConditional: true},
+	}
+	for _, test := range tests {
+		opts := ReaderOptions{Cache: cache, Header: test.header, AuthHost: authHost(channel)}
+		if _, _, err := newTestReader(t, ts.Client(), channel, opts).Read(); err != nil {
+			t.Fatalf("%s: got unexpected error: %s", test.desc, err)
+		}
+		if srv.conditional != test.wantConditional {
+			t.Errorf("%s: got conditional request: %t, want: %t", test.desc, srv.conditional, test.wantConditional)
+		}
+	}
+}
+
+func TestCacheClean(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache := NewCache(dir, 1024, DefaultCacheMemory)
+	if err := cache.add(digestOf([]byte("kept")), []byte("kept"), &Bundle{}); err != nil {
+		t.Fatal(err)
+	}
+	left := strings.TrimPrefix(digestOf([]byte("left")), "sha256:")
+	for _, name := range []string{left, "README"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("left"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cache.Clean(); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, f.Name())
+	}
+	want := []string{strings.TrimPrefix(digestOf([]byte("kept")), "sha256:"), "README"}
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got files %v, want %v", got, want)
+	}
+
+	if err := NewCache(filepath.Join(dir, "missing"), 1024, DefaultCacheMemory).Clean(); err != nil {
+		t.Errorf("got error cleaning missing cache dir: %s", err)
+	}
+}
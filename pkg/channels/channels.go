@@ -1,97 +1,207 @@
 package channels
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/go-logr/logr"
-	"github.com/mholt/archiver"
 	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
 	"github.com/prometheus/common/log"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// Bundle is the decoded content of a channel archive
+type Bundle struct {
+	Objects []runtime.Object
+	// Digest of the archive as fetched in the form sha256:<hex>
+	Digest string
+	// Commit the bundle was read at, for git sources only
+	Commit string
+	// Skipped files of the bundle, i.e. files without a manifest extension or ignored ones
+	Skipped []string
+	// Metadata read from the bundle's MetadataFile, nil if the bundle has none
+	Metadata *v1alpha1.BundleMetadata
+
+	// size of the manifests the bundle was decoded from
+	size int64
+}
+
 type ChannelReader interface {
-	Read() ([]runtime.Object, bool, error)
+	Read() (*Bundle, bool, error)
+}
+
+// ReaderOptions tune how a ChannelReader fetches and verifies archives.
+type ReaderOptions struct {
+	// Verifier checks the detached signature of the archive, no signature is fetched if nil
+	Verifier *Verifier
+	// Header is sent with every request to AuthHost, e.g. to authenticate
+	Header http.Header
+	// AuthHost is the host of the channel's url or index, see authHost
+	AuthHost string
+	// KubeClient reads the objects of in-cluster sources from Namespace, the namespace of the channel's owner
+	KubeClient client.Client
+	Namespace  string
+	// Cache keeps fetched archives and their objects for conditional requests, nothing is cached if nil
+	Cache *Cache
 }
 
 type simpleReader struct {
 	client  *http.Client
 	log     logr.Logger
 	channel v1alpha1.OperatorChannel
+	opts    ReaderOptions
 }
 
-func NewChannelReader(client *http.Client, log logr.Logger, channel v1alpha1.OperatorChannel) ChannelReader {
-	return &simpleReader{client: client, log: log, channel: channel}
+func newHTTPReader(client *http.Client, log logr.Logger, channel v1alpha1.OperatorChannel, opts ReaderOptions) ChannelReader {
+	return &simpleReader{client: client, log: log, channel: channel, opts: opts}
 }
 
-func (sr *simpleReader) Read() ([]runtime.Object, bool, error) {
+func (sr *simpleReader) Read() (*Bundle, bool, error) {
 	oc := sr.channel
+	cache := sr.opts.Cache
 
 	log.Info("Fetch Manifests for operator: ", "Name: ", oc.Name)
 
-	resp, err := sr.client.Get(oc.URL)
+	header := headerFor(oc.URL, sr.opts.AuthHost, sr.opts.Header)
+	key := validatorKey(oc.URL, header)
+	if cache != nil {
+		header = cache.conditionalHeader(key, header)
+	}
+	resp, err := get(sr.client, oc.URL, header)
 	if err != nil {
 		return nil, false, fmt.Errorf("Error fetching manifests for %s/%s: %s", oc.Name, oc.Version, err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && cache != nil {
+		if digest, ok := cache.notModified(key); ok {
+			return sr.readCached(digest)
+		}
+	}
 	if resp.StatusCode > 299 {
 		return nil, false, fmt.Errorf("Error response status code %d", resp.StatusCode)
 	}
 
-	dir, err := ioutil.TempDir("", "example")
+	data, err := readArchive(resp.Body, ArchiveLimits)
+	if err != nil {
+		return nil, true, err
+	}
+
+	// Nothing of a tampered archive must be unpacked
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	if err := sr.verify(digest, func() ([]byte, error) { return data, nil }); err != nil {
+		return nil, !IsPermanent(err), err
+	}
+
+	// Archives changed on the server without changing their content are unpacked once
+	if cache != nil {
+		if b, ok := cache.bundle(digest); ok {
+			cacheHits.Inc()
+			cache.remember(key, resp, digest)
+			return b, false, nil
+		}
+		cacheMisses.Inc()
+	}
+
+	files, err := untarGzip(bytes.NewReader(data), ArchiveLimits)
 	if err != nil {
-		return nil, true, fmt.Errorf("Error creating manifest tmp dir: %s", err)
+		return nil, true, err
 	}
-	defer os.RemoveAll(dir)
 
-	baseName := fmt.Sprintf("%s-%s", oc.Name, oc.Version)
-	source := filepath.Join(dir, fmt.Sprintf("%s.tar.gz", baseName))
-	out, err := os.Create(source)
+	b, err := decodeBundle(files)
 	if err != nil {
-		return nil, true, fmt.Errorf("Error creating manifest tmp file: %s", err)
+		return nil, false, err
 	}
-	defer out.Close()
+	b.Digest = digest
+
+	if cache != nil {
+		if err := cache.add(digest, data, b); err != nil {
+			sr.log.Error(err, "Error caching archive", "Operator.Name", oc.Name)
+		}
+		cache.remember(key, resp, digest)
+	}
+
+	return b, false, nil
+}
 
-	_, err = io.Copy(out, resp.Body)
+// readCached returns the bundle of the cached archive with the given digest for a server
+// reporting the archive unchanged. The archive is verified again as the channel's pinned
+// digest or signature might have changed since it was fetched.
+func (sr *simpleReader) readCached(digest string) (*Bundle, bool, error) {
+	err := sr.verify(digest, func() ([]byte, error) { return sr.opts.Cache.archive(digest) })
 	if err != nil {
-		return nil, true, fmt.Errorf("Error copy manifest contents into tmp file: %s", err)
+		return nil, !IsPermanent(err), err
 	}
 
-	target := filepath.Join(dir, baseName)
-	if err := archiver.Unarchive(source, target); err != nil {
-		return nil, true, fmt.Errorf("Error unarchiving manifests: %s", err)
+	b, ok := sr.opts.Cache.bundle(digest)
+	if !ok {
+		return nil, true, fmt.Errorf("Error reading cached archive %s: evicted", digest)
 	}
+	cacheHits.Inc()
+	return b, false, nil
+}
 
-	var objs []runtime.Object
-	err = filepath.Walk(target, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			return nil
+// verify checks the archive's digest against the pinned one and its content read by
+// contents against the channel's signature, if any.
+func (sr *simpleReader) verify(digest string, contents func() ([]byte, error)) error {
+	oc := sr.channel
+	if oc.SHA256 != "" {
+		if pinned := normalizeDigest(oc.SHA256); pinned != digest {
+			return &IntegrityError{Expected: pinned, Actual: digest}
 		}
+	}
 
-		contents, err := ioutil.ReadFile(path)
+	if sr.opts.Verifier != nil {
+		sigURL := signatureURL(oc.URL, oc.Signature)
+		sig, err := fetchSignature(sr.client, sigURL, headerFor(sigURL, sr.opts.AuthHost, sr.opts.Header))
 		if err != nil {
 			return err
 		}
-
-		obj, err := runtime.Decode(scheme.Codecs.UniversalDeserializer(), contents)
+		data, err := contents()
 		if err != nil {
 			return err
 		}
-		objs = append(objs, obj)
+		if err := sr.opts.Verifier.Verify(data, sig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeManifests decodes the manifests below dir into a bundle.
+func decodeManifests(dir string) (*Bundle, error) {
+	var files []manifestFile
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
 
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, manifestFile{name: filepath.ToSlash(name), data: contents})
 		return nil
 	})
 
 	if err != nil {
-		return nil, false, fmt.Errorf("Error walking though manifests: %s", err)
+		return nil, fmt.Errorf("Error walking though manifests: %s", err)
 	}
+	return decodeBundle(files)
+}
 
-	return objs, false, nil
+// normalizeDigest returns a hex encoded sha256 digest with or without "sha256:" prefix in the form sha256:<hex>.
+func normalizeDigest(d string) string {
+	return "sha256:" + strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "sha256:"))
 }
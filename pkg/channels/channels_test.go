@@ -24,6 +24,15 @@ func newTestHttpServer(statusCode int, archive string) *httptest.Server {
 	}))
 }
 
+// newTestReader returns the reader registered for the channel's URL or source.
+func newTestReader(t *testing.T, client *http.Client, channel v1alpha1.OperatorChannel, opts ReaderOptions) ChannelReader {
+	r, err := NewChannelReader(client, logf.Log, channel, opts)
+	if err != nil {
+		t.Fatalf("Error creating reader: %s", err)
+	}
+	return r
+}
+
 func TestRead(t *testing.T) {
 	tests := []struct {
 		desc        string
@@ -33,12 +42,17 @@ func TestRead(t *testing.T) {
 		want        []runtime.Object
 		wantErr     bool
 		wantRequeue bool
+		wantDigest  string
+		// wantIntegrityErr expects the archive to be refused before unarchiving
+		wantIntegrityErr bool
 	}{
 		{
 			desc: "non 2xx status code",
 			channel: &v1alpha1.OperatorChannel{
-				Name:    "a-operator",
-				Version: "1.2.3",
+				Name: "a-operator",
+				ChannelSpec: v1alpha1.ChannelSpec{
+					Version: "1.2.3",
+				},
 			},
 			statusCode:  http.StatusBadRequest,
 			wantErr:     true,
@@ -47,8 +61,10 @@ func TestRead(t *testing.T) {
 		{
 			desc: "empty response body",
 			channel: &v1alpha1.OperatorChannel{
-				Name:    "a-operator",
-				Version: "1.2.3",
+				Name: "a-operator",
+				ChannelSpec: v1alpha1.ChannelSpec{
+					Version: "1.2.3",
+				},
 			},
 			statusCode:  http.StatusOK,
 			wantErr:     true,
@@ -57,33 +73,82 @@ func TestRead(t *testing.T) {
 		{
 			desc: "broken archive",
 			channel: &v1alpha1.OperatorChannel{
-				Name:    "a-operator",
-				Version: "1.2.3",
+				Name: "a-operator",
+				ChannelSpec: v1alpha1.ChannelSpec{
+					Version: "1.2.3",
+				},
 			},
 			statusCode:  http.StatusOK,
 			archivePath: "./testdata/broken.tar.gz",
 			wantErr:     true,
 			wantRequeue: true,
 		},
+		{
+			desc: "archive with symlink",
+			channel: &v1alpha1.OperatorChannel{
+				Name: "a-operator",
+				ChannelSpec: v1alpha1.ChannelSpec{
+					Version: "1.2.3",
+				},
+			},
+			statusCode:  http.StatusOK,
+			archivePath: "./testdata/symlink.tar.gz",
+			wantErr:     true,
+			wantRequeue: true,
+		},
 		{
 			desc: "empty archive",
 			channel: &v1alpha1.OperatorChannel{
-				Name:    "a-operator",
-				Version: "1.2.3",
+				Name: "a-operator",
+				ChannelSpec: v1alpha1.ChannelSpec{
+					Version: "1.2.3",
+				},
 			},
 			statusCode:  http.StatusOK,
 			archivePath: "./testdata/empty.tar.gz",
 			wantErr:     false,
 			wantRequeue: false,
+			wantDigest:  "sha256:b38a711fe0723d4e330ebec004cf15afe1e73c973cac85775f6f7697e9aa44b6",
+		},
+		{
+			desc: "pinned digest mismatch",
+			channel: &v1alpha1.OperatorChannel{
+				Name: "a-operator",
+				ChannelSpec: v1alpha1.ChannelSpec{
+					Version: "1.2.3",
+					SHA256:  "b38a711fe0723d4e330ebec004cf15afe1e73c973cac85775f6f7697e9aa44b6",
+				},
+			},
+			statusCode:       http.StatusOK,
+			archivePath:      "./testdata/valid.tar.gz",
+			wantErr:          true,
+			wantIntegrityErr: true,
+			wantRequeue:      false,
+		},
+		{
+			desc: "pinned digest match",
+			channel: &v1alpha1.OperatorChannel{
+				Name: "a-operator",
+				ChannelSpec: v1alpha1.ChannelSpec{
+					Version: "1.2.3",
+					SHA256:  "sha256:B38A711FE0723D4E330EBEC004CF15AFE1E73C973CAC85775F6F7697E9AA44B6",
+				},
+			},
+			statusCode:  http.StatusOK,
+			archivePath: "./testdata/empty.tar.gz",
+			wantDigest:  "sha256:b38a711fe0723d4e330ebec004cf15afe1e73c973cac85775f6f7697e9aa44b6",
 		},
 		{
 			desc: "valid manifests",
 			channel: &v1alpha1.OperatorChannel{
-				Name:    "a-operator",
-				Version: "1.2.3",
+				Name: "a-operator",
+				ChannelSpec: v1alpha1.ChannelSpec{
+					Version: "1.2.3",
+				},
 			},
 			statusCode:  http.StatusOK,
 			archivePath: "./testdata/valid.tar.gz",
+			wantDigest:  "sha256:3d1f4684dcc7de0f74b5ebf4778a2278ad46de7b215591cb6dde145af7e16aa2",
 			want: []runtime.Object{
 				&rbacv1.RoleBinding{
 					TypeMeta: metav1.TypeMeta{
@@ -130,18 +195,31 @@ func TestRead(t *testing.T) {
 			}
 
 			c := ts.Client()
-			r := NewChannelReader(c, logf.Log, *test.channel)
+			r := newTestReader(t, c, *test.channel, ReaderOptions{})
 
-			got, gotR, err := r.Read()
+			b, gotR, err := r.Read()
 			if test.wantErr && err == nil {
 				t.Error("Want error but got nothing")
 			}
+			if IsIntegrityError(err) != test.wantIntegrityErr {
+				t.Errorf("got integrity error: %v, want integrity error: %t", err, test.wantIntegrityErr)
+			}
 			if gotR != test.wantRequeue {
 				t.Errorf("got requeue request: %t, want requeue request: %t", gotR, test.wantRequeue)
 			}
+
+			var got []runtime.Object
+			var gotDigest string
+			if b != nil {
+				got = b.Objects
+				gotDigest = b.Digest
+			}
 			if diff := cmp.Diff(got, test.want); diff != "" {
 				t.Errorf("got diff: %s", diff)
 			}
+			if gotDigest != test.wantDigest {
+				t.Errorf("got digest: %s, want digest: %s", gotDigest, test.wantDigest)
+			}
 		})
 	}
 }
@@ -0,0 +1,161 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// objectReader reads channels from a ConfigMap or Secret in the namespace of the channel's
+// owner, either a single key holding an archive or all keys holding plain manifests.
+type objectReader struct {
+	log     logr.Logger
+	channel v1alpha1.OperatorChannel
+	opts    ReaderOptions
+}
+
+func newObjectReader(_ *http.Client, log logr.Logger, channel v1alpha1.OperatorChannel, opts ReaderOptions) ChannelReader {
+	return &objectReader{log: log, channel: channel, opts: opts}
+}
+
+// objectSource returns the kind ("configmap" or "secret") and reference of the object a
+// channel is read from, either from its source block or its URL of the form
+// configmap://<name>[/<key>] or secret://<name>[/<key>]. It returns nil for other channels.
+func objectSource(spec v1alpha1.ChannelSpec) (string, *v1alpha1.ObjectSource) {
+	if src := spec.Source; src != nil {
+		switch {
+		case src.ConfigMap != nil:
+			return "configmap", src.ConfigMap
+		case src.Secret != nil:
+			return "secret", src.Secret
+		}
+		return "", nil
+	}
+	if spec.Index != "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(spec.URL)
+	if err != nil || u.Host == "" {
+		return "", nil
+	}
+	kind := strings.ToLower(u.Scheme)
+	if kind != "configmap" && kind != "secret" {
+		return "", nil
+	}
+	return kind, &v1alpha1.ObjectSource{Name: u.Host, Key: strings.TrimPrefix(u.Path, "/")}
+}
+
+// Read decodes the manifests of the referenced object. The digest of an archive is the
+// digest of the key's value, the digest of plain manifests is the digest of all values
+// concatenated in key order. Signatures of archives are read from the key suffixed with ".sig".
+func (or *objectReader) Read() (*Bundle, bool, error) {
+	oc := or.channel
+
+	kind, src, data, err := or.fetch()
+	if err != nil {
+		return nil, false, err
+	}
+
+	or.log.Info("Reading manifests from cluster", "Operator.Name", oc.Name, "Kind", kind, "Name", src.Name, "Key", src.Key)
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var content []byte
+	if src.Key != "" {
+		v, ok := data[src.Key]
+		if !ok {
+			return nil, false, fmt.Errorf("Error reading channel %s: %s %s has no key %s", oc.Name, kind, src.Name, src.Key)
+		}
+		content = v
+	} else {
+		for _, k := range keys {
+			content = append(content, data[k]...)
+		}
+	}
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	if oc.SHA256 != "" {
+		if pinned := normalizeDigest(oc.SHA256); pinned != digest {
+			return nil, false, &IntegrityError{Expected: pinned, Actual: digest}
+		}
+	}
+
+	if or.opts.Verifier != nil {
+		sig, ok := data[src.Key+".sig"]
+		if src.Key == "" || !ok || len(sig) == 0 {
+			return nil, false, &SignatureError{Reason: "SignatureMissing", Message: fmt.Sprintf("no signature found in key %s.sig of %s %s", src.Key, kind, src.Name)}
+		}
+		if err := or.opts.Verifier.Verify(content, sig); err != nil {
+			return nil, false, err
+		}
+	}
+
+	var files []manifestFile
+	if src.Key != "" {
+		files, err = untarGzip(bytes.NewReader(content), ArchiveLimits)
+		if err != nil {
+			return nil, false, err
+		}
+	} else {
+		for _, k := range keys {
+			files = append(files, manifestFile{name: k, data: data[k]})
+		}
+	}
+
+	b, err := decodeBundle(files)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error reading %s %s: %s", kind, src.Name, err)
+	}
+	b.Digest = digest
+	return b, false, nil
+}
+
+// fetch returns the kind, the reference and the data of the referenced ConfigMap or Secret.
+func (or *objectReader) fetch() (string, *v1alpha1.ObjectSource, map[string][]byte, error) {
+	kind, src := objectSource(or.channel.ChannelSpec)
+	if src == nil {
+		return "", nil, nil, fmt.Errorf("Error reading channel %s: invalid configmap or secret url %q", or.channel.Name, or.channel.URL)
+	}
+	if or.opts.KubeClient == nil {
+		return "", nil, nil, fmt.Errorf("Error reading channel %s: no client for in-cluster sources", or.channel.Name)
+	}
+	ctx := context.TODO()
+
+	if kind == "configmap" {
+		cm := &corev1.ConfigMap{}
+		key := types.NamespacedName{Name: src.Name, Namespace: or.opts.Namespace}
+		if err := or.opts.KubeClient.Get(ctx, key, cm); err != nil {
+			return "", nil, nil, fmt.Errorf("Error reading configmap %s: %s", key.Name, err)
+		}
+		data := map[string][]byte{}
+		for k, v := range cm.Data {
+			data[k] = []byte(v)
+		}
+		for k, v := range cm.BinaryData {
+			data[k] = v
+		}
+		return kind, src, data, nil
+	}
+
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Name: src.Name, Namespace: or.opts.Namespace}
+	if err := or.opts.KubeClient.Get(ctx, key, secret); err != nil {
+		return "", nil, nil, fmt.Errorf("Error reading secret %s: %s", key.Name, err)
+	}
+	return kind, src, secret.Data, nil
+}
@@ -0,0 +1,147 @@
+package channels
+
+import (
+	"crypto/elliptic"
+	"io/ioutil"
+	"testing"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReadObject(t *testing.T) {
+	archive, err := ioutil.ReadFile("./testdata/valid.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, pub := newTestKey(t, elliptic.P256())
+
+	objs := []runtime.Object{
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "archive", Namespace: "team-a"},
+			BinaryData: map[string][]byte{
+				"a-operator.tar.gz":     archive,
+				"a-operator.tar.gz.sig": sign(t, key, archive),
+				"unsigned.tar.gz":       archive,
+			},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "manifests", Namespace: "team-a"},
+			Data:       map[string]string{"sa.yaml": testServiceAccount, "cm.yaml": testConfigMap},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "broken", Namespace: "team-a"},
+			Data:       map[string]string{"broken.yaml": "kind: [broken"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "archive", Namespace: "team-a"},
+			Data:       map[string][]byte{"a-operator.tar.gz": archive},
+		},
+	}
+	c := fake.NewFakeClientWithScheme(scheme.Scheme, objs...)
+
+	v, err := NewVerifier(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc        string
+		source      v1alpha1.SourceSpec
+		sha256      string
+		verifier    *Verifier
+		wantObjects int
+		wantDigest  string
+		wantErr     bool
+		// wantReason is the reason of an expected SignatureError
+		wantReason string
+	}{
+		{
+			desc:        "archive in configmap",
+			source:      v1alpha1.SourceSpec{ConfigMap: &v1alpha1.ObjectSource{Name: "archive", Key: "a-operator.tar.gz"}},
+			wantObjects: 2,
+			wantDigest:  "sha256:3d1f4684dcc7de0f74b5ebf4778a2278ad46de7b215591cb6dde145af7e16aa2",
+		},
+		{
+			desc:        "archive in secret",
+			source:      v1alpha1.SourceSpec{Secret: &v1alpha1.ObjectSource{Name: "archive", Key: "a-operator.tar.gz"}},
+			sha256:      "3d1f4684dcc7de0f74b5ebf4778a2278ad46de7b215591cb6dde145af7e16aa2",
+			wantObjects: 2,
+			wantDigest:  "sha256:3d1f4684dcc7de0f74b5ebf4778a2278ad46de7b215591cb6dde145af7e16aa2",
+		},
+		{
+			desc:        "plain manifests",
+			source:      v1alpha1.SourceSpec{ConfigMap: &v1alpha1.ObjectSource{Name: "manifests"}},
+			wantObjects: 2,
+			wantDigest:  digestOf([]byte(testConfigMap + testServiceAccount)),
+		},
+		{
+			desc:    "broken manifests",
+			source:  v1alpha1.SourceSpec{ConfigMap: &v1alpha1.ObjectSource{Name: "broken"}},
+			wantErr: true,
+		},
+		{
+			desc:    "missing key",
+			source:  v1alpha1.SourceSpec{ConfigMap: &v1alpha1.ObjectSource{Name: "archive", Key: "missing"}},
+			wantErr: true,
+		},
+		{
+			desc:    "missing configmap",
+			source:  v1alpha1.SourceSpec{ConfigMap: &v1alpha1.ObjectSource{Name: "missing"}},
+			wantErr: true,
+		},
+		{
+			desc:    "pinned digest mismatch",
+			source:  v1alpha1.SourceSpec{ConfigMap: &v1alpha1.ObjectSource{Name: "archive", Key: "a-operator.tar.gz"}},
+			sha256:  "b38a711fe0723d4e330ebec004cf15afe1e73c973cac85775f6f7697e9aa44b6",
+			wantErr: true,
+		},
+		{
+			desc:        "signed archive",
+			source:      v1alpha1.SourceSpec{ConfigMap: &v1alpha1.ObjectSource{Name: "archive", Key: "a-operator.tar.gz"}},
+			verifier:    v,
+			wantObjects: 2,
+			wantDigest:  "sha256:3d1f4684dcc7de0f74b5ebf4778a2278ad46de7b215591cb6dde145af7e16aa2",
+		},
+		{
+			desc:       "unsigned archive",
+			source:     v1alpha1.SourceSpec{ConfigMap: &v1alpha1.ObjectSource{Name: "archive", Key: "unsigned.tar.gz"}},
+			verifier:   v,
+			wantErr:    true,
+			wantReason: "SignatureMissing",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			channel := v1alpha1.OperatorChannel{
+				Name:        "a-operator",
+				ChannelSpec: v1alpha1.ChannelSpec{Source: &test.source, SHA256: test.sha256},
+			}
+			opts := ReaderOptions{Verifier: test.verifier, KubeClient: c, Namespace: "team-a"}
+
+			b, _, err := newTestReader(t, nil, channel, opts).Read()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error: %v, want error: %t", err, test.wantErr)
+			}
+			if test.wantReason != "" {
+				if se, ok := err.(*SignatureError); !ok || se.Reason != test.wantReason {
+					t.Errorf("got error: %v, want signature error with reason %s", err, test.wantReason)
+				}
+			}
+			if err != nil {
+				return
+			}
+			if len(b.Objects) != test.wantObjects {
+				t.Errorf("got %d objects, want %d", len(b.Objects), test.wantObjects)
+			}
+			if b.Digest != test.wantDigest {
+				t.Errorf("got digest: %s, want digest: %s", b.Digest, test.wantDigest)
+			}
+		})
+	}
+}
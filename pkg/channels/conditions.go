@@ -0,0 +1,90 @@
+package channels
+
+import (
+	"fmt"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SetConditions derives the Ready, Progressing, Degraded and Blocked conditions of a
+// single channel from its status and the error returned by Syncer.Sync. Channels waiting
+// for their dependencies are progressing, even if installed in an older version.
+func SetConditions(status *v1alpha1.OperatorChannelStatus, generation int64, err error) {
+	ready := v1alpha1.Condition{Type: v1alpha1.ConditionReady, Status: corev1.ConditionFalse, ObservedGeneration: generation, Reason: "NotInstalled"}
+	progress := v1alpha1.Condition{Type: v1alpha1.ConditionProgressing, Status: corev1.ConditionFalse, ObservedGeneration: generation, Reason: "Installed"}
+	degraded := v1alpha1.Condition{Type: v1alpha1.ConditionDegraded, Status: corev1.ConditionFalse, ObservedGeneration: generation, Reason: "NoFailures"}
+	blocked := v1alpha1.Condition{Type: v1alpha1.ConditionBlocked, Status: corev1.ConditionFalse, ObservedGeneration: generation, Reason: "NotBlocked"}
+
+	switch {
+	case IsBlocked(err):
+		be := err.(*BlockedError)
+		ready.Reason = "Blocked"
+		progress.Reason = "Blocked"
+		blocked.Status = corev1.ConditionTrue
+		blocked.Reason = be.Reason
+		blocked.Message = be.Message
+	case IsWaiting(err):
+		ready.Reason = "WaitingForDependencies"
+		progress.Status = corev1.ConditionTrue
+		progress.Reason = "WaitingForDependencies"
+		progress.Message = err.(*WaitingError).Message
+	case status.IsReady():
+		ready.Status = corev1.ConditionTrue
+		ready.Reason = "Installed"
+		ready.Message = fmt.Sprintf("Version %s installed", status.InstalledVersion)
+	case status.LastError != "":
+		ready.Reason = "ReconcileFailed"
+		degraded.Status = corev1.ConditionTrue
+		degraded.Reason = "ReconcileFailed"
+		degraded.Message = status.LastError
+		if IsIntegrityError(err) {
+			ready.Reason = "DigestMismatch"
+			degraded.Reason = "DigestMismatch"
+		}
+		if se, ok := err.(*SignatureError); ok {
+			ready.Reason = se.Reason
+			degraded.Reason = se.Reason
+		}
+		if IsScopeError(err) {
+			ready.Reason = "ObjectOutOfScope"
+			degraded.Reason = "ObjectOutOfScope"
+		}
+	default:
+		progress.Status = corev1.ConditionTrue
+		progress.Reason = "Installing"
+		progress.Message = fmt.Sprintf("Version %s not yet installed", status.DesiredVersion)
+	}
+
+	for _, c := range []v1alpha1.Condition{ready, progress, degraded, blocked} {
+		status.Conditions = v1alpha1.SetCondition(status.Conditions, c)
+	}
+}
+
+// setVerified records the outcome of verifying the channel's archive against its pinned digest and signature.
+func setVerified(status *v1alpha1.OperatorChannelStatus, generation int64, s corev1.ConditionStatus, reason, message string) {
+	status.Conditions = v1alpha1.SetCondition(status.Conditions, v1alpha1.Condition{
+		Type:               v1alpha1.ConditionVerified,
+		Status:             s,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setUpgradeAvailable records the newest version of the channel's index held back as it needs
+// an approval, if any.
+func setUpgradeAvailable(status *v1alpha1.OperatorChannelStatus, generation int64, heldBack string) {
+	c := v1alpha1.Condition{
+		Type:               v1alpha1.ConditionUpgradeAvailable,
+		Status:             corev1.ConditionFalse,
+		ObservedGeneration: generation,
+		Reason:             "NoUpgradeAvailable",
+	}
+	if heldBack != "" {
+		c.Status = corev1.ConditionTrue
+		c.Reason = "ApprovalRequired"
+		c.Message = fmt.Sprintf("version %s is available and requires approvedVersion: %s", heldBack, heldBack)
+	}
+	status.Conditions = v1alpha1.SetCondition(status.Conditions, c)
+}
@@ -0,0 +1,254 @@
+package channels
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// Constraint is a semver range a channel version must satisfy, e.g. "~1.2", "^1.2.3"
+// or ">=1.2.0 <2.0.0". Comparators separated by spaces must all match, ranges
+// separated by "||" are alternatives. Pre-release versions only satisfy constraints
+// mentioning a pre-release version themselves.
+type Constraint struct {
+	raw          string
+	alternatives [][]comparator
+	prerelease   bool
+}
+
+type comparator struct {
+	op string
+	v  *version.Version
+}
+
+// operators in the order they are matched against a comparator's prefix
+var operators = []string{">=", "<=", "!=", ">", "<", "=", "~", "^"}
+
+// ParseConstraint parses a semver range.
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{raw: s}
+	for _, alt := range strings.Split(s, "||") {
+		var comparators []comparator
+		fields := strings.Fields(alt)
+		for i := 0; i < len(fields); i++ {
+			f := fields[i]
+			// Allow a space between operator and version, e.g. ">= 1.2.0"
+			if isOperator(f) && i+1 < len(fields) {
+				i++
+				f += fields[i]
+			}
+			cs, err := parseComparator(f)
+			if err != nil {
+				return nil, fmt.Errorf("Error parsing constraint %q: %s", s, err)
+			}
+			for _, cmp := range cs {
+				if cmp.v.PreRelease() != "" {
+					c.prerelease = true
+				}
+			}
+			comparators = append(comparators, cs...)
+		}
+		if len(comparators) == 0 {
+			return nil, fmt.Errorf("Error parsing constraint %q: empty range", s)
+		}
+		c.alternatives = append(c.alternatives, comparators)
+	}
+	return c, nil
+}
+
+// Check reports whether v satisfies the constraint.
+func (c *Constraint) Check(v *version.Version) bool {
+	if v.PreRelease() != "" && !c.prerelease {
+		return false
+	}
+	for _, comparators := range c.alternatives {
+		ok := true
+		for _, cmp := range comparators {
+			if !cmp.check(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the constraint as written.
+func (c *Constraint) String() string {
+	return c.raw
+}
+
+func (cmp comparator) check(v *version.Version) bool {
+	r := 0
+	if v.LessThan(cmp.v) {
+		r = -1
+	} else if cmp.v.LessThan(v) {
+		r = 1
+	}
+	switch cmp.op {
+	case "=":
+		return r == 0
+	case "!=":
+		return r != 0
+	case ">":
+		return r > 0
+	case ">=":
+		return r >= 0
+	case "<":
+		return r < 0
+	case "<=":
+		return r <= 0
+	}
+	return false
+}
+
+func isOperator(s string) bool {
+	for _, op := range operators {
+		if s == op {
+			return true
+		}
+	}
+	return false
+}
+
+// parseComparator expands a single comparator into primitive ones, e.g. "~1.2" into ">=1.2.0 <1.3.0".
+func parseComparator(s string) ([]comparator, error) {
+	op := ""
+	for _, o := range operators {
+		if strings.HasPrefix(s, o) {
+			op = o
+			break
+		}
+	}
+	s = strings.TrimPrefix(strings.TrimPrefix(s, op), "v")
+
+	parts, full, err := parsePartial(s)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(parts)
+	at := func(major, minor, patch int) *version.Version {
+		return version.MustParseSemantic(fmt.Sprintf("%d.%d.%d", major, minor, patch))
+	}
+	fill := func() (int, int, int) {
+		p := append(append([]int{}, parts...), 0, 0, 0)
+		return p[0], p[1], p[2]
+	}
+	// next returns the lowest version above all versions matching the partial version
+	next := func() *version.Version {
+		switch n {
+		case 1:
+			return at(parts[0]+1, 0, 0)
+		case 2:
+			return at(parts[0], parts[1]+1, 0)
+		}
+		return at(parts[0], parts[1], parts[2]+1)
+	}
+	ge := func(v *version.Version) comparator { return comparator{op: ">=", v: v} }
+	lt := func(v *version.Version) comparator { return comparator{op: "<", v: v} }
+
+	if n == 0 {
+		// "*" or "x" match any version
+		if op != "" && op != "=" {
+			return nil, fmt.Errorf("wildcard not allowed with operator %q", op)
+		}
+		return []comparator{ge(at(0, 0, 0))}, nil
+	}
+
+	switch op {
+	case "", "=":
+		if full != nil {
+			return []comparator{{op: "=", v: full}}, nil
+		}
+		return []comparator{ge(at(fill())), lt(next())}, nil
+	case "!=":
+		if full == nil {
+			return nil, fmt.Errorf("partial version %q not allowed with operator %q", s, op)
+		}
+		return []comparator{{op: "!=", v: full}}, nil
+	case ">", "<=":
+		if full != nil {
+			return []comparator{{op: op, v: full}}, nil
+		}
+		if op == ">" {
+			return []comparator{ge(next())}, nil
+		}
+		return []comparator{lt(next())}, nil
+	case ">=", "<":
+		v := full
+		if v == nil {
+			v = at(fill())
+		}
+		return []comparator{{op: op, v: v}}, nil
+	case "~":
+		low := full
+		if low == nil {
+			low = at(fill())
+		}
+		if n == 1 {
+			return []comparator{ge(low), lt(at(parts[0]+1, 0, 0))}, nil
+		}
+		return []comparator{ge(low), lt(at(parts[0], parts[1]+1, 0))}, nil
+	case "^":
+		low := full
+		if low == nil {
+			low = at(fill())
+		}
+		major, minor, _ := fill()
+		switch {
+		case major > 0 || n == 1:
+			return []comparator{ge(low), lt(at(major+1, 0, 0))}, nil
+		case minor > 0 || n == 2:
+			return []comparator{ge(low), lt(at(0, minor+1, 0))}, nil
+		}
+		return []comparator{ge(low), lt(next())}, nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", op)
+}
+
+// parsePartial parses a possibly partial version like "1", "1.2", "1.2.x" or "1.2.3-rc.1".
+// It returns the given numeric components and, for complete versions, the version itself.
+func parsePartial(s string) ([]int, *version.Version, error) {
+	if s == "" {
+		return nil, nil, fmt.Errorf("missing version")
+	}
+
+	core := s
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		core = s[:i]
+	}
+
+	var parts []int
+	for _, p := range strings.Split(core, ".") {
+		if p == "x" || p == "X" || p == "*" {
+			break
+		}
+		i, err := strconv.Atoi(p)
+		if err != nil || i < 0 {
+			return nil, nil, fmt.Errorf("invalid version %q", s)
+		}
+		parts = append(parts, i)
+	}
+	if len(parts) > 3 {
+		return nil, nil, fmt.Errorf("invalid version %q", s)
+	}
+
+	if len(parts) < 3 {
+		if core != s {
+			return nil, nil, fmt.Errorf("pre-release or build metadata on partial version %q", s)
+		}
+		return parts, nil, nil
+	}
+
+	v, err := version.ParseSemantic(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parts, v, nil
+}
@@ -0,0 +1,120 @@
+package channels
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+func TestConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		want       map[string]bool
+		wantErr    bool
+	}{
+		{
+			constraint: "1.2.3",
+			want:       map[string]bool{"1.2.3": true, "1.2.4": false},
+		},
+		{
+			constraint: "1.2",
+			want:       map[string]bool{"1.2.0": true, "1.2.9": true, "1.3.0": false, "1.1.9": false},
+		},
+		{
+			constraint: "1.x",
+			want:       map[string]bool{"1.0.0": true, "1.9.9": true, "2.0.0": false},
+		},
+		{
+			constraint: "*",
+			want:       map[string]bool{"0.0.1": true, "10.0.0": true, "1.0.0-rc.1": false},
+		},
+		{
+			constraint: "~1.2",
+			want:       map[string]bool{"1.2.0": true, "1.2.7": true, "1.3.0": false},
+		},
+		{
+			constraint: "~1.2.3",
+			want:       map[string]bool{"1.2.2": false, "1.2.3": true, "1.2.9": true, "1.3.0": false},
+		},
+		{
+			constraint: "~1",
+			want:       map[string]bool{"1.0.0": true, "1.9.0": true, "2.0.0": false},
+		},
+		{
+			constraint: "^1.2.3",
+			want:       map[string]bool{"1.2.2": false, "1.2.3": true, "1.9.0": true, "2.0.0": false},
+		},
+		{
+			constraint: "^0.2.3",
+			want:       map[string]bool{"0.2.3": true, "0.2.9": true, "0.3.0": false},
+		},
+		{
+			constraint: "^0.0.3",
+			want:       map[string]bool{"0.0.3": true, "0.0.4": false},
+		},
+		{
+			constraint: ">=1.2.0 <2.0.0",
+			want:       map[string]bool{"1.1.9": false, "1.2.0": true, "1.99.0": true, "2.0.0": false, "2.0.0-beta.1": false},
+		},
+		{
+			constraint: ">= 1.2.0 < 2.0.0",
+			want:       map[string]bool{"1.2.0": true, "2.0.0": false},
+		},
+		{
+			constraint: ">1.2 <=2",
+			want:       map[string]bool{"1.2.9": false, "1.3.0": true, "2.9.9": true, "3.0.0": false},
+		},
+		{
+			constraint: "<1.0.0 || >=2.0.0 !=2.1.0",
+			want:       map[string]bool{"0.9.0": true, "1.0.0": false, "2.0.0": true, "2.1.0": false, "2.1.1": true},
+		},
+		{
+			constraint: ">=2.0.0-beta.1",
+			want:       map[string]bool{"2.0.0-alpha.1": false, "2.0.0-beta.2": true, "2.0.0": true},
+		},
+		{
+			constraint: "v1.2.3",
+			want:       map[string]bool{"1.2.3": true},
+		},
+		{
+			constraint: "",
+			wantErr:    true,
+		},
+		{
+			constraint: "~latest",
+			wantErr:    true,
+		},
+		{
+			constraint: "1.2-rc.1",
+			wantErr:    true,
+		},
+		{
+			constraint: "!=1.2",
+			wantErr:    true,
+		},
+		{
+			constraint: ">=1.0.0 ||",
+			wantErr:    true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.constraint, func(t *testing.T) {
+			c, err := ParseConstraint(test.constraint)
+			if test.wantErr {
+				if err == nil {
+					t.Error("Want error but got nothing")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got unexpected error: %s", err)
+			}
+			for v, want := range test.want {
+				if got := c.Check(version.MustParseSemantic(v)); got != want {
+					t.Errorf("got %s satisfies %q: %t, want: %t", v, test.constraint, got, want)
+				}
+			}
+		})
+	}
+}
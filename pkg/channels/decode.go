@@ -0,0 +1,126 @@
+package channels
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+// decodeBundle decodes the manifests of files into a bundle. All other files are recorded as
+// skipped, see filterManifests, and the bundle's MetadataFile is parsed into its metadata.
+func decodeBundle(files []manifestFile) (*Bundle, error) {
+	md, err := readMetadata(files)
+	if err != nil {
+		return nil, err
+	}
+	manifests, skipped, err := filterManifests(files)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := decodeFiles(manifests)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	for _, f := range files {
+		size += int64(len(f.data))
+	}
+	return &Bundle{Objects: objs, Skipped: skipped, Metadata: md, size: size}, nil
+}
+
+// decodeFiles decodes the objects of every file in order. Files may hold several YAML
+// documents separated by "---" or JSON, documents of a List kind are expanded into their
+// items and empty documents, e.g. holding comments only, are skipped.
+func decodeFiles(files []manifestFile) ([]runtime.Object, error) {
+	var objs []runtime.Object
+	for _, f := range files {
+		reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(f.data)))
+		for i := 1; ; i++ {
+			doc, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("Error reading %s: %s", f.name, err)
+			}
+			if isEmptyDocument(doc) {
+				continue
+			}
+
+			docObjs, err := decodeDocument(doc)
+			if err != nil {
+				return nil, fmt.Errorf("Error decoding document %d of %s: %s", i, f.name, err)
+			}
+			objs = append(objs, docObjs...)
+		}
+	}
+	return objs, nil
+}
+
+// decodeDocument decodes a single YAML or JSON document into its object or, for List kinds,
+// the objects of its items. Kinds unknown to the scheme, e.g. custom resources, are decoded
+// into unstructured objects.
+func decodeDocument(doc []byte) ([]runtime.Object, error) {
+	obj, err := runtime.Decode(scheme.Codecs.UniversalDeserializer(), doc)
+	if runtime.IsNotRegisteredError(err) {
+		obj, err = decodeUnstructured(doc)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !meta.IsListType(obj) {
+		return []runtime.Object{obj}, nil
+	}
+
+	items, err := meta.ExtractList(obj)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading list items: %s", err)
+	}
+	var objs []runtime.Object
+	for i, item := range items {
+		// Items of v1.List are kept raw by the deserializer
+		if u, ok := item.(*runtime.Unknown); ok {
+			itemObjs, err := decodeDocument(u.Raw)
+			if err != nil {
+				return nil, fmt.Errorf("Error decoding list item %d: %s", i, err)
+			}
+			objs = append(objs, itemObjs...)
+			continue
+		}
+		objs = append(objs, item)
+	}
+	return objs, nil
+}
+
+// decodeUnstructured decodes a YAML or JSON document into an unstructured object or list.
+func decodeUnstructured(doc []byte) (runtime.Object, error) {
+	data, err := yaml.YAMLToJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	obj, gvk, err := unstructured.UnstructuredJSONScheme.Decode(data, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if gvk.Version == "" {
+		return nil, fmt.Errorf("Object 'apiVersion' is missing in kind %s", gvk.Kind)
+	}
+	return obj, nil
+}
+
+// isEmptyDocument reports whether doc holds nothing but whitespace and comments.
+func isEmptyDocument(doc []byte) bool {
+	if len(bytes.TrimSpace(doc)) == 0 {
+		return true
+	}
+	data, err := yaml.YAMLToJSON(doc)
+	return err == nil && string(data) == "null"
+}
@@ -0,0 +1,166 @@
+package channels
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const testCRD = `apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  version: v1
+`
+
+const testCR = `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: a-widget
+spec:
+  size: 3
+`
+
+func names(t *testing.T, objs []runtime.Object) []string {
+	var names []string
+	for _, obj := range objs {
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, m.GetName())
+	}
+	return names
+}
+
+func TestDecodeFiles(t *testing.T) {
+	tests := []struct {
+		desc      string
+		data      string
+		wantNames []string
+		wantErr   string
+	}{
+		{
+			desc:      "single document",
+			data:      testServiceAccount,
+			wantNames: []string{"a-operator"},
+		},
+		{
+			desc:      "multiple documents",
+			data:      "---\n" + testServiceAccount + "---\n" + strings.Replace(testConfigMap, "a-operator", "a-config", 1) + "---\n",
+			wantNames: []string{"a-operator", "a-config"},
+		},
+		{
+			desc:      "json",
+			data:      `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a-config"}}`,
+			wantNames: []string{"a-config"},
+		},
+		{
+			desc:      "custom resource definition and custom resource",
+			data:      testCRD + "---\n" + testCR,
+			wantNames: []string{"widgets.example.com", "a-widget"},
+		},
+		{
+			desc:      "list of custom resources",
+			data:      "apiVersion: example.com/v1\nkind: WidgetList\nitems:\n- apiVersion: example.com/v1\n  kind: Widget\n  metadata:\n    name: a-widget\n- apiVersion: example.com/v1\n  kind: Widget\n  metadata:\n    name: b-widget\n",
+			wantNames: []string{"a-widget", "b-widget"},
+		},
+		{
+			desc:    "custom resource without apiVersion",
+			data:    "kind: Widget\nmetadata:\n  name: a-widget\n",
+			wantErr: "Error decoding document 1 of manifests.yaml",
+		},
+		{
+			desc: "empty and comment only documents",
+			data: "\n---\n# a comment\n---\n",
+		},
+		{
+			desc:    "broken second document",
+			data:    testServiceAccount + "---\nkind: [broken\n",
+			wantErr: "Error decoding document 2 of manifests.yaml",
+		},
+		{
+			desc:    "broken list item",
+			data:    "apiVersion: v1\nkind: List\nitems:\n- kind: Unknown\n",
+			wantErr: "Error decoding document 1 of manifests.yaml: Error decoding list item 0",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			objs, err := decodeFiles([]manifestFile{{name: "manifests.yaml", data: []byte(test.data)}})
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error: %v, want error containing: %s", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error: %v", err)
+			}
+			if got := names(t, objs); strings.Join(got, ",") != strings.Join(test.wantNames, ",") {
+				t.Errorf("got objects %v, want %v", got, test.wantNames)
+			}
+		})
+	}
+}
+
+func TestDecodeMultiDocumentArchive(t *testing.T) {
+	f, err := os.Open("./testdata/multidoc.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	files, err := untarGzip(f, ArchiveLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := decodeFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a-operator", "a-operator-config", "list-a", "list-b", "list-c", "a-operator-settings"}
+	if got := names(t, objs); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got objects %v, want %v", got, want)
+	}
+}
+
+func TestDecodeUnknownKinds(t *testing.T) {
+	objs, err := decodeFiles([]manifestFile{{name: "manifests.yaml", data: []byte(testServiceAccount + "---\n" + testCRD + "---\n" + testCR)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/v1, Kind=ServiceAccount", "apiextensions.k8s.io/v1beta1, Kind=CustomResourceDefinition", "example.com/v1, Kind=Widget"}
+	var got []string
+	for _, obj := range objs {
+		got = append(got, obj.GetObjectKind().GroupVersionKind().String())
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got kinds %v, want %v", got, want)
+	}
+
+	if _, ok := objs[0].(*corev1.ServiceAccount); !ok {
+		t.Errorf("got %T for a registered kind, want *v1.ServiceAccount", objs[0])
+	}
+	u, ok := objs[2].(*unstructured.Unstructured)
+	if !ok {
+		t.Fatalf("got %T for an unknown kind, want *unstructured.Unstructured", objs[2])
+	}
+	if size, _, _ := unstructured.NestedInt64(u.Object, "spec", "size"); size != 3 {
+		t.Errorf("got spec.size %d, want 3", size)
+	}
+}
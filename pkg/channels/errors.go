@@ -0,0 +1,95 @@
+package channels
+
+import (
+	"fmt"
+)
+
+// BlockedError reports a version change refused by nop-operator until a human approves it.
+// It is not worth a retry, the channel stays blocked until its spec changes.
+type BlockedError struct {
+	// Reason is a CamelCase reason suitable for a status condition
+	Reason  string
+	Message string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("Channel blocked: %s", e.Message)
+}
+
+// IsBlocked reports whether err is a BlockedError.
+func IsBlocked(err error) bool {
+	_, ok := err.(*BlockedError)
+	return ok
+}
+
+// IntegrityError reports an archive not matching the digest pinned for its channel. It is
+// not worth a retry, the same URL is expected to deliver the same bytes again.
+type IntegrityError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("Error verifying archive: digest %s does not match pinned digest %s", e.Actual, e.Expected)
+}
+
+// IsIntegrityError reports whether err is an IntegrityError.
+func IsIntegrityError(err error) bool {
+	_, ok := err.(*IntegrityError)
+	return ok
+}
+
+// SignatureError reports an archive without a detached signature or with one not made by
+// the channel's public key. It is not worth a retry, like an IntegrityError.
+type SignatureError struct {
+	// Reason is a CamelCase reason suitable for a status condition
+	Reason  string
+	Message string
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("Error verifying archive signature: %s", e.Message)
+}
+
+// IsSignatureError reports whether err is a SignatureError.
+func IsSignatureError(err error) bool {
+	_, ok := err.(*SignatureError)
+	return ok
+}
+
+// ScopeError reports a bundle with objects outside of the namespace its channel may install
+// to. It is not worth a retry, the same bundle holds the same objects again.
+type ScopeError struct {
+	Message string
+}
+
+func (e *ScopeError) Error() string {
+	return fmt.Sprintf("Error applying bundle: %s", e.Message)
+}
+
+// IsScopeError reports whether err is a ScopeError.
+func IsScopeError(err error) bool {
+	_, ok := err.(*ScopeError)
+	return ok
+}
+
+// WaitingError reports a channel not installed until the channels it depends on are ready.
+// It is worth a retry once they are.
+type WaitingError struct {
+	Message string
+}
+
+func (e *WaitingError) Error() string {
+	return fmt.Sprintf("Channel waiting: %s", e.Message)
+}
+
+// IsWaiting reports whether err is a WaitingError.
+func IsWaiting(err error) bool {
+	_, ok := err.(*WaitingError)
+	return ok
+}
+
+// IsPermanent reports whether err is not worth a retry until the channel's spec changes.
+func IsPermanent(err error) bool {
+	return IsBlocked(err) || IsIntegrityError(err) || IsSignatureError(err) || IsScopeError(err)
+}
@@ -0,0 +1,106 @@
+package channels
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/logr"
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+)
+
+// fileReader reads channels from the local filesystem, either an archive or a directory of
+// manifests. It is meant for local development and must be registered explicitly, e.g.
+// RegisterReader("file", NewFileReader), as it exposes the operator's filesystem to channels.
+type fileReader struct {
+	log     logr.Logger
+	channel v1alpha1.OperatorChannel
+	opts    ReaderOptions
+}
+
+// NewFileReader is the ReaderFactory for file:// URLs.
+func NewFileReader(_ *http.Client, log logr.Logger, channel v1alpha1.OperatorChannel, opts ReaderOptions) ChannelReader {
+	return &fileReader{log: log, channel: channel, opts: opts}
+}
+
+// Read decodes the archive or the directory of manifests at the channel's path. The digest of
+// a directory is the digest of all files below it concatenated in lexical order. Signatures
+// of archives are read from the archive's path suffixed with ".sig".
+func (fr *fileReader) Read() (*Bundle, bool, error) {
+	oc := fr.channel
+
+	u, err := url.Parse(oc.URL)
+	if err != nil || u.Path == "" {
+		return nil, false, fmt.Errorf("Error reading channel %s: invalid file url %q", oc.Name, oc.URL)
+	}
+	path := filepath.FromSlash(u.Path)
+
+	fr.log.Info("Reading manifests from file", "Operator.Name", oc.Name, "Path", path)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error reading channel %s: %s", oc.Name, err)
+	}
+
+	var content []byte
+	if info.IsDir() {
+		err = filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return err
+			}
+			data, err := ioutil.ReadFile(p)
+			content = append(content, data...)
+			return err
+		})
+	} else {
+		content, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("Error reading channel %s: %s", oc.Name, err)
+	}
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	if oc.SHA256 != "" {
+		if pinned := normalizeDigest(oc.SHA256); pinned != digest {
+			return nil, false, &IntegrityError{Expected: pinned, Actual: digest}
+		}
+	}
+
+	if fr.opts.Verifier != nil {
+		if info.IsDir() {
+			return nil, false, &SignatureError{Reason: "SignatureUnsupported", Message: "signatures are not supported for directories"}
+		}
+		sig, err := ioutil.ReadFile(path + ".sig")
+		if err != nil {
+			return nil, false, &SignatureError{Reason: "SignatureMissing", Message: fmt.Sprintf("no signature found at %s.sig", path)}
+		}
+		if err := fr.opts.Verifier.Verify(content, sig); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if info.IsDir() {
+		b, err := decodeManifests(path)
+		if err != nil {
+			return nil, false, err
+		}
+		b.Digest = digest
+		return b, false, nil
+	}
+
+	files, err := untarGzip(bytes.NewReader(content), ArchiveLimits)
+	if err != nil {
+		return nil, false, err
+	}
+	b, err := decodeBundle(files)
+	if err != nil {
+		return nil, false, err
+	}
+	b.Digest = digest
+	return b, false, nil
+}
@@ -0,0 +1,134 @@
+package channels
+
+import (
+	"crypto/elliptic"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+func TestReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file-channel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifests := filepath.Join(dir, "manifests")
+	if err := os.Mkdir(manifests, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(manifests, "sa.yaml"): testServiceAccount,
+		filepath.Join(manifests, "cm.yaml"): testConfigMap,
+	}
+	archive, err := ioutil.ReadFile("./testdata/valid.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, pub := newTestKey(t, elliptic.P256())
+	files[filepath.Join(dir, "signed.tar.gz")] = string(archive)
+	files[filepath.Join(dir, "signed.tar.gz.sig")] = string(sign(t, key, archive))
+	files[filepath.Join(dir, "unsigned.tar.gz")] = string(archive)
+	for name, content := range files {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	v, err := NewVerifier(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc        string
+		path        string
+		sha256      string
+		verifier    *Verifier
+		wantObjects int
+		wantDigest  string
+		wantErr     bool
+		// wantReason is the reason of an expected SignatureError
+		wantReason string
+	}{
+		{
+			desc:        "directory",
+			path:        manifests,
+			wantObjects: 2,
+			wantDigest:  digestOf([]byte(testConfigMap + testServiceAccount)),
+		},
+		{
+			desc:        "archive",
+			path:        filepath.Join(dir, "unsigned.tar.gz"),
+			sha256:      "3d1f4684dcc7de0f74b5ebf4778a2278ad46de7b215591cb6dde145af7e16aa2",
+			wantObjects: 2,
+			wantDigest:  "sha256:3d1f4684dcc7de0f74b5ebf4778a2278ad46de7b215591cb6dde145af7e16aa2",
+		},
+		{
+			desc:    "pinned digest mismatch",
+			path:    filepath.Join(dir, "unsigned.tar.gz"),
+			sha256:  "b38a711fe0723d4e330ebec004cf15afe1e73c973cac85775f6f7697e9aa44b6",
+			wantErr: true,
+		},
+		{
+			desc:    "missing file",
+			path:    filepath.Join(dir, "missing.tar.gz"),
+			wantErr: true,
+		},
+		{
+			desc:        "signed archive",
+			path:        filepath.Join(dir, "signed.tar.gz"),
+			verifier:    v,
+			wantObjects: 2,
+			wantDigest:  "sha256:3d1f4684dcc7de0f74b5ebf4778a2278ad46de7b215591cb6dde145af7e16aa2",
+		},
+		{
+			desc:       "unsigned archive",
+			path:       filepath.Join(dir, "unsigned.tar.gz"),
+			verifier:   v,
+			wantErr:    true,
+			wantReason: "SignatureMissing",
+		},
+		{
+			desc:       "signed directory",
+			path:       manifests,
+			verifier:   v,
+			wantErr:    true,
+			wantReason: "SignatureUnsupported",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			channel := v1alpha1.OperatorChannel{
+				Name:        "a-operator",
+				ChannelSpec: v1alpha1.ChannelSpec{URL: "file://" + filepath.ToSlash(test.path), Version: "0.0.1", SHA256: test.sha256},
+			}
+			opts := ReaderOptions{Verifier: test.verifier}
+
+			b, _, err := NewFileReader(nil, logf.Log, channel, opts).Read()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error: %v, want error: %t", err, test.wantErr)
+			}
+			if test.wantReason != "" {
+				if se, ok := err.(*SignatureError); !ok || se.Reason != test.wantReason {
+					t.Errorf("got error: %v, want signature error with reason %s", err, test.wantReason)
+				}
+			}
+			if err != nil {
+				return
+			}
+			if len(b.Objects) != test.wantObjects {
+				t.Errorf("got %d objects, want %d", len(b.Objects), test.wantObjects)
+			}
+			if b.Digest != test.wantDigest {
+				t.Errorf("got digest: %s, want digest: %s", b.Digest, test.wantDigest)
+			}
+		})
+	}
+}
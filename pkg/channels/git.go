@@ -0,0 +1,418 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/go-logr/logr"
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+)
+
+// GitCacheDir holds a bare mirror per git repository channels are read from. Mirrors are
+// fetched again on every read, thus only objects new to the mirror are transferred.
+var GitCacheDir = filepath.Join(os.TempDir(), "nop-operator", "git")
+
+// CleanGitCache removes the TLS settings left behind in GitCacheDir by an operator killed
+// while running git, see writeTLS.
+func CleanGitCache() error {
+	dirs, err := filepath.Glob(filepath.Join(GitCacheDir, "tls-*"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("Error cleaning git cache dir: %s", err)
+		}
+	}
+	return nil
+}
+
+// gitLocks serializes access to the mirror of a repository shared by channels.
+var gitLocks = struct {
+	sync.Mutex
+	m map[string]*sync.Mutex
+}{m: map[string]*sync.Mutex{}}
+
+func lockMirror(dir string) func() {
+	gitLocks.Lock()
+	l, ok := gitLocks.m[dir]
+	if !ok {
+		l = &sync.Mutex{}
+		gitLocks.m[dir] = l
+	}
+	gitLocks.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// gitReader reads channels from a directory of a git repository using the git binary.
+type gitReader struct {
+	log     logr.Logger
+	channel v1alpha1.OperatorChannel
+	opts    ReaderOptions
+	// local allows repositories on the operator's filesystem
+	local bool
+	// tls is the configuration pointing git at the files written by writeTLS
+	tls [][2]string
+}
+
+func newGitReader(_ *http.Client, log logr.Logger, channel v1alpha1.OperatorChannel, opts ReaderOptions) ChannelReader {
+	return &gitReader{log: log, channel: channel, opts: opts}
+}
+
+// NewLocalGitReader is the ReaderFactory for git+file:// URLs and git sources with a local
+// path as repo. Like NewFileReader it is meant for local development and must be registered
+// explicitly, e.g. RegisterReader("git+file", NewLocalGitReader).
+func NewLocalGitReader(_ *http.Client, log logr.Logger, channel v1alpha1.OperatorChannel, opts ReaderOptions) ChannelReader {
+	return &gitReader{log: log, channel: channel, opts: opts, local: true}
+}
+
+// isLocalRepo reports whether repo is a repository on the operator's filesystem, i.e. a
+// file:// URL or a path, rather than a URL or an scp-like address such as host:team/repo.git.
+func isLocalRepo(repo string) bool {
+	if i := strings.Index(repo, "://"); i >= 0 {
+		return strings.ToLower(repo[:i]) == "file"
+	}
+	// Like git, a colon before the first slash makes an scp-like address
+	colon := strings.Index(repo, ":")
+	slash := strings.Index(repo, "/")
+	return colon < 0 || slash >= 0 && slash < colon
+}
+
+// gitSource returns the git source of channel, either its source block or its URL of the
+// form git+<transport>://<repository>?ref=<ref>&subdir=<subdir>.
+func gitSource(channel v1alpha1.OperatorChannel) (*v1alpha1.GitSource, error) {
+	if channel.Source != nil && channel.Source.Git != nil {
+		return channel.Source.Git, nil
+	}
+
+	rawurl := channel.URL
+	if strings.HasPrefix(strings.ToLower(rawurl), "git+") {
+		rawurl = rawurl[len("git+"):]
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing git url of channel %s: %s", channel.Name, err)
+	}
+
+	q := u.Query()
+	src := &v1alpha1.GitSource{Ref: q.Get("ref"), Subdir: q.Get("subdir")}
+	q.Del("ref")
+	q.Del("subdir")
+	u.RawQuery = q.Encode()
+	src.Repo = u.String()
+	return src, nil
+}
+
+// Read fetches the channel's repository into its mirror, resolves the ref to a commit and
+// decodes the manifests below the channel's subdirectory at that commit.
+func (gr *gitReader) Read() (*Bundle, bool, error) {
+	oc := gr.channel
+	src, err := gitSource(oc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if oc.SHA256 != "" {
+		return nil, false, fmt.Errorf("Error reading channel %s: digests can not be pinned for git sources, pin a commit as ref instead", oc.Name)
+	}
+	if gr.opts.Verifier != nil {
+		return nil, false, &SignatureError{Reason: "SignatureUnsupported", Message: "signatures are not supported for git sources"}
+	}
+	if src.Repo == "" {
+		return nil, false, fmt.Errorf("Error reading channel %s: missing git repository", oc.Name)
+	}
+	if isLocalRepo(src.Repo) && !gr.local {
+		return nil, false, fmt.Errorf("Error reading channel %s: local git repositories are not enabled", oc.Name)
+	}
+
+	ref := src.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if strings.HasPrefix(ref, "-") || strings.HasPrefix(src.Repo, "-") {
+		return nil, false, fmt.Errorf("Error reading channel %s: invalid git repository or ref", oc.Name)
+	}
+
+	gr.log.Info("Fetching manifests from git", "Operator.Name", oc.Name, "Repo", src.Repo, "Ref", ref)
+
+	if err := os.MkdirAll(GitCacheDir, 0700); err != nil {
+		return nil, true, fmt.Errorf("Error creating git cache dir: %s", err)
+	}
+	tlsDir, err := gr.writeTLS(src.Repo)
+	if err != nil {
+		return nil, false, err
+	}
+	if tlsDir != "" {
+		defer os.RemoveAll(tlsDir)
+	}
+
+	dir := filepath.Join(GitCacheDir, fmt.Sprintf("%x", sha256.Sum256([]byte(src.Repo))))
+	unlock := lockMirror(dir)
+	defer unlock()
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if _, err := gr.git("", "clone", "--mirror", "--quiet", "--", src.Repo, dir); err != nil {
+			os.RemoveAll(dir)
+			return nil, false, fmt.Errorf("Error cloning %s: %s", src.Repo, err)
+		}
+	} else if _, err := gr.git(dir, "fetch", "--prune", "--force", "--quiet", "--", src.Repo, "+refs/*:refs/*"); err != nil {
+		return nil, false, fmt.Errorf("Error fetching %s: %s", src.Repo, err)
+	}
+
+	out, err := gr.git(dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return nil, false, fmt.Errorf("Error resolving ref %s of %s: %s", ref, src.Repo, err)
+	}
+	commit := strings.TrimSpace(string(out))
+
+	treeish := commit
+	if subdir := strings.Trim(src.Subdir, "/"); subdir != "" {
+		treeish = fmt.Sprintf("%s:%s", commit, subdir)
+	}
+	files, err := gr.archive(dir, treeish)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error reading %s of %s: %s", treeish, src.Repo, err)
+	}
+
+	b, err := decodeBundle(files)
+	if err != nil {
+		return nil, false, err
+	}
+	b.Commit = commit
+	return b, false, nil
+}
+
+// systemRootFiles are the locations of the system's CA bundle on common distributions.
+var systemRootFiles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// writeTLS writes the CA bundle and the client certificate of the channel's TLS settings to a
+// directory of their own below GitCacheDir for git to read them, and returns the directory
+// which has to be removed once git is done. Channels without a CA of their own trust the
+// system roots and CABundles, like NewHTTPClient. The settings are scoped to the repository's
+// host, like the channel's request headers. Repositories not served over https can not use a
+// CA or client certificate of their own, they are refused.
+func (gr *gitReader) writeTLS(repo string) (string, error) {
+	gr.tls = nil
+	spec := gr.channel.TLS
+	if spec == nil {
+		spec = &v1alpha1.TLSSpec{}
+	}
+
+	u, err := url.Parse(repo)
+	if err != nil || u.Scheme != "https" {
+		if spec.CA != nil || spec.ClientCertSecretRef != nil {
+			return "", fmt.Errorf("Error reading channel %s: tls.ca and tls.clientCertSecretRef are only supported for https git repositories", gr.channel.Name)
+		}
+		return "", nil
+	}
+
+	ctx := context.TODO()
+	files := map[string][]byte{}
+	switch {
+	case spec.CA != nil:
+		ca, err := loadKey(ctx, gr.opts.KubeClient, gr.opts.Namespace, *spec.CA)
+		if err != nil {
+			return "", err
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(ca) {
+			return "", fmt.Errorf("Error parsing CA bundle of channel %s: no certificates found", gr.channel.Name)
+		}
+		files["sslCAInfo"] = ca
+	case len(CABundles) > 0:
+		var ca []byte
+		for _, f := range systemRootFiles {
+			if data, err := ioutil.ReadFile(f); err == nil {
+				ca = append(data, '\n')
+				break
+			}
+		}
+		for _, bundle := range CABundles {
+			ca = append(append(ca, bundle...), '\n')
+		}
+		files["sslCAInfo"] = ca
+	}
+	if spec.ClientCertSecretRef != nil {
+		cert, key, err := loadClientCert(ctx, gr.opts.KubeClient, gr.opts.Namespace, spec.ClientCertSecretRef.Name)
+		if err != nil {
+			return "", err
+		}
+		files["sslCert"] = cert
+		files["sslKey"] = key
+	}
+	if len(files) == 0 {
+		return "", nil
+	}
+
+	dir, err := ioutil.TempDir(GitCacheDir, "tls-")
+	if err != nil {
+		return "", fmt.Errorf("Error creating directory for TLS settings of git: %s", err)
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name+".pem")
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("Error writing TLS settings of git: %s", err)
+		}
+		gr.tls = append(gr.tls, [2]string{fmt.Sprintf("http.%s://%s.%s", u.Scheme, u.Host, name), path})
+	}
+	return dir, nil
+}
+
+// git runs git with args in dir and returns its output.
+func (gr *gitReader) git(dir string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), FetchTimeout)
+	defer cancel()
+
+	cmd := gr.command(ctx, dir, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	stop := killOnDone(ctx, cmd)
+	err := cmd.Wait()
+	stop()
+	if err != nil {
+		return nil, gitError(ctx, err, stderr)
+	}
+	return stdout.Bytes(), nil
+}
+
+// killOnDone kills the process group of the started cmd once ctx is done, until the returned
+// func is called. git leaves transfers to helpers like git-remote-https, killing git alone
+// would leave them waiting on the server, holding the output of git open.
+func killOnDone(ctx context.Context, cmd *exec.Cmd) func() {
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-stopped:
+		}
+	}()
+	return func() { close(stopped) }
+}
+
+// gitError describes the failure err of a git command run with ctx and the output on stderr.
+func gitError(ctx context.Context, err error, stderr bytes.Buffer) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("git timed out after %s", FetchTimeout)
+	}
+	return fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+}
+
+// archive unpacks treeish of the mirror in dir. The output of git archive is streamed
+// through the unpacked size limit of ArchiveLimits rather than read into memory as a whole.
+func (gr *gitReader) archive(dir, treeish string) ([]manifestFile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), FetchTimeout)
+	defer cancel()
+
+	cmd := gr.command(ctx, dir, "archive", "--format=tar", treeish)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	defer killOnDone(ctx, cmd)()
+
+	out := &limitedReader{
+		r:   stdout,
+		n:   ArchiveLimits.MaxUnpackedSize,
+		err: fmt.Errorf("unpacked archive exceeds %d bytes", ArchiveLimits.MaxUnpackedSize),
+	}
+	files, err := untar(out, ArchiveLimits)
+	if err == nil {
+		// Drain the padding after the end of the archive for git to exit
+		_, err = io.Copy(ioutil.Discard, out)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, gitError(ctx, err, stderr)
+		}
+		return nil, err
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, gitError(ctx, err, stderr)
+	}
+	return files, nil
+}
+
+// command returns the git command running args in dir, in a process group of its own that is
+// killed once ctx is done, see killOnDone. The channel's request headers, e.g. credentials, are
+// passed as configuration in the environment of git only, thus they never end up in the
+// mirror's config nor in the process list. They are scoped to the repository's host, thus not
+// sent on redirects to other hosts. Transports are restricted to the network ones, plus file
+// for readers of local repositories.
+func (gr *gitReader) command(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	var config [][2]string
+	if key := gr.extraHeaderKey(); key != "" {
+		for k, vs := range gr.opts.Header {
+			for _, v := range vs {
+				config = append(config, [2]string{key, fmt.Sprintf("%s: %s", k, v)})
+			}
+		}
+	}
+	config = append(config, gr.tls...)
+	if tls := gr.channel.TLS; tls != nil && tls.InsecureSkipTLSVerify {
+		config = append(config, [2]string{"http.sslVerify", "false"})
+	}
+
+	protocols := "https:http:ssh"
+	if gr.local {
+		protocols += ":file"
+	}
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ALLOW_PROTOCOL="+protocols)
+	env = append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(config)))
+	for i, c := range config {
+		env = append(env, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, c[0]), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, c[1]))
+	}
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+// extraHeaderKey returns the configuration key of the request headers for the channel's
+// repository, e.g. http.https://git.example.com.extraHeader, empty if the repository is
+// not served over HTTP on the channel's AuthHost.
+func (gr *gitReader) extraHeaderKey() string {
+	src, err := gitSource(gr.channel)
+	if err != nil || headerFor(src.Repo, gr.opts.AuthHost, gr.opts.Header) == nil {
+		return ""
+	}
+	u, err := url.Parse(src.Repo)
+	if err != nil || u.Scheme != "https" && u.Scheme != "http" {
+		return ""
+	}
+	return fmt.Sprintf("http.%s://%s.extraHeader", u.Scheme, u.Host)
+}
@@ -0,0 +1,331 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+const testServiceAccount = `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: a-operator
+  namespace: default
+`
+
+const testConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a-operator
+  namespace: default
+`
+
+// gitRepo is a local git repository for tests, pushed to a bare repository after each commit.
+type gitRepo struct {
+	t    *testing.T
+	work string
+	bare string
+}
+
+func newGitRepo(t *testing.T) *gitRepo {
+	dir, err := ioutil.TempDir("", "git-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &gitRepo{t: t, work: filepath.Join(dir, "work"), bare: filepath.Join(dir, "bare.git")}
+	r.run("", "init", "--quiet", "--bare", r.bare)
+	r.run("", "init", "--quiet", r.work)
+	return r
+}
+
+func (r *gitRepo) run(dir string, args ...string) string {
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "init.defaultBranch=master"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit writes files to the work tree, commits and pushes them and returns the commit.
+func (r *gitRepo) commit(files map[string]string) string {
+	for name, content := range files {
+		path := filepath.Join(r.work, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			r.t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	r.run(r.work, "add", "--all")
+	r.run(r.work, "commit", "--quiet", "-m", "update")
+	r.run(r.work, "push", "--quiet", "--tags", r.bare, "HEAD:refs/heads/master")
+	return r.run(r.work, "rev-parse", "HEAD")
+}
+
+func TestReadGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	cache, err := ioutil.TempDir("", "git-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+	GitCacheDir = cache
+
+	repo := newGitRepo(t)
+	defer os.RemoveAll(filepath.Dir(repo.bare))
+
+	// Repositories on the filesystem are read once local git repositories are enabled
+	channel := v1alpha1.OperatorChannel{
+		Name:        "a-operator",
+		ChannelSpec: v1alpha1.ChannelSpec{Source: &v1alpha1.SourceSpec{Git: &v1alpha1.GitSource{Repo: repo.bare}}},
+	}
+	if _, err := NewChannelReader(nil, logf.Log, channel, ReaderOptions{}); err == nil {
+		t.Fatalf("got no error reading local repository %s without a git+file reader", repo.bare)
+	}
+	if _, _, err := newGitReader(nil, logf.Log, channel, ReaderOptions{}).Read(); err == nil {
+		t.Fatalf("got no error reading local repository %s with the git reader for remotes", repo.bare)
+	}
+	RegisterReader("git+file", NewLocalGitReader)
+	defer func() {
+		readers.Lock()
+		delete(readers.factories, "git+file")
+		readers.Unlock()
+	}()
+
+	first := repo.commit(map[string]string{"deploy/sa.yaml": testServiceAccount})
+	repo.run(repo.work, "tag", "v1.0.0")
+	repo.run(repo.work, "push", "--quiet", repo.bare, "v1.0.0")
+	second := repo.commit(map[string]string{"deploy/cm.yaml": testConfigMap})
+
+	read := func(src *v1alpha1.GitSource) (*Bundle, error) {
+		channel := v1alpha1.OperatorChannel{
+			Name:        "a-operator",
+			ChannelSpec: v1alpha1.ChannelSpec{Source: &v1alpha1.SourceSpec{Git: src}},
+		}
+		b, _, err := newTestReader(t, nil, channel, ReaderOptions{}).Read()
+		return b, err
+	}
+
+	tests := []struct {
+		desc        string
+		src         v1alpha1.GitSource
+		wantCommit  string
+		wantObjects int
+		wantErr     bool
+	}{
+		{desc: "default branch", src: v1alpha1.GitSource{Subdir: "deploy"}, wantCommit: second, wantObjects: 2},
+		{desc: "branch", src: v1alpha1.GitSource{Ref: "master", Subdir: "/deploy/"}, wantCommit: second, wantObjects: 2},
+		{desc: "tag", src: v1alpha1.GitSource{Ref: "v1.0.0", Subdir: "deploy"}, wantCommit: first, wantObjects: 1},
+		{desc: "commit", src: v1alpha1.GitSource{Ref: first, Subdir: "deploy"}, wantCommit: first, wantObjects: 1},
+		{desc: "repository root", src: v1alpha1.GitSource{Ref: first}, wantCommit: first, wantObjects: 1},
+		{desc: "unknown ref", src: v1alpha1.GitSource{Ref: "v2.0.0"}, wantErr: true},
+		{desc: "unknown subdir", src: v1alpha1.GitSource{Subdir: "missing"}, wantErr: true},
+		{desc: "option as ref", src: v1alpha1.GitSource{Ref: "--help"}, wantErr: true},
+	}
+	for _, test := range tests {
+		src := test.src
+		src.Repo = repo.bare
+		b, err := read(&src)
+		if (err != nil) != test.wantErr {
+			t.Fatalf("%s: got error: %v, want error: %t", test.desc, err, test.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		if b.Commit != test.wantCommit {
+			t.Errorf("%s: got commit: %s, want commit: %s", test.desc, b.Commit, test.wantCommit)
+		}
+		if len(b.Objects) != test.wantObjects {
+			t.Errorf("%s: got %d objects, want %d", test.desc, len(b.Objects), test.wantObjects)
+		}
+	}
+
+	// New commits are fetched into the cached mirror
+	third := repo.commit(map[string]string{"deploy/other/sa.yaml": strings.Replace(testServiceAccount, "a-operator", "b-operator", 1)})
+	b, err := read(&v1alpha1.GitSource{Repo: repo.bare, Subdir: "deploy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Commit != third || len(b.Objects) != 3 {
+		t.Errorf("got commit %s with %d objects, want commit %s with 3 objects", b.Commit, len(b.Objects), third)
+	}
+
+	// The output of git archive is bounded like archives
+	limits := ArchiveLimits
+	defer func() { ArchiveLimits = limits }()
+	ArchiveLimits.MaxUnpackedSize = 1024
+	if _, err := read(&v1alpha1.GitSource{Repo: repo.bare, Subdir: "deploy"}); err == nil || !strings.Contains(err.Error(), "exceeds 1024 bytes") {
+		t.Errorf("got error %v, want unpacked size limit exceeded", err)
+	}
+}
+
+func TestIsLocalRepo(t *testing.T) {
+	tests := []struct {
+		repo string
+		want bool
+	}{
+		{repo: "https://git.example.com/team/a-operator.git"},
+		{repo: "ssh://git@git.example.com/team/a-operator.git"},
+		{repo: "git@git.example.com:team/a-operator.git"},
+		{repo: "FILE:///srv/git/a-operator.git", want: true},
+		{repo: "/srv/git/a-operator.git", want: true},
+		{repo: "../a-operator.git", want: true},
+		{repo: "./a:b.git", want: true},
+		{repo: "a-operator.git", want: true},
+	}
+	for _, test := range tests {
+		if got := isLocalRepo(test.repo); got != test.want {
+			t.Errorf("%s: got local %t, want %t", test.repo, got, test.want)
+		}
+	}
+}
+
+func TestGitCommandCredentials(t *testing.T) {
+	gr := &gitReader{
+		channel: v1alpha1.OperatorChannel{Name: "a-operator", ChannelSpec: v1alpha1.ChannelSpec{URL: "git+https://git.example.com/team/a-operator.git"}},
+		opts:    ReaderOptions{Header: http.Header{"Authorization": {"Bearer secret"}}, AuthHost: "git.example.com"},
+	}
+	cmd := gr.command(context.TODO(), "", "fetch")
+	for _, arg := range cmd.Args {
+		if strings.Contains(arg, "secret") {
+			t.Errorf("got credentials on the command line: %v", cmd.Args)
+		}
+	}
+
+	env := strings.Join(cmd.Env, "\n")
+	for _, want := range []string{"GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.https://git.example.com.extraHeader", "GIT_CONFIG_VALUE_0=Authorization: Bearer secret", "GIT_ALLOW_PROTOCOL=https:http:ssh\n"} {
+		if !strings.Contains(env+"\n", want) {
+			t.Errorf("got environment without %q", want)
+		}
+	}
+}
+
+func TestGitTLS(t *testing.T) {
+	cache, err := ioutil.TempDir("", "git-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+	GitCacheDir = cache
+	defer func(bundles [][]byte) { CABundles = bundles }(CABundles)
+
+	certPEM, keyPEM := newTestCert(t)
+	c := fake.NewFakeClientWithScheme(scheme.Scheme,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "repo-ca", Namespace: "team-a"},
+			Data:       map[string][]byte{"ca.crt": certPEM},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "repo-client", Namespace: "team-a"},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM},
+		},
+	)
+	ca := &v1alpha1.KeySource{
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "repo-ca"},
+			Key:                  "ca.crt",
+		},
+	}
+	clientCert := &corev1.LocalObjectReference{Name: "repo-client"}
+
+	tests := []struct {
+		desc      string
+		repo      string
+		tls       *v1alpha1.TLSSpec
+		bundles   [][]byte
+		wantFiles map[string][]byte
+		wantErr   bool
+	}{
+		{
+			desc: "no tls settings",
+			repo: "https://git.example.com/team/a-operator.git",
+		},
+		{
+			desc:      "operator ca bundles",
+			repo:      "https://git.example.com/team/a-operator.git",
+			bundles:   [][]byte{[]byte("operator-ca")},
+			wantFiles: map[string][]byte{"sslCAInfo": []byte("operator-ca")},
+		},
+		{
+			desc:      "channel ca and client certificate",
+			repo:      "https://git.example.com/team/a-operator.git",
+			tls:       &v1alpha1.TLSSpec{CA: ca, ClientCertSecretRef: clientCert},
+			bundles:   [][]byte{[]byte("operator-ca")},
+			wantFiles: map[string][]byte{"sslCAInfo": certPEM, "sslCert": certPEM, "sslKey": keyPEM},
+		},
+		{
+			desc: "operator ca bundles not used for ssh",
+			repo: "ssh://git.example.com/team/a-operator.git",
+		},
+		{
+			desc:    "channel ca for ssh",
+			repo:    "git@git.example.com:team/a-operator.git",
+			tls:     &v1alpha1.TLSSpec{CA: ca},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			CABundles = test.bundles
+			gr := &gitReader{
+				channel: v1alpha1.OperatorChannel{Name: "a-operator", ChannelSpec: v1alpha1.ChannelSpec{
+					Source: &v1alpha1.SourceSpec{Git: &v1alpha1.GitSource{Repo: test.repo}},
+					TLS:    test.tls,
+				}},
+				opts: ReaderOptions{KubeClient: c, Namespace: "team-a"},
+			}
+			dir, err := gr.writeTLS(test.repo)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error: %v, want error: %t", err, test.wantErr)
+			}
+			if dir != "" {
+				defer os.RemoveAll(dir)
+			}
+			if (dir != "") != (len(test.wantFiles) > 0) {
+				t.Fatalf("got TLS dir %q, want files %v", dir, test.wantFiles)
+			}
+
+			env := strings.Join(gr.command(context.TODO(), "", "fetch").Env, "\n") + "\n"
+			for name, want := range test.wantFiles {
+				path := filepath.Join(dir, name+".pem")
+				if !strings.Contains(env, "=http.https://git.example.com."+name+"\n") || !strings.Contains(env, "="+path+"\n") {
+					t.Errorf("got environment without %s set to %s", name, path)
+				}
+				got, err := ioutil.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Contains(got, want) {
+					t.Errorf("got %s without %q", name, want)
+				}
+			}
+		})
+	}
+
+	CleanGitCache()
+	if dirs, _ := filepath.Glob(filepath.Join(cache, "tls-*")); len(dirs) != 0 {
+		t.Errorf("got TLS dirs left behind: %v", dirs)
+	}
+}
@@ -0,0 +1,50 @@
+package channels
+
+import (
+	"fmt"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// checkVersion refuses to install the channel's version if it does not satisfy the channel's
+// constraint, or if it is a major upgrade or a downgrade of the installed version not approved
+// via ApprovedVersion. Versions that are not semantic versions are not guarded.
+func checkVersion(channel v1alpha1.OperatorChannel, installed string) error {
+	desired, err := version.ParseSemantic(channel.Version)
+	if err != nil {
+		return nil
+	}
+
+	if channel.Constraint != "" {
+		c, err := ParseConstraint(channel.Constraint)
+		if err != nil {
+			return &BlockedError{Reason: "InvalidConstraint", Message: err.Error()}
+		}
+		if !c.Check(desired) {
+			return &BlockedError{
+				Reason:  "ConstraintNotSatisfied",
+				Message: fmt.Sprintf("version %s does not satisfy constraint %q", channel.Version, c),
+			}
+		}
+	}
+
+	current, err := version.ParseSemantic(installed)
+	if err != nil || channel.ApprovedVersion == channel.Version {
+		return nil
+	}
+
+	switch {
+	case desired.LessThan(current):
+		return &BlockedError{
+			Reason:  "Downgrade",
+			Message: fmt.Sprintf("downgrade from %s to %s requires approvedVersion: %s", installed, channel.Version, channel.Version),
+		}
+	case desired.Major() > current.Major():
+		return &BlockedError{
+			Reason:  "MajorUpgrade",
+			Message: fmt.Sprintf("major upgrade from %s to %s requires approvedVersion: %s", installed, channel.Version, channel.Version),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package channels
+
+import (
+	"testing"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+)
+
+func TestCheckVersion(t *testing.T) {
+	tests := []struct {
+		desc       string
+		channel    v1alpha1.ChannelSpec
+		installed  string
+		wantReason string
+	}{
+		{
+			desc:    "first install",
+			channel: v1alpha1.ChannelSpec{Version: "2.0.0"},
+		},
+		{
+			desc:      "minor upgrade",
+			channel:   v1alpha1.ChannelSpec{Version: "1.3.0"},
+			installed: "1.2.3",
+		},
+		{
+			desc:       "major upgrade",
+			channel:    v1alpha1.ChannelSpec{Version: "2.0.0"},
+			installed:  "1.2.3",
+			wantReason: "MajorUpgrade",
+		},
+		{
+			desc:      "approved major upgrade",
+			channel:   v1alpha1.ChannelSpec{Version: "2.0.0", ApprovedVersion: "2.0.0"},
+			installed: "1.2.3",
+		},
+		{
+			desc:       "major upgrade approved for another version",
+			channel:    v1alpha1.ChannelSpec{Version: "3.0.0", ApprovedVersion: "2.0.0"},
+			installed:  "2.0.0",
+			wantReason: "MajorUpgrade",
+		},
+		{
+			desc:       "downgrade",
+			channel:    v1alpha1.ChannelSpec{Version: "1.2.2"},
+			installed:  "1.2.3",
+			wantReason: "Downgrade",
+		},
+		{
+			desc:      "approved downgrade",
+			channel:   v1alpha1.ChannelSpec{Version: "1.2.2", ApprovedVersion: "1.2.2"},
+			installed: "1.2.3",
+		},
+		{
+			desc:       "constraint not satisfied",
+			channel:    v1alpha1.ChannelSpec{Version: "1.3.0", Constraint: "~1.2"},
+			installed:  "1.2.3",
+			wantReason: "ConstraintNotSatisfied",
+		},
+		{
+			desc:       "constraint not satisfied on approved version",
+			channel:    v1alpha1.ChannelSpec{Version: "2.0.0", Constraint: "^1.2", ApprovedVersion: "2.0.0"},
+			installed:  "1.2.3",
+			wantReason: "ConstraintNotSatisfied",
+		},
+		{
+			desc:       "invalid constraint",
+			channel:    v1alpha1.ChannelSpec{Version: "1.2.3", Constraint: "~one"},
+			wantReason: "InvalidConstraint",
+		},
+		{
+			desc:      "non semantic versions",
+			channel:   v1alpha1.ChannelSpec{Version: "latest"},
+			installed: "1.2.3",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			err := checkVersion(v1alpha1.OperatorChannel{Name: "a-operator", ChannelSpec: test.channel}, test.installed)
+			var got string
+			if be, ok := err.(*BlockedError); ok {
+				got = be.Reason
+			} else if err != nil {
+				t.Fatalf("got unexpected error: %s", err)
+			}
+			if got != test.wantReason {
+				t.Errorf("got reason: %q, want reason: %q", got, test.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package channels
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// IgnoreFile in the root of a bundle lists patterns of files to skip, one per line.
+const IgnoreFile = ".nopignore"
+
+// manifestExtensions are the extensions of files decoded as manifests, other files of a
+// bundle are skipped.
+var manifestExtensions = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// ignorePattern is a line of an IgnoreFile.
+type ignorePattern struct {
+	pattern string
+	// anchored patterns match paths relative to the bundle root, others base names at any depth
+	anchored bool
+	// dirOnly patterns match directories only
+	dirOnly bool
+}
+
+// filterManifests returns the manifests of files and the paths of all other files. Files
+// matching a pattern of the bundle's IgnoreFile are skipped as well, the IgnoreFile and
+// MetadataFile themselves are neither. The bundle root is the
+// root of files or, if all files are below a single directory, that directory.
+func filterManifests(files []manifestFile) ([]manifestFile, []string, error) {
+	root := bundleRoot(files)
+
+	var patterns []ignorePattern
+	for _, f := range files {
+		if f.name == path.Join(root, IgnoreFile) {
+			p, err := parseIgnoreFile(f.data)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Error reading %s: %s", f.name, err)
+			}
+			patterns = p
+		}
+	}
+
+	var manifests []manifestFile
+	var skipped []string
+	for _, f := range files {
+		if f.name == path.Join(root, IgnoreFile) || f.name == path.Join(root, MetadataFile) {
+			continue
+		}
+		rel := strings.TrimPrefix(f.name, root+"/")
+		if !manifestExtensions[strings.ToLower(path.Ext(f.name))] || ignored(patterns, rel) {
+			skipped = append(skipped, f.name)
+			continue
+		}
+		manifests = append(manifests, f)
+	}
+	return manifests, skipped, nil
+}
+
+// bundleRoot returns the single top-level directory all files are placed in, if any.
+func bundleRoot(files []manifestFile) string {
+	root := ""
+	for _, f := range files {
+		i := strings.Index(f.name, "/")
+		if i < 0 {
+			return ""
+		}
+		if root != "" && f.name[:i] != root {
+			return ""
+		}
+		root = f.name[:i]
+	}
+	return root
+}
+
+// parseIgnoreFile parses the patterns of an IgnoreFile. Blank lines and lines starting with
+// "#" are skipped. Patterns follow path.Match, a trailing "/" restricts a pattern to
+// directories and patterns containing any other "/" are relative to the bundle root.
+func parseIgnoreFile(data []byte) ([]ignorePattern, error) {
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			return nil, fmt.Errorf("negated pattern %q not supported", line)
+		}
+
+		p := ignorePattern{}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		p.anchored = strings.Contains(line, "/")
+		p.pattern = strings.TrimPrefix(line, "/")
+		if _, err := path.Match(p.pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", line, err)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, scanner.Err()
+}
+
+// ignored reports whether the file at the slash separated path rel, relative to the bundle
+// root, or any of its parent directories matches one of patterns.
+func ignored(patterns []ignorePattern, rel string) bool {
+	elems := strings.Split(rel, "/")
+	for _, p := range patterns {
+		for i := range elems {
+			// The last element is the file itself
+			if p.dirOnly && i == len(elems)-1 {
+				break
+			}
+			name := elems[i]
+			if p.anchored {
+				name = strings.Join(elems[:i+1], "/")
+			}
+			if ok, _ := path.Match(p.pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
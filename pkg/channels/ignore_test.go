@@ -0,0 +1,109 @@
+package channels
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFilterManifests(t *testing.T) {
+	tests := []struct {
+		desc          string
+		files         map[string]string
+		wantManifests []string
+		wantSkipped   []string
+		wantErr       bool
+	}{
+		{
+			desc:          "manifest extensions",
+			files:         map[string]string{"sa.yaml": "", "cm.YML": "", "role.json": "", "README.md": "", ".DS_Store": "", "LICENSE": ""},
+			wantManifests: []string{"cm.YML", "role.json", "sa.yaml"},
+			wantSkipped:   []string{".DS_Store", "LICENSE", "README.md"},
+		},
+		{
+			desc: "ignore file in root",
+			files: map[string]string{
+				".nopignore":            "# comment\n\ntest/\n*.sample.yaml\n/deploy/crds\n",
+				"sa.yaml":               "",
+				"test/e2e.yaml":         "",
+				"deploy/test/a.yaml":    "",
+				"deploy/cm.yaml":        "",
+				"deploy/cm.sample.yaml": "",
+				"deploy/crds/crd.yaml":  "",
+				"crds/crd.yaml":         "",
+			},
+			wantManifests: []string{"crds/crd.yaml", "deploy/cm.yaml", "sa.yaml"},
+			wantSkipped:   []string{"deploy/cm.sample.yaml", "deploy/crds/crd.yaml", "deploy/test/a.yaml", "test/e2e.yaml"},
+		},
+		{
+			desc: "ignore file in single top-level directory",
+			files: map[string]string{
+				"a-operator/.nopignore":   "sa.yaml\n",
+				"a-operator/sa.yaml":      "",
+				"a-operator/cm.yaml":      "",
+				"a-operator/x/.nopignore": "cm.yaml\n",
+			},
+			wantManifests: []string{"a-operator/cm.yaml"},
+			wantSkipped:   []string{"a-operator/sa.yaml", "a-operator/x/.nopignore"},
+		},
+		{
+			desc:    "negated pattern",
+			files:   map[string]string{".nopignore": "!sa.yaml\n"},
+			wantErr: true,
+		},
+		{
+			desc:    "invalid pattern",
+			files:   map[string]string{".nopignore": "[\n"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			files := map[string][]byte{}
+			for name, data := range test.files {
+				files[name] = []byte(data)
+			}
+
+			manifests, skipped, err := filterManifests(sortedFiles(files))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error: %v, want error: %t", err, test.wantErr)
+			}
+			var names []string
+			for _, f := range manifests {
+				names = append(names, f.name)
+			}
+			if strings.Join(names, ",") != strings.Join(test.wantManifests, ",") {
+				t.Errorf("got manifests %v, want %v", names, test.wantManifests)
+			}
+			if strings.Join(skipped, ",") != strings.Join(test.wantSkipped, ",") {
+				t.Errorf("got skipped files %v, want %v", skipped, test.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestDecodeBundleWithExtras(t *testing.T) {
+	f, err := os.Open("./testdata/extras.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	files, err := untarGzip(f, ArchiveLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := decodeBundle(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := names(t, b.Objects); strings.Join(got, ",") != "a-operator" {
+		t.Errorf("got objects %v, want [a-operator]", got)
+	}
+	wantSkipped := []string{"a-operator/.DS_Store", "a-operator/LICENSE", "a-operator/README.md", "a-operator/deploy/cm.sample.yaml", "a-operator/examples/cm.yaml"}
+	if strings.Join(b.Skipped, ",") != strings.Join(wantSkipped, ",") {
+		t.Errorf("got skipped files %v, want %v", b.Skipped, wantSkipped)
+	}
+}
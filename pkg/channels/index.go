@@ -0,0 +1,208 @@
+package channels
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultChannel is the channel of an index followed if none is given.
+const DefaultChannel = "stable"
+
+// DefaultPollInterval is the interval channels resolved through an index are polled for new versions.
+const DefaultPollInterval = 10 * time.Minute
+
+// maxIndexSize bounds the size of an index read from a server.
+const maxIndexSize = 4 << 20
+
+// Index lists the released versions of an operator per channel, e.g.:
+//
+//   name: a-operator
+//   channels:
+//     stable:
+//     - version: 1.2.3
+//       url: a-operator-1.2.3.tar.gz
+//       digest: sha256:3d1f4684dcc7de0f74b5ebf4778a2278ad46de7b215591cb6dde145af7e16aa2
+//       released: 2019-10-01T00:00:00Z
+//
+// Relative archive URLs are resolved against the URL of the index.
+type Index struct {
+	Name     string                  `json:"name,omitempty"`
+	Channels map[string][]IndexEntry `json:"channels"`
+}
+
+// IndexEntry is a single released version of an operator
+type IndexEntry struct {
+	Version  string       `json:"version"`
+	URL      string       `json:"url"`
+	Digest   string       `json:"digest,omitempty"`
+	Released *metav1.Time `json:"released,omitempty"`
+}
+
+// ParseIndex decodes an index document. Archive URLs are resolved against base.
+func ParseIndex(data []byte, base *url.URL) (*Index, error) {
+	idx := &Index{}
+	if err := yaml.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("Error decoding channel index: %s", err)
+	}
+
+	for name, entries := range idx.Channels {
+		for i, e := range entries {
+			if _, err := version.ParseSemantic(e.Version); err != nil {
+				return nil, fmt.Errorf("Error parsing version %q of channel %s: %s", e.Version, name, err)
+			}
+			u, err := url.Parse(e.URL)
+			if err != nil || e.URL == "" {
+				return nil, fmt.Errorf("Error parsing url %q of %s in channel %s", e.URL, e.Version, name)
+			}
+			if base != nil {
+				u = base.ResolveReference(u)
+			}
+			entries[i].URL = u.String()
+		}
+	}
+	return idx, nil
+}
+
+// FetchIndex downloads and decodes the index at rawurl.
+func FetchIndex(client *http.Client, rawurl string, header http.Header) (*Index, error) {
+	base, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing channel index url: %s", err)
+	}
+
+	resp, err := get(client, rawurl, header)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching channel index: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Error response status code %d", resp.StatusCode)
+	}
+
+	data, err := readAll(resp.Body, maxIndexSize, "channel index")
+	if err != nil {
+		return nil, fmt.Errorf("Error reading channel index: %s", err)
+	}
+	return ParseIndex(data, base)
+}
+
+// Resolve returns the entry of the given channel in the requested version, or the
+// latest version of the channel satisfying the constraint c, if any, and accepted by
+// accept, if given, if v is empty.
+func (idx *Index) Resolve(channel, v string, c *Constraint, accept func(v string) bool) (*IndexEntry, error) {
+	entries, ok := idx.Channels[channel]
+	if !ok || len(entries) == 0 {
+		return nil, fmt.Errorf("Error resolving channel %s: no such channel in index", channel)
+	}
+
+	var latest *IndexEntry
+	var latestVersion *version.Version
+	for i := range entries {
+		e := &entries[i]
+		ev := version.MustParseSemantic(e.Version)
+		if v != "" {
+			if e.Version == v {
+				return e, nil
+			}
+			continue
+		}
+		if c != nil && !c.Check(ev) || accept != nil && !accept(e.Version) {
+			continue
+		}
+		if latest == nil || latestVersion.LessThan(ev) {
+			latest, latestVersion = e, ev
+		}
+	}
+
+	if latest == nil && v != "" {
+		return nil, fmt.Errorf("Error resolving channel %s: version %s not found in index", channel, v)
+	}
+	if latest == nil && accept != nil {
+		return nil, fmt.Errorf("Error resolving channel %s: no version accepted", channel)
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("Error resolving channel %s: no version satisfies constraint %q", channel, c)
+	}
+	return latest, nil
+}
+
+// ResolveChannel returns the channel with its archive URL, version and digest looked up in
+// its index. A digest pinned on the channel takes precedence over the one of the index.
+// Channels following the latest version of their index are resolved to the latest version
+// checkVersion accepts in place of installed, i.e. they stay on the installed major version
+// until a newer one is approved. The newest version held back this way is returned along
+// with the channel, if any. Without an accepted version the channel is resolved to the
+// latest version, for checkVersion to explain why it is refused. Channels without an index
+// are returned unchanged.
+func ResolveChannel(client *http.Client, channel v1alpha1.OperatorChannel, installed string, header http.Header) (v1alpha1.OperatorChannel, string, error) {
+	if channel.Source != nil {
+		return channel, "", nil
+	}
+	if channel.Index == "" {
+		if channel.URL == "" {
+			return channel, "", fmt.Errorf("Error resolving channel %s: neither url nor index given", channel.Name)
+		}
+		return channel, "", nil
+	}
+
+	idx, err := FetchIndex(client, channel.Index, header)
+	if err != nil {
+		return channel, "", err
+	}
+
+	name := channel.Channel
+	if name == "" {
+		name = DefaultChannel
+	}
+	var c *Constraint
+	if channel.Constraint != "" {
+		if c, err = ParseConstraint(channel.Constraint); err != nil {
+			return channel, "", err
+		}
+	}
+
+	e, err := idx.Resolve(name, channel.Version, c, nil)
+	if err != nil {
+		return channel, "", err
+	}
+
+	var heldBack string
+	if channel.Version == "" {
+		accept := func(v string) bool {
+			candidate := channel
+			candidate.Version = v
+			return checkVersion(candidate, installed) == nil
+		}
+		if accepted, err := idx.Resolve(name, "", c, accept); err == nil && accepted != e {
+			heldBack = e.Version
+			e = accepted
+		}
+	}
+
+	channel.URL = e.URL
+	channel.Version = e.Version
+	if channel.SHA256 == "" {
+		channel.SHA256 = e.Digest
+	}
+	return channel, heldBack, nil
+}
+
+// PollInterval returns the interval the channel should be reconciled again to pick up
+// new versions, zero for channels not resolved through an index.
+func PollInterval(channel v1alpha1.ChannelSpec) time.Duration {
+	if channel.Index == "" {
+		return 0
+	}
+	if channel.PollInterval != nil && channel.PollInterval.Duration > 0 {
+		return channel.PollInterval.Duration
+	}
+	return DefaultPollInterval
+}
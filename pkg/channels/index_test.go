@@ -0,0 +1,206 @@
+package channels
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolveChannel(t *testing.T) {
+	ts := newTestHttpServer(http.StatusOK, "./testdata/index.yaml")
+	defer ts.Close()
+
+	tests := []struct {
+		desc         string
+		channel      v1alpha1.ChannelSpec
+		installed    string
+		wantURL      string
+		wantVersion  string
+		wantSHA256   string
+		wantHeldBack string
+		wantErr      bool
+	}{
+		{
+			desc:        "channel without index",
+			channel:     v1alpha1.ChannelSpec{URL: "https://example.com/a-operator.tar.gz", Version: "1.0.0"},
+			wantURL:     "https://example.com/a-operator.tar.gz",
+			wantVersion: "1.0.0",
+		},
+		{
+			desc:    "channel without url and index",
+			channel: v1alpha1.ChannelSpec{Version: "1.0.0"},
+			wantErr: true,
+		},
+		{
+			desc:        "latest version of default channel",
+			channel:     v1alpha1.ChannelSpec{Index: ts.URL + "/channels/index.yaml"},
+			wantURL:     ts.URL + "/channels/a-operator-2.1.0.tar.gz",
+			wantVersion: "2.1.0",
+		},
+		{
+			desc:         "latest version of installed major",
+			channel:      v1alpha1.ChannelSpec{Index: ts.URL + "/index.yaml"},
+			installed:    "1.2.3",
+			wantURL:      ts.URL + "/a-operator-1.10.0.tar.gz",
+			wantVersion:  "1.10.0",
+			wantHeldBack: "2.1.0",
+		},
+		{
+			desc:        "approved major upgrade",
+			channel:     v1alpha1.ChannelSpec{Index: ts.URL + "/index.yaml", ApprovedVersion: "2.1.0"},
+			installed:   "1.10.0",
+			wantURL:     ts.URL + "/a-operator-2.1.0.tar.gz",
+			wantVersion: "2.1.0",
+		},
+		{
+			// Refused by the guard as a downgrade
+			desc:        "no version accepted",
+			channel:     v1alpha1.ChannelSpec{Index: ts.URL + "/index.yaml"},
+			installed:   "3.0.0",
+			wantURL:     ts.URL + "/a-operator-2.1.0.tar.gz",
+			wantVersion: "2.1.0",
+		},
+		{
+			desc:        "pinned version",
+			channel:     v1alpha1.ChannelSpec{Index: ts.URL + "/channels/index.yaml", Channel: "stable", Version: "1.9.1"},
+			wantURL:     "https://mirror.example.com/a-operator-1.9.1.tar.gz",
+			wantVersion: "1.9.1",
+		},
+		{
+			desc:        "digest taken from index",
+			channel:     v1alpha1.ChannelSpec{Index: ts.URL + "/index.yaml", Version: "1.2.3"},
+			wantURL:     ts.URL + "/a-operator-1.2.3.tar.gz",
+			wantVersion: "1.2.3",
+			wantSHA256:  "sha256:3d1f4684dcc7de0f74b5ebf4778a2278ad46de7b215591cb6dde145af7e16aa2",
+		},
+		{
+			desc:        "digest pinned on channel",
+			channel:     v1alpha1.ChannelSpec{Index: ts.URL + "/index.yaml", Version: "1.2.3", SHA256: "b38a711fe0723d4e330ebec004cf15afe1e73c973cac85775f6f7697e9aa44b6"},
+			wantURL:     ts.URL + "/a-operator-1.2.3.tar.gz",
+			wantVersion: "1.2.3",
+			wantSHA256:  "b38a711fe0723d4e330ebec004cf15afe1e73c973cac85775f6f7697e9aa44b6",
+		},
+		{
+			desc:        "latest version satisfying constraint",
+			channel:     v1alpha1.ChannelSpec{Index: ts.URL + "/index.yaml", Constraint: "~1.9"},
+			wantURL:     "https://mirror.example.com/a-operator-1.9.1.tar.gz",
+			wantVersion: "1.9.1",
+		},
+		{
+			desc:    "no version satisfying constraint",
+			channel: v1alpha1.ChannelSpec{Index: ts.URL + "/index.yaml", Constraint: ">=3.0.0"},
+			wantErr: true,
+		},
+		{
+			desc:        "latest version of beta channel",
+			channel:     v1alpha1.ChannelSpec{Index: ts.URL + "/index.yaml", Channel: "beta"},
+			wantURL:     ts.URL + "/a-operator-2.0.0-beta.1.tar.gz",
+			wantVersion: "2.0.0-beta.1",
+		},
+		{
+			desc:    "unknown version",
+			channel: v1alpha1.ChannelSpec{Index: ts.URL + "/index.yaml", Version: "0.1.0"},
+			wantErr: true,
+		},
+		{
+			desc:    "unknown channel",
+			channel: v1alpha1.ChannelSpec{Index: ts.URL + "/index.yaml", Channel: "alpha"},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			got, heldBack, err := ResolveChannel(ts.Client(), v1alpha1.OperatorChannel{Name: "a-operator", ChannelSpec: test.channel}, test.installed, nil)
+			if test.wantErr {
+				if err == nil {
+					t.Error("Want error but got nothing")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got unexpected error: %s", err)
+			}
+			if got.URL != test.wantURL || got.Version != test.wantVersion {
+				t.Errorf("got %s in %s, want %s in %s", got.URL, got.Version, test.wantURL, test.wantVersion)
+			}
+			if got.SHA256 != test.wantSHA256 {
+				t.Errorf("got sha256: %s, want sha256: %s", got.SHA256, test.wantSHA256)
+			}
+			if heldBack != test.wantHeldBack {
+				t.Errorf("got held back version %q, want %q", heldBack, test.wantHeldBack)
+			}
+		})
+	}
+}
+
+func TestParseIndex(t *testing.T) {
+	tests := []struct {
+		desc    string
+		data    string
+		wantErr bool
+	}{
+		{
+			desc: "valid index",
+			data: "channels:\n  stable:\n  - version: 1.0.0\n    url: https://example.com/a.tar.gz\n",
+		},
+		{
+			desc:    "invalid version",
+			data:    "channels:\n  stable:\n  - version: latest\n    url: https://example.com/a.tar.gz\n",
+			wantErr: true,
+		},
+		{
+			desc:    "missing url",
+			data:    "channels:\n  stable:\n  - version: 1.0.0\n",
+			wantErr: true,
+		},
+		{
+			desc:    "malformed document",
+			data:    "channels: [",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := ParseIndex([]byte(test.data), nil)
+			if test.wantErr != (err != nil) {
+				t.Errorf("got err: %v, want err: %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestPollInterval(t *testing.T) {
+	tests := []struct {
+		desc    string
+		channel v1alpha1.ChannelSpec
+		want    time.Duration
+	}{
+		{
+			desc:    "channel without index",
+			channel: v1alpha1.ChannelSpec{URL: "https://example.com/a.tar.gz"},
+		},
+		{
+			desc:    "default interval",
+			channel: v1alpha1.ChannelSpec{Index: "https://example.com/index.yaml"},
+			want:    DefaultPollInterval,
+		},
+		{
+			desc:    "custom interval",
+			channel: v1alpha1.ChannelSpec{Index: "https://example.com/index.yaml", PollInterval: &metav1.Duration{Duration: time.Minute}},
+			want:    time.Minute,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			if got := PollInterval(test.channel); got != test.want {
+				t.Errorf("got poll interval: %s, want poll interval: %s", got, test.want)
+			}
+		})
+	}
+}
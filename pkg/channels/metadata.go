@@ -0,0 +1,179 @@
+package channels
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	versioninfo "k8s.io/apimachinery/pkg/version"
+	"sigs.k8s.io/yaml"
+)
+
+// MetadataFile in the root of a bundle describes the bundle, see v1alpha1.BundleMetadata.
+const MetadataFile = "bundle.yaml"
+
+// ClusterInfo reports the cluster's version and API groups to check bundle requirements
+// against. It is implemented by the discovery client.
+type ClusterInfo interface {
+	ServerVersion() (*versioninfo.Info, error)
+	ServerGroups() (*metav1.APIGroupList, error)
+}
+
+// parseMetadata parses and validates the content of a MetadataFile. Unknown fields are
+// refused to surface typos.
+func parseMetadata(data []byte) (*v1alpha1.BundleMetadata, error) {
+	md := &v1alpha1.BundleMetadata{}
+	if err := yaml.UnmarshalStrict(data, md); err != nil {
+		return nil, fmt.Errorf("Error decoding %s: %s", MetadataFile, err)
+	}
+
+	if md.Name == "" {
+		return nil, fmt.Errorf("Error reading %s: missing name", MetadataFile)
+	}
+	if md.Version != "" {
+		if _, err := version.ParseSemantic(strings.TrimPrefix(md.Version, "v")); err != nil {
+			return nil, fmt.Errorf("Error reading %s: invalid version %q: %s", MetadataFile, md.Version, err)
+		}
+	}
+	for _, v := range []string{md.MinKubeVersion, md.MaxKubeVersion} {
+		if v == "" {
+			continue
+		}
+		if _, _, err := parsePartial(strings.TrimPrefix(v, "v")); err != nil {
+			return nil, fmt.Errorf("Error reading %s: invalid Kubernetes version %q: %s", MetadataFile, v, err)
+		}
+	}
+	for _, g := range md.RequiredAPIGroups {
+		if g == "" || strings.Count(g, "/") > 1 {
+			return nil, fmt.Errorf("Error reading %s: invalid API group %q", MetadataFile, g)
+		}
+	}
+	if err := checkDependencies(md.Dependencies); err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", MetadataFile, err)
+	}
+	return md, nil
+}
+
+// checkDependencies refuses dependencies without a name or with an invalid constraint.
+func checkDependencies(deps []v1alpha1.Dependency) error {
+	for _, d := range deps {
+		if d.Name == "" {
+			return fmt.Errorf("dependency without name")
+		}
+		if d.Constraint == "" {
+			continue
+		}
+		if _, err := ParseConstraint(d.Constraint); err != nil {
+			return fmt.Errorf("invalid constraint of dependency %s: %s", d.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkMetadata refuses bundles describing another operator or version than the channel
+// they were read from. Versions are compared as semantic versions, ignoring a leading "v".
+func checkMetadata(md *v1alpha1.BundleMetadata, channel v1alpha1.OperatorChannel) error {
+	if md.Name != channel.Name {
+		return &BlockedError{
+			Reason:  "BundleMismatch",
+			Message: fmt.Sprintf("bundle of operator %s read from channel %s", md.Name, channel.Name),
+		}
+	}
+	if md.Version == "" || channel.Version == "" {
+		return nil
+	}
+
+	if !sameVersion(md.Version, channel.Version) {
+		return &BlockedError{
+			Reason:  "BundleMismatch",
+			Message: fmt.Sprintf("bundle of version %s read for version %s", md.Version, channel.Version),
+		}
+	}
+	return nil
+}
+
+// sameVersion reports whether a and b are equal semantic versions, versions not parsing as
+// such have to be equal strings.
+func sameVersion(a, b string) bool {
+	va, errA := version.ParseSemantic(strings.TrimPrefix(a, "v"))
+	vb, errB := version.ParseSemantic(strings.TrimPrefix(b, "v"))
+	if errA != nil || errB != nil {
+		return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+	}
+	return va.String() == vb.String()
+}
+
+// readMetadata parses the MetadataFile in the root of files, if any.
+func readMetadata(files []manifestFile) (*v1alpha1.BundleMetadata, error) {
+	name := path.Join(bundleRoot(files), MetadataFile)
+	for _, f := range files {
+		if f.name == name {
+			return parseMetadata(f.data)
+		}
+	}
+	return nil, nil
+}
+
+// checkRequirements checks the Kubernetes version and API groups required by md against the
+// cluster. Pre-releases and build metadata of the cluster's version are ignored.
+func checkRequirements(md *v1alpha1.BundleMetadata, cluster ClusterInfo) error {
+	if md.MinKubeVersion == "" && md.MaxKubeVersion == "" && len(md.RequiredAPIGroups) == 0 {
+		return nil
+	}
+	if cluster == nil {
+		return fmt.Errorf("Error checking requirements of bundle %s: no discovery client", md.Name)
+	}
+
+	if md.MinKubeVersion != "" || md.MaxKubeVersion != "" {
+		info, err := cluster.ServerVersion()
+		if err != nil {
+			return fmt.Errorf("Error reading Kubernetes version: %s", err)
+		}
+		v, err := version.ParseGeneric(info.GitVersion)
+		if err != nil {
+			return fmt.Errorf("Error parsing Kubernetes version %q: %s", info.GitVersion, err)
+		}
+		v = version.MustParseSemantic(fmt.Sprintf("%d.%d.%d", v.Major(), v.Minor(), v.Patch()))
+
+		for _, r := range []struct{ op, v string }{{">=", md.MinKubeVersion}, {"<=", md.MaxKubeVersion}} {
+			if r.v == "" {
+				continue
+			}
+			c, err := ParseConstraint(r.op + strings.TrimPrefix(r.v, "v"))
+			if err != nil {
+				return err
+			}
+			if !c.Check(v) {
+				return fmt.Errorf("Error checking requirements of bundle %s: Kubernetes version %s does not satisfy %s", md.Name, v, c)
+			}
+		}
+	}
+
+	if len(md.RequiredAPIGroups) > 0 {
+		groups, err := cluster.ServerGroups()
+		if err != nil {
+			return fmt.Errorf("Error reading API groups: %s", err)
+		}
+		served := map[string]bool{}
+		for _, g := range groups.Groups {
+			served[g.Name] = true
+			for _, v := range g.Versions {
+				served[v.GroupVersion] = true
+			}
+		}
+
+		var missing []string
+		for _, g := range md.RequiredAPIGroups {
+			if !served[g] {
+				missing = append(missing, g)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("Error checking requirements of bundle %s: API groups not served: %s", md.Name, strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package channels
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	versioninfo "k8s.io/apimachinery/pkg/version"
+)
+
+// fakeCluster serves a Kubernetes version and API groups to check bundle requirements against.
+type fakeCluster struct {
+	version string
+	groups  []string
+}
+
+func (c *fakeCluster) ServerVersion() (*versioninfo.Info, error) {
+	return &versioninfo.Info{GitVersion: c.version}, nil
+}
+
+func (c *fakeCluster) ServerGroups() (*metav1.APIGroupList, error) {
+	list := &metav1.APIGroupList{}
+	for _, gv := range c.groups {
+		parts := strings.SplitN(gv, "/", 2)
+		list.Groups = append(list.Groups, metav1.APIGroup{
+			Name:     parts[0],
+			Versions: []metav1.GroupVersionForDiscovery{{GroupVersion: gv, Version: parts[1]}},
+		})
+	}
+	return list, nil
+}
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		desc    string
+		data    string
+		want    *v1alpha1.BundleMetadata
+		wantErr bool
+	}{
+		{
+			desc: "all fields",
+			data: "name: a-operator\nversion: v1.2.0\ndescription: Installs widgets\nminKubeVersion: \"1.14\"\nmaxKubeVersion: v1.16.2\nrequiredAPIGroups:\n- cert-manager.io\n- apps/v1\n",
+			want: &v1alpha1.BundleMetadata{
+				Name:              "a-operator",
+				Version:           "v1.2.0",
+				Description:       "Installs widgets",
+				MinKubeVersion:    "1.14",
+				MaxKubeVersion:    "v1.16.2",
+				RequiredAPIGroups: []string{"cert-manager.io", "apps/v1"},
+			},
+		},
+		{
+			desc: "name only",
+			data: "name: a-operator\n",
+			want: &v1alpha1.BundleMetadata{Name: "a-operator"},
+		},
+		{desc: "missing name", data: "version: 1.0.0\n", wantErr: true},
+		{desc: "unknown field", data: "name: a-operator\nminKubernetesVersion: \"1.14\"\n", wantErr: true},
+		{desc: "invalid version", data: "name: a-operator\nversion: latest\n", wantErr: true},
+		{desc: "invalid Kubernetes version", data: "name: a-operator\nminKubeVersion: one\n", wantErr: true},
+		{desc: "invalid API group", data: "name: a-operator\nrequiredAPIGroups:\n- apps/v1/deployments\n", wantErr: true},
+		{
+			desc: "dependencies",
+			data: "name: a-operator\ndependencies:\n- name: cert-operator\n  constraint: \">=1.2\"\n- name: b-operator\n",
+			want: &v1alpha1.BundleMetadata{
+				Name:         "a-operator",
+				Dependencies: []v1alpha1.Dependency{{Name: "cert-operator", Constraint: ">=1.2"}, {Name: "b-operator"}},
+			},
+		},
+		{desc: "dependency without name", data: "name: a-operator\ndependencies:\n- constraint: \">=1.2\"\n", wantErr: true},
+		{desc: "invalid dependency constraint", data: "name: a-operator\ndependencies:\n- name: b-operator\n  constraint: \"~>1\"\n", wantErr: true},
+		{desc: "not yaml", data: "name: [", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := parseMetadata([]byte(test.data))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("got metadata diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckMetadata(t *testing.T) {
+	tests := []struct {
+		desc        string
+		md          v1alpha1.BundleMetadata
+		channel     v1alpha1.OperatorChannel
+		wantBlocked bool
+	}{
+		{
+			desc:    "matching name and version",
+			md:      v1alpha1.BundleMetadata{Name: "a-operator", Version: "v1.2.0"},
+			channel: v1alpha1.OperatorChannel{Name: "a-operator", ChannelSpec: v1alpha1.ChannelSpec{Version: "1.2.0"}},
+		},
+		{
+			desc:    "channel without version",
+			md:      v1alpha1.BundleMetadata{Name: "a-operator", Version: "1.2.0"},
+			channel: v1alpha1.OperatorChannel{Name: "a-operator"},
+		},
+		{
+			desc:    "bundle without version",
+			md:      v1alpha1.BundleMetadata{Name: "a-operator"},
+			channel: v1alpha1.OperatorChannel{Name: "a-operator", ChannelSpec: v1alpha1.ChannelSpec{Version: "1.2.0"}},
+		},
+		{
+			desc:    "commit as channel version",
+			md:      v1alpha1.BundleMetadata{Name: "a-operator", Version: "1.2.0"},
+			channel: v1alpha1.OperatorChannel{Name: "a-operator", ChannelSpec: v1alpha1.ChannelSpec{Version: "3f2a1c9"}},
+			// A commit is not a semantic version, the channel's version has to match as is
+			wantBlocked: true,
+		},
+		{
+			desc:        "other operator",
+			md:          v1alpha1.BundleMetadata{Name: "b-operator", Version: "1.2.0"},
+			channel:     v1alpha1.OperatorChannel{Name: "a-operator", ChannelSpec: v1alpha1.ChannelSpec{Version: "1.2.0"}},
+			wantBlocked: true,
+		},
+		{
+			desc:        "other version",
+			md:          v1alpha1.BundleMetadata{Name: "a-operator", Version: "1.3.0"},
+			channel:     v1alpha1.OperatorChannel{Name: "a-operator", ChannelSpec: v1alpha1.ChannelSpec{Version: "1.2.0"}},
+			wantBlocked: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			err := checkMetadata(&test.md, test.channel)
+			if IsBlocked(err) != test.wantBlocked || err != nil && !test.wantBlocked {
+				t.Fatalf("got error %v, want blocked %t", err, test.wantBlocked)
+			}
+			if err != nil && err.(*BlockedError).Reason != "BundleMismatch" {
+				t.Errorf("got reason %q, want BundleMismatch", err.(*BlockedError).Reason)
+			}
+		})
+	}
+}
+
+func TestCheckRequirements(t *testing.T) {
+	cluster := &fakeCluster{version: "v1.14.3-gke.11", groups: []string{"apps/v1", "cert-manager.io/v1alpha2"}}
+
+	tests := []struct {
+		desc    string
+		md      v1alpha1.BundleMetadata
+		cluster ClusterInfo
+		wantErr string
+	}{
+		{
+			desc:    "no requirements",
+			md:      v1alpha1.BundleMetadata{Name: "a-operator"},
+			cluster: nil,
+		},
+		{
+			desc:    "version within bounds",
+			md:      v1alpha1.BundleMetadata{Name: "a-operator", MinKubeVersion: "1.14", MaxKubeVersion: "v1.16"},
+			cluster: cluster,
+		},
+		{
+			desc:    "version at upper bound",
+			md:      v1alpha1.BundleMetadata{Name: "a-operator", MaxKubeVersion: "1.14.3"},
+			cluster: cluster,
+		},
+		{
+			desc:    "version too old",
+			md:      v1alpha1.BundleMetadata{Name: "a-operator", MinKubeVersion: "1.15"},
+			cluster: cluster,
+			wantErr: "Kubernetes version 1.14.3 does not satisfy >=1.15",
+		},
+		{
+			desc:    "version too new",
+			md:      v1alpha1.BundleMetadata{Name: "a-operator", MaxKubeVersion: "1.13"},
+			cluster: cluster,
+			wantErr: "Kubernetes version 1.14.3 does not satisfy <=1.13",
+		},
+		{
+			desc:    "groups served",
+			md:      v1alpha1.BundleMetadata{Name: "a-operator", RequiredAPIGroups: []string{"cert-manager.io", "apps/v1"}},
+			cluster: cluster,
+		},
+		{
+			desc:    "groups not served",
+			md:      v1alpha1.BundleMetadata{Name: "a-operator", RequiredAPIGroups: []string{"apps/v1beta1", "cert-manager.io", "monitoring.coreos.com"}},
+			cluster: cluster,
+			wantErr: "API groups not served: apps/v1beta1, monitoring.coreos.com",
+		},
+		{
+			desc:    "requirements without cluster",
+			md:      v1alpha1.BundleMetadata{Name: "a-operator", MinKubeVersion: "1.14"},
+			cluster: nil,
+			wantErr: "no discovery client",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			err := checkRequirements(&test.md, test.cluster)
+			if got := fmt.Sprint(err); test.wantErr == "" && err != nil || !strings.Contains(got, test.wantErr) {
+				t.Fatalf("got error %v, want %q", err, test.wantErr)
+			}
+			if IsPermanent(err) {
+				t.Errorf("got permanent error %v, want requirements to be checked again", err)
+			}
+		})
+	}
+}
+
+func TestDecodeBundleMetadata(t *testing.T) {
+	files := []manifestFile{
+		{name: "a-operator/bundle.yaml", data: []byte("name: a-operator\nversion: 1.2.0\n")},
+		{name: "a-operator/deploy/bundle.yaml", data: []byte("apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: a-operator\n")},
+	}
+
+	b, err := decodeBundle(files)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if diff := cmp.Diff(b.Metadata, &v1alpha1.BundleMetadata{Name: "a-operator", Version: "1.2.0"}); diff != "" {
+		t.Errorf("got metadata diff: %s", diff)
+	}
+	// Only the metadata file in the bundle root describes the bundle
+	if len(b.Objects) != 1 || len(b.Skipped) != 0 {
+		t.Errorf("got %d objects and skipped files %v, want the nested bundle.yaml decoded as manifest", len(b.Objects), b.Skipped)
+	}
+
+	files[0].data = []byte("name: a-operator\nversion: [\n")
+	if _, err := decodeBundle(files); err == nil {
+		t.Errorf("got no error for invalid metadata")
+	}
+}
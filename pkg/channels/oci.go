@@ -0,0 +1,358 @@
+package channels
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+)
+
+// OCIScheme prefixes channel URLs referencing an OCI artifact in a registry, e.g.
+// oci://registry.example.com/team/a-operator:1.2.3 or oci://registry.example.com/team/a-operator@sha256:<hex>.
+// References without tag or digest are pulled by the channel's version.
+const OCIScheme = "oci://"
+
+// Bounds of what is read from registries besides layers, bound by ArchiveLimits.
+const (
+	// maxManifestSize is the size of a manifest, the limit registries commonly enforce
+	maxManifestSize = 4 << 20
+	// maxTokenSize is the size of a token service's response
+	maxTokenSize = 1 << 20
+)
+
+// manifestMediaTypes are the manifest media types accepted from registries.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ociReference identifies a manifest in a registry.
+type ociReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// parseOCIReference parses a channel URL of the form oci://<registry>/<repository>[:<tag>|@<digest>].
+// References without tag or digest get version as tag.
+func parseOCIReference(rawurl, version string) (*ociReference, error) {
+	s := strings.TrimPrefix(rawurl, OCIScheme)
+	i := strings.Index(s, "/")
+	if i <= 0 || i == len(s)-1 {
+		return nil, fmt.Errorf("Error parsing OCI reference %q: missing registry or repository", rawurl)
+	}
+
+	ref := &ociReference{Registry: s[:i], Repository: s[i+1:]}
+	if i := strings.Index(ref.Repository, "@"); i >= 0 {
+		ref.Repository, ref.Digest = ref.Repository[:i], ref.Repository[i+1:]
+		if !strings.HasPrefix(ref.Digest, "sha256:") {
+			return nil, fmt.Errorf("Error parsing OCI reference %q: unsupported digest %s", rawurl, ref.Digest)
+		}
+	} else if i := strings.LastIndex(ref.Repository, ":"); i > strings.LastIndex(ref.Repository, "/") {
+		ref.Repository, ref.Tag = ref.Repository[:i], ref.Repository[i+1:]
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = version
+	}
+	if ref.Repository == "" || (ref.Tag == "" && ref.Digest == "") {
+		return nil, fmt.Errorf("Error parsing OCI reference %q: missing repository, tag or digest", rawurl)
+	}
+	return ref, nil
+}
+
+// reference returns the digest of the manifest if given, its tag otherwise.
+func (r *ociReference) reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// url returns the registry API URL of the given kind (manifests, blobs) and reference.
+func (r *ociReference) url(kind, reference string) string {
+	return fmt.Sprintf("https://%s/v2/%s/%s/%s", r.Registry, r.Repository, kind, reference)
+}
+
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// isArchive reports whether the layer holds a gzip compressed tar archive of manifests.
+func (d ociDescriptor) isArchive() bool {
+	return strings.HasSuffix(d.MediaType, "tar+gzip") || strings.HasSuffix(d.MediaType, "tar.gzip")
+}
+
+// ociReader reads channels published as OCI artifacts. All gzip compressed tar layers
+// of the manifest are unpacked together and decoded like the archives of simpleReader.
+type ociReader struct {
+	client  *http.Client
+	log     logr.Logger
+	channel v1alpha1.OperatorChannel
+	opts    ReaderOptions
+	// token is the bearer token handed out by the registry's token service
+	token string
+}
+
+func newOCIReader(client *http.Client, log logr.Logger, channel v1alpha1.OperatorChannel, opts ReaderOptions) ChannelReader {
+	return &ociReader{client: client, log: log, channel: channel, opts: opts}
+}
+
+// Read pulls the manifest of the channel's reference and unpacks its layers. The digest of
+// a bundle read from a registry is the digest of its manifest, pinned digests and signatures
+// are verified against the manifest, layers against their digests in the manifest.
+func (or *ociReader) Read() (*Bundle, bool, error) {
+	oc := or.channel
+
+	ref, err := parseOCIReference(oc.URL, oc.Version)
+	if err != nil {
+		return nil, false, err
+	}
+
+	or.log.Info("Pulling manifests for operator", "Operator.Name", oc.Name, "Registry", ref.Registry, "Repository", ref.Repository, "Reference", ref.reference())
+
+	data, err := or.fetchManifest(ref)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Nothing of a tampered manifest must be pulled
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	if ref.Digest != "" && normalizeDigest(ref.Digest) != digest {
+		return nil, false, &IntegrityError{Expected: normalizeDigest(ref.Digest), Actual: digest}
+	}
+	if oc.SHA256 != "" {
+		if pinned := normalizeDigest(oc.SHA256); pinned != digest {
+			return nil, false, &IntegrityError{Expected: pinned, Actual: digest}
+		}
+	}
+
+	if or.opts.Verifier != nil {
+		if oc.Signature == nil || oc.Signature.URL == "" {
+			return nil, false, &SignatureError{Reason: "SignatureMissing", Message: "channels pulled from a registry need the URL of the manifest's signature"}
+		}
+		sig, err := fetchSignature(or.client, oc.Signature.URL, headerFor(oc.Signature.URL, or.opts.AuthHost, or.opts.Header))
+		if err != nil {
+			return nil, !IsSignatureError(err), err
+		}
+		if err := or.opts.Verifier.Verify(data, sig); err != nil {
+			return nil, false, err
+		}
+	}
+
+	manifest := &ociManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, false, fmt.Errorf("Error decoding manifest: %s", err)
+	}
+
+	// Files of later layers replace the ones of earlier layers at the same path
+	files := map[string][]byte{}
+	layers := 0
+	for _, layer := range manifest.Layers {
+		if !layer.isArchive() {
+			continue
+		}
+		layers++
+
+		blob, requeue, err := or.fetchBlob(ref, layer)
+		if err != nil {
+			return nil, requeue, err
+		}
+		layerFiles, err := untarGzip(bytes.NewReader(blob), ArchiveLimits)
+		if err != nil {
+			return nil, true, fmt.Errorf("Error unarchiving layer %s: %s", layer.Digest, err)
+		}
+		for _, f := range layerFiles {
+			files[f.name] = f.data
+		}
+	}
+	if layers == 0 {
+		return nil, false, fmt.Errorf("Error reading manifest %s: no gzip compressed tar layers", digest)
+	}
+
+	b, err := decodeBundle(sortedFiles(files))
+	if err != nil {
+		return nil, false, err
+	}
+	b.Digest = digest
+	return b, false, nil
+}
+
+// fetchManifest returns the raw manifest of ref.
+func (or *ociReader) fetchManifest(ref *ociReference) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, ref.url("manifests", ref.reference()), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+
+	resp, err := or.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching manifest for %s: %s", or.channel.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Error fetching manifest: response status code %d", resp.StatusCode)
+	}
+
+	data, err := readAll(resp.Body, maxManifestSize, "manifest")
+	if err != nil {
+		return nil, fmt.Errorf("Error reading manifest: %s", err)
+	}
+	return data, nil
+}
+
+// fetchBlob downloads the blob of layer and verifies its digest.
+func (or *ociReader) fetchBlob(ref *ociReference, layer ociDescriptor) ([]byte, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, ref.url("blobs", layer.Digest), nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := or.do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error fetching layer %s: %s", layer.Digest, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		return nil, false, fmt.Errorf("Error fetching layer %s: response status code %d", layer.Digest, resp.StatusCode)
+	}
+
+	blob, err := readArchive(resp.Body, ArchiveLimits)
+	if err != nil {
+		return nil, true, fmt.Errorf("Error fetching layer %s: %s", layer.Digest, err)
+	}
+
+	if digest := fmt.Sprintf("sha256:%x", sha256.Sum256(blob)); digest != normalizeDigest(layer.Digest) {
+		return nil, false, &IntegrityError{Expected: normalizeDigest(layer.Digest), Actual: digest}
+	}
+	return blob, false, nil
+}
+
+// do sends req with the channel's headers. A bearer token challenge of the registry is
+// answered once by requesting a token from its token service with the same headers,
+// e.g. basic auth credentials, if the token service is on the registry's host. The token
+// is used for all following requests. Neither headers nor token follow redirects to other
+// hosts, e.g. blobs served by a CDN.
+func (or *ociReader) do(req *http.Request) (*http.Response, error) {
+	for k, v := range headerFor(req.URL.String(), or.opts.AuthHost, or.opts.Header) {
+		req.Header[k] = v
+	}
+	if or.token != "" {
+		req.Header.Set("Authorization", "Bearer "+or.token)
+	}
+	client := authClient(or.client, req.Header)
+
+	resp, err := client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || or.token != "" {
+		return resp, err
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	token, err := or.fetchToken(parseChallenge(challenge[len("bearer "):]))
+	if err != nil {
+		return nil, err
+	}
+	or.token = token
+
+	req.Header.Set("Authorization", "Bearer "+or.token)
+	return authClient(or.client, req.Header).Do(req)
+}
+
+// fetchToken requests a bearer token from the token service named in a challenge.
+func (or *ociReader) fetchToken(params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("Error requesting registry token: invalid realm %q", params["realm"])
+	}
+	q := realm.Query()
+	for _, p := range []string{"service", "scope"} {
+		if params[p] != "" {
+			q.Set(p, params[p])
+		}
+	}
+	realm.RawQuery = q.Encode()
+
+	resp, err := get(or.client, realm.String(), headerFor(realm.String(), or.opts.AuthHost, or.opts.Header))
+	if err != nil {
+		return "", fmt.Errorf("Error requesting registry token: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		return "", fmt.Errorf("Error requesting registry token: response status code %d", resp.StatusCode)
+	}
+
+	var tr struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	data, err := readAll(resp.Body, maxTokenSize, "token response")
+	if err != nil {
+		return "", fmt.Errorf("Error reading registry token: %s", err)
+	}
+	if err := json.Unmarshal(data, &tr); err != nil {
+		return "", fmt.Errorf("Error decoding registry token: %s", err)
+	}
+	if tr.Token == "" {
+		tr.Token = tr.AccessToken
+	}
+	if tr.Token == "" {
+		return "", fmt.Errorf("Error requesting registry token: empty token")
+	}
+	return tr.Token, nil
+}
+
+// parseChallenge parses the comma separated key="value" parameters of a WWW-Authenticate
+// challenge. Quoted values may contain commas, e.g. scope="repository:a:pull,push".
+func parseChallenge(s string) map[string]string {
+	params := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, ", ") {
+		i := strings.Index(s, "=")
+		if i < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = s[i+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else {
+			end := strings.Index(s, ",")
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		params[key] = value
+	}
+	return params
+}
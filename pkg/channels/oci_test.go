@@ -0,0 +1,252 @@
+package channels
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+)
+
+// testRegistry is an in-process stand-in of an OCI registry serving a single repository.
+// With a token set, all registry requests require a bearer token handed out by its token
+// service in exchange for the basic auth credentials jane:secret.
+type testRegistry struct {
+	repository string
+	manifests  map[string][]byte
+	blobs      map[string][]byte
+	token      string
+}
+
+func digestOf(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// newTestRegistry returns a registry holding a manifest tagged 1.2.3 with the given layers
+// and the digest of the manifest.
+func newTestRegistry(t *testing.T, layers map[string][]byte) (*testRegistry, string) {
+	reg := &testRegistry{repository: "team/a-operator", manifests: map[string][]byte{}, blobs: map[string][]byte{}}
+
+	manifest := ociManifest{SchemaVersion: 2, MediaType: "application/vnd.oci.image.manifest.v1+json"}
+	for mediaType, data := range layers {
+		d := digestOf(data)
+		reg.blobs[d] = data
+		manifest.Layers = append(manifest.Layers, ociDescriptor{MediaType: mediaType, Digest: d, Size: int64(len(data))})
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.manifests["1.2.3"] = data
+	reg.manifests[digestOf(data)] = data
+	return reg, digestOf(data)
+}
+
+func (reg *testRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "jane" || pass != "secret" || r.URL.Query().Get("scope") != "repository:"+reg.repository+":pull" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"token": %q}`, reg.token)
+		return
+	}
+
+	if reg.token != "" && r.Header.Get("Authorization") != "Bearer "+reg.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="https://%s/token",service="test",scope="repository:%s:pull"`, r.Host, reg.repository))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	prefix := "/v2/" + reg.repository + "/"
+	switch {
+	case strings.HasPrefix(r.URL.Path, prefix+"manifests/"):
+		if data, ok := reg.manifests[strings.TrimPrefix(r.URL.Path, prefix+"manifests/")]; ok {
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			w.Write(data)
+			return
+		}
+	case strings.HasPrefix(r.URL.Path, prefix+"blobs/"):
+		if data, ok := reg.blobs[strings.TrimPrefix(r.URL.Path, prefix+"blobs/")]; ok {
+			w.Write(data)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func TestParseOCIReference(t *testing.T) {
+	tests := []struct {
+		url     string
+		version string
+		want    *ociReference
+		wantErr bool
+	}{
+		{url: "oci://registry.example.com/team/a-operator:1.2.3", want: &ociReference{Registry: "registry.example.com", Repository: "team/a-operator", Tag: "1.2.3"}},
+		{url: "oci://localhost:5000/a-operator", version: "1.2.3", want: &ociReference{Registry: "localhost:5000", Repository: "a-operator", Tag: "1.2.3"}},
+		{url: "oci://localhost:5000/a-operator@sha256:abc", want: &ociReference{Registry: "localhost:5000", Repository: "a-operator", Digest: "sha256:abc"}},
+		{url: "oci://localhost:5000/a-operator@md5:abc", wantErr: true},
+		{url: "oci://localhost:5000/a-operator", wantErr: true},
+		{url: "oci://a-operator", wantErr: true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.url, func(t *testing.T) {
+			got, err := parseOCIReference(test.url, test.version)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error: %v, want error: %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("got diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	got := parseChallenge(`realm="https://auth.example.com/token",service=registry,scope="repository:a:pull,push"`)
+	want := map[string]string{"realm": "https://auth.example.com/token", "service": "registry", "scope": "repository:a:pull,push"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got diff: %s", diff)
+	}
+}
+
+func TestReadOCI(t *testing.T) {
+	archive, err := ioutil.ReadFile("./testdata/valid.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc        string
+		layers      map[string][]byte
+		token       string
+		header      http.Header
+		reference   func(digest string) string
+		sha256      string
+		tamperBlob  bool
+		wantObjects int
+		wantErr     bool
+		// wantIntegrityErr expects the manifest or a layer to be refused before unarchiving
+		wantIntegrityErr bool
+	}{
+		{
+			desc:        "pull by tag",
+			layers:      map[string][]byte{"application/vnd.oci.image.layer.v1.tar+gzip": archive},
+			reference:   func(string) string { return ":1.2.3" },
+			wantObjects: 2,
+		},
+		{
+			desc:        "pull by version",
+			layers:      map[string][]byte{"application/vnd.oci.image.layer.v1.tar+gzip": archive},
+			reference:   func(string) string { return "" },
+			wantObjects: 2,
+		},
+		{
+			desc:        "pull by digest",
+			layers:      map[string][]byte{"application/vnd.oci.image.layer.v1.tar+gzip": archive},
+			reference:   func(d string) string { return "@" + d },
+			wantObjects: 2,
+		},
+		{
+			desc:      "unknown tag",
+			layers:    map[string][]byte{"application/vnd.oci.image.layer.v1.tar+gzip": archive},
+			reference: func(string) string { return ":2.0.0" },
+			wantErr:   true,
+		},
+		{
+			desc: "non-archive layers are skipped",
+			layers: map[string][]byte{
+				"application/vnd.docker.image.rootfs.diff.tar.gzip": archive,
+				"application/vnd.oci.image.config.v1+json":          []byte("{}"),
+			},
+			reference:   func(string) string { return ":1.2.3" },
+			wantObjects: 2,
+		},
+		{
+			desc:      "no archive layers",
+			layers:    map[string][]byte{"application/vnd.oci.image.config.v1+json": []byte("{}")},
+			reference: func(string) string { return ":1.2.3" },
+			wantErr:   true,
+		},
+		{
+			desc:             "pinned digest mismatch",
+			layers:           map[string][]byte{"application/vnd.oci.image.layer.v1.tar+gzip": archive},
+			reference:        func(string) string { return ":1.2.3" },
+			sha256:           "b38a711fe0723d4e330ebec004cf15afe1e73c973cac85775f6f7697e9aa44b6",
+			wantErr:          true,
+			wantIntegrityErr: true,
+		},
+		{
+			desc:             "tampered layer",
+			layers:           map[string][]byte{"application/vnd.oci.image.layer.v1.tar+gzip": archive},
+			reference:        func(string) string { return ":1.2.3" },
+			tamperBlob:       true,
+			wantErr:          true,
+			wantIntegrityErr: true,
+		},
+		{
+			desc:        "token authentication",
+			layers:      map[string][]byte{"application/vnd.oci.image.layer.v1.tar+gzip": archive},
+			reference:   func(string) string { return ":1.2.3" },
+			token:       "t0k3n",
+			header:      http.Header{"Authorization": {"Basic amFuZTpzZWNyZXQ="}},
+			wantObjects: 2,
+		},
+		{
+			desc:      "token authentication without credentials",
+			layers:    map[string][]byte{"application/vnd.oci.image.layer.v1.tar+gzip": archive},
+			reference: func(string) string { return ":1.2.3" },
+			token:     "t0k3n",
+			wantErr:   true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+			reg, digest := newTestRegistry(t, test.layers)
+			reg.token = test.token
+			if test.tamperBlob {
+				for d := range reg.blobs {
+					reg.blobs[d] = append([]byte{}, archive[:len(archive)-1]...)
+				}
+			}
+			ts := httptest.NewTLSServer(reg)
+			defer ts.Close()
+
+			channel := v1alpha1.OperatorChannel{
+				Name: "a-operator",
+				ChannelSpec: v1alpha1.ChannelSpec{
+					URL:     OCIScheme + strings.TrimPrefix(ts.URL, "https://") + "/team/a-operator" + test.reference(digest),
+					Version: "1.2.3",
+					SHA256:  test.sha256,
+				},
+			}
+
+			b, _, err := newTestReader(t, ts.Client(), channel, ReaderOptions{Header: test.header, AuthHost: authHost(channel)}).Read()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error: %v, want error: %t", err, test.wantErr)
+			}
+			if IsIntegrityError(err) != test.wantIntegrityErr {
+				t.Errorf("got integrity error: %v, want integrity error: %t", err, test.wantIntegrityErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(b.Objects) != test.wantObjects {
+				t.Errorf("got %d objects, want %d", len(b.Objects), test.wantObjects)
+			}
+			if b.Digest != digest {
+				t.Errorf("got digest: %s, want manifest digest: %s", b.Digest, digest)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package channels
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+)
+
+// ReaderFactory returns a ChannelReader for a channel with a URL of the scheme it is registered for.
+type ReaderFactory func(client *http.Client, log logr.Logger, channel v1alpha1.OperatorChannel, opts ReaderOptions) ChannelReader
+
+var readers = struct {
+	sync.RWMutex
+	factories map[string]ReaderFactory
+}{factories: map[string]ReaderFactory{}}
+
+// RegisterReader registers factory for channel URLs of the given scheme, e.g. "https",
+// replacing any factory registered for the scheme before.
+func RegisterReader(scheme string, factory ReaderFactory) {
+	readers.Lock()
+	defer readers.Unlock()
+	readers.factories[strings.ToLower(scheme)] = factory
+}
+
+func init() {
+	RegisterReader("http", newHTTPReader)
+	RegisterReader("https", newHTTPReader)
+	RegisterReader("oci", newOCIReader)
+	for _, s := range []string{"git+https", "git+http", "git+ssh"} {
+		RegisterReader(s, newGitReader)
+	}
+	RegisterReader("configmap", newObjectReader)
+	RegisterReader("secret", newObjectReader)
+}
+
+// NewChannelReader returns a reader for the channel from the factory registered for the
+// scheme of its URL. Channels with a source block are read like URLs of the matching
+// scheme, i.e. "git+https", "configmap" or "secret", or "git+file" for git repositories on
+// the operator's filesystem.
+func NewChannelReader(client *http.Client, log logr.Logger, channel v1alpha1.OperatorChannel, opts ReaderOptions) (ChannelReader, error) {
+	scheme, err := readerScheme(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	readers.RLock()
+	factory, ok := readers.factories[scheme]
+	readers.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Error reading channel %s: unsupported url scheme %q", channel.Name, scheme)
+	}
+	return factory(client, log, channel, opts), nil
+}
+
+// readerScheme returns the scheme selecting the reader of channel.
+func readerScheme(channel v1alpha1.OperatorChannel) (string, error) {
+	if src := channel.Source; src != nil {
+		switch {
+		case src.Git != nil:
+			if isLocalRepo(src.Git.Repo) {
+				return "git+file", nil
+			}
+			return "git+https", nil
+		case src.ConfigMap != nil:
+			return "configmap", nil
+		case src.Secret != nil:
+			return "secret", nil
+		}
+		return "", fmt.Errorf("Error reading channel %s: empty source", channel.Name)
+	}
+
+	u, err := url.Parse(channel.URL)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing url of channel %s: %s", channel.Name, err)
+	}
+	if u.Scheme == "" {
+		return "", fmt.Errorf("Error reading channel %s: url %q without scheme", channel.Name, channel.URL)
+	}
+	return strings.ToLower(u.Scheme), nil
+}
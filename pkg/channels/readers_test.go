@@ -0,0 +1,71 @@
+package channels
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+type testReader struct {
+	channel v1alpha1.OperatorChannel
+}
+
+func (tr *testReader) Read() (*Bundle, bool, error) {
+	return &Bundle{}, false, nil
+}
+
+func TestNewChannelReader(t *testing.T) {
+	RegisterReader("test", func(_ *http.Client, _ logr.Logger, channel v1alpha1.OperatorChannel, _ ReaderOptions) ChannelReader {
+		return &testReader{channel: channel}
+	})
+	defer func() {
+		readers.Lock()
+		delete(readers.factories, "test")
+		readers.Unlock()
+	}()
+
+	tests := []struct {
+		desc    string
+		spec    v1alpha1.ChannelSpec
+		want    string
+		wantErr bool
+	}{
+		{desc: "https", spec: v1alpha1.ChannelSpec{URL: "https://example.com/a-operator.tar.gz"}, want: "https"},
+		{desc: "upper case scheme", spec: v1alpha1.ChannelSpec{URL: "HTTPS://example.com/a-operator.tar.gz"}, want: "https"},
+		{desc: "oci", spec: v1alpha1.ChannelSpec{URL: "oci://registry.example.com/a-operator"}, want: "oci"},
+		{desc: "git", spec: v1alpha1.ChannelSpec{URL: "git+https://example.com/a-operator.git"}, want: "git+https"},
+		{desc: "configmap", spec: v1alpha1.ChannelSpec{URL: "configmap://manifests"}, want: "configmap"},
+		{desc: "git source", spec: v1alpha1.ChannelSpec{Source: &v1alpha1.SourceSpec{Git: &v1alpha1.GitSource{Repo: "https://example.com/a.git"}}}, want: "git+https"},
+		{desc: "local git source not registered", spec: v1alpha1.ChannelSpec{Source: &v1alpha1.SourceSpec{Git: &v1alpha1.GitSource{Repo: "/srv/git/a.git"}}}, want: "git+file", wantErr: true},
+		{desc: "git+file not registered", spec: v1alpha1.ChannelSpec{URL: "git+file:///srv/git/a.git"}, wantErr: true},
+		{desc: "secret source", spec: v1alpha1.ChannelSpec{Source: &v1alpha1.SourceSpec{Secret: &v1alpha1.ObjectSource{Name: "archive"}}}, want: "secret"},
+		{desc: "registered scheme", spec: v1alpha1.ChannelSpec{URL: "test://a-operator"}, want: "test"},
+		{desc: "file not registered", spec: v1alpha1.ChannelSpec{URL: "file:///tmp/a-operator"}, wantErr: true},
+		{desc: "unknown scheme", spec: v1alpha1.ChannelSpec{URL: "ftp://example.com/a-operator.tar.gz"}, wantErr: true},
+		{desc: "missing scheme", spec: v1alpha1.ChannelSpec{URL: "example.com/a-operator.tar.gz"}, wantErr: true},
+		{desc: "empty source", spec: v1alpha1.ChannelSpec{Source: &v1alpha1.SourceSpec{}}, wantErr: true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			channel := v1alpha1.OperatorChannel{Name: "a-operator", ChannelSpec: test.spec}
+			scheme, err := readerScheme(channel)
+			if err == nil && test.want != "" && scheme != test.want {
+				t.Errorf("got scheme: %s, want scheme: %s", scheme, test.want)
+			}
+
+			r, err := NewChannelReader(nil, logf.Log, channel, ReaderOptions{})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error: %v, want error: %t", err, test.wantErr)
+			}
+			if test.want == "test" {
+				if tr, ok := r.(*testReader); !ok || tr.channel.Name != "a-operator" {
+					t.Errorf("got reader %T, want the registered test reader", r)
+				}
+			}
+		})
+	}
+}
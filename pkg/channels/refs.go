@@ -0,0 +1,84 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// loadKey returns the value selected by src from a Secret or ConfigMap in namespace.
+func loadKey(ctx context.Context, c client.Client, namespace string, src v1alpha1.KeySource) ([]byte, error) {
+	switch {
+	case src.SecretKeyRef != nil && src.ConfigMapKeyRef != nil:
+		return nil, fmt.Errorf("Error loading key: only one of secretKeyRef and configMapKeyRef may be set")
+	case src.SecretKeyRef != nil:
+		ref := src.SecretKeyRef
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, secret); err != nil {
+			return nil, fmt.Errorf("Error loading key from secret %s: %s", ref.Name, err)
+		}
+		data, ok := secret.Data[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("Error loading key: secret %s has no key %s", ref.Name, ref.Key)
+		}
+		return data, nil
+	case src.ConfigMapKeyRef != nil:
+		ref := src.ConfigMapKeyRef
+		cm := &corev1.ConfigMap{}
+		if err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, cm); err != nil {
+			return nil, fmt.Errorf("Error loading key from configmap %s: %s", ref.Name, err)
+		}
+		if data, ok := cm.Data[ref.Key]; ok {
+			return []byte(data), nil
+		}
+		if data, ok := cm.BinaryData[ref.Key]; ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("Error loading key: configmap %s has no key %s", ref.Name, ref.Key)
+	}
+	return nil, fmt.Errorf("Error loading key: one of secretKeyRef and configMapKeyRef must be set")
+}
+
+// SecretNames returns the names of all Secrets referenced by a channel, i.e. those a
+// change of is worth fetching the channel again.
+func SecretNames(spec v1alpha1.ChannelSpec) []string {
+	var names []string
+	if spec.AuthSecretRef != nil {
+		names = append(names, spec.AuthSecretRef.Name)
+	}
+	if spec.Signature != nil && spec.Signature.PublicKey.SecretKeyRef != nil {
+		names = append(names, spec.Signature.PublicKey.SecretKeyRef.Name)
+	}
+	if spec.TLS != nil {
+		if spec.TLS.CA != nil && spec.TLS.CA.SecretKeyRef != nil {
+			names = append(names, spec.TLS.CA.SecretKeyRef.Name)
+		}
+		if spec.TLS.ClientCertSecretRef != nil {
+			names = append(names, spec.TLS.ClientCertSecretRef.Name)
+		}
+	}
+	if kind, src := objectSource(spec); kind == "secret" {
+		names = append(names, src.Name)
+	}
+	return names
+}
+
+// ConfigMapNames returns the names of all ConfigMaps referenced by a channel, i.e. those a
+// change of is worth reading the channel again.
+func ConfigMapNames(spec v1alpha1.ChannelSpec) []string {
+	var names []string
+	if spec.Signature != nil && spec.Signature.PublicKey.ConfigMapKeyRef != nil {
+		names = append(names, spec.Signature.PublicKey.ConfigMapKeyRef.Name)
+	}
+	if spec.TLS != nil && spec.TLS.CA != nil && spec.TLS.CA.ConfigMapKeyRef != nil {
+		names = append(names, spec.TLS.CA.ConfigMapKeyRef.Name)
+	}
+	if kind, src := objectSource(spec); kind == "configmap" {
+		names = append(names, src.Name)
+	}
+	return names
+}
@@ -0,0 +1,48 @@
+package channels
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSecretNames(t *testing.T) {
+	spec := v1alpha1.ChannelSpec{
+		AuthSecretRef: &corev1.LocalObjectReference{Name: "auth"},
+		Signature: &v1alpha1.SignatureSpec{
+			PublicKey: v1alpha1.KeySource{
+				ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "keys"}},
+			},
+		},
+		TLS: &v1alpha1.TLSSpec{
+			CA:                  &v1alpha1.KeySource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ca"}}},
+			ClientCertSecretRef: &corev1.LocalObjectReference{Name: "client"},
+		},
+		Source: &v1alpha1.SourceSpec{Secret: &v1alpha1.ObjectSource{Name: "manifests"}},
+	}
+	want := []string{"auth", "ca", "client", "manifests"}
+	if diff := cmp.Diff(SecretNames(spec), want); diff != "" {
+		t.Errorf("got diff: %s", diff)
+	}
+}
+
+func TestConfigMapNames(t *testing.T) {
+	spec := v1alpha1.ChannelSpec{
+		AuthSecretRef: &corev1.LocalObjectReference{Name: "auth"},
+		Signature: &v1alpha1.SignatureSpec{
+			PublicKey: v1alpha1.KeySource{
+				ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "keys"}},
+			},
+		},
+		TLS: &v1alpha1.TLSSpec{
+			CA: &v1alpha1.KeySource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ca"}}},
+		},
+		Source: &v1alpha1.SourceSpec{ConfigMap: &v1alpha1.ObjectSource{Name: "manifests"}},
+	}
+	want := []string{"keys", "ca", "manifests"}
+	if diff := cmp.Diff(ConfigMapNames(spec), want); diff != "" {
+		t.Errorf("got diff: %s", diff)
+	}
+}
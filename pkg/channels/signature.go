@@ -0,0 +1,118 @@
+package channels
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+)
+
+// maxSignatureSize bounds the size of a detached signature, far above the size of an ed25519
+// or ECDSA signature even when base64 encoded.
+const maxSignatureSize = 64 << 10
+
+// Verifier verifies detached signatures of channel archives with an ed25519 or ECDSA public key.
+type Verifier struct {
+	key crypto.PublicKey
+}
+
+// NewVerifier parses a PEM encoded PKIX public key. Only ed25519 and ECDSA keys are accepted.
+func NewVerifier(pemData []byte) (*Verifier, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("Error decoding public key: no PEM block found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing public key: %s", err)
+	}
+
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey:
+		return &Verifier{key: key}, nil
+	}
+	return nil, fmt.Errorf("Error parsing public key: unsupported key type %T, want ed25519 or ECDSA", key)
+}
+
+// Verify checks the signature of data. The signature is accepted raw or base64 encoded.
+// ECDSA signatures are ASN.1 encoded over the SHA-2 digest matching the key's curve.
+func (v *Verifier) Verify(data, sig []byte) error {
+	if dec, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err == nil {
+		sig = dec
+	}
+
+	switch key := v.key.(type) {
+	case ed25519.PublicKey:
+		if ed25519.Verify(key, data, sig) {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		var es struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(sig, &es); err == nil && len(rest) == 0 {
+			if ecdsa.Verify(key, digestFor(key.Curve, data), es.R, es.S) {
+				return nil
+			}
+		}
+	}
+	return &SignatureError{Reason: "SignatureInvalid", Message: "signature does not match the archive and public key"}
+}
+
+func digestFor(curve elliptic.Curve, data []byte) []byte {
+	switch curve.Params().BitSize {
+	case 384:
+		d := sha512.Sum384(data)
+		return d[:]
+	case 521:
+		d := sha512.Sum512(data)
+		return d[:]
+	}
+	d := sha256.Sum256(data)
+	return d[:]
+}
+
+// fetchSignature downloads the detached signature at url. A missing signature
+// is reported as SignatureError, any other failure as a plain error.
+func fetchSignature(client *http.Client, url string, header http.Header) ([]byte, error) {
+	resp, err := get(client, url, header)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching signature: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &SignatureError{Reason: "SignatureMissing", Message: fmt.Sprintf("no signature found at %s", url)}
+	}
+	if resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Error fetching signature: response status code %d", resp.StatusCode)
+	}
+
+	sig, err := readAll(resp.Body, maxSignatureSize, "signature")
+	if err != nil {
+		return nil, fmt.Errorf("Error reading signature: %s", err)
+	}
+	if len(sig) == 0 {
+		return nil, &SignatureError{Reason: "SignatureMissing", Message: fmt.Sprintf("empty signature at %s", url)}
+	}
+	return sig, nil
+}
+
+// signatureURL returns the URL of the detached signature of the channel's archive.
+func signatureURL(archiveURL string, sig *v1alpha1.SignatureSpec) string {
+	if sig != nil && sig.URL != "" {
+		return sig.URL
+	}
+	return archiveURL + ".sig"
+}
@@ -0,0 +1,202 @@
+package channels
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+)
+
+func newTestKey(t *testing.T, curve elliptic.Curve) (crypto.Signer, []byte) {
+	var key crypto.Signer
+	var err error
+	if curve == nil {
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	} else {
+		key, err = ecdsa.GenerateKey(curve, rand.Reader)
+	}
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+	return key, encodePublicKey(t, key.Public())
+}
+
+func encodePublicKey(t *testing.T, pub crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("Error encoding public key: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func sign(t *testing.T, key crypto.Signer, data []byte) []byte {
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		sig, err := key.Sign(rand.Reader, data, crypto.Hash(0))
+		if err != nil {
+			t.Fatalf("Error signing: %s", err)
+		}
+		return sig
+	}
+	ek := key.(*ecdsa.PrivateKey)
+	sig, err := key.Sign(rand.Reader, digestFor(ek.Curve, data), nil)
+	if err != nil {
+		t.Fatalf("Error signing: %s", err)
+	}
+	return sig
+}
+
+func TestNewVerifier(t *testing.T) {
+	_, ed := newTestKey(t, nil)
+	_, ec := newTestKey(t, elliptic.P256())
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+
+	tests := []struct {
+		desc    string
+		key     []byte
+		wantErr bool
+	}{
+		{desc: "ed25519 key", key: ed},
+		{desc: "ecdsa key", key: ec},
+		{desc: "rsa key", key: encodePublicKey(t, &rsaKey.PublicKey), wantErr: true},
+		{desc: "no pem", key: []byte("not a key"), wantErr: true},
+		{desc: "broken der", key: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("broken")}), wantErr: true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := NewVerifier(test.key)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error: %v, want error: %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	data := []byte("archive contents")
+	edKey, edPub := newTestKey(t, nil)
+	p256Key, p256Pub := newTestKey(t, elliptic.P256())
+	p384Key, p384Pub := newTestKey(t, elliptic.P384())
+	_, otherPub := newTestKey(t, nil)
+
+	tests := []struct {
+		desc    string
+		pub     []byte
+		sig     []byte
+		wantErr bool
+	}{
+		{desc: "ed25519 signature", pub: edPub, sig: sign(t, edKey, data)},
+		{desc: "base64 encoded signature", pub: edPub, sig: []byte(base64.StdEncoding.EncodeToString(sign(t, edKey, data)) + "\n")},
+		{desc: "ecdsa p256 signature", pub: p256Pub, sig: sign(t, p256Key, data)},
+		{desc: "ecdsa p384 signature", pub: p384Pub, sig: sign(t, p384Key, data)},
+		{desc: "signature of other data", pub: edPub, sig: sign(t, edKey, []byte("tampered")), wantErr: true},
+		{desc: "signature by other key", pub: otherPub, sig: sign(t, edKey, data), wantErr: true},
+		{desc: "ecdsa signature with ed25519 key", pub: edPub, sig: sign(t, p256Key, data), wantErr: true},
+		{desc: "garbage signature", pub: p256Pub, sig: []byte("garbage"), wantErr: true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			v, err := NewVerifier(test.pub)
+			if err != nil {
+				t.Fatalf("Error creating verifier: %s", err)
+			}
+			err = v.Verify(data, test.sig)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error: %v, want error: %t", err, test.wantErr)
+			}
+			if err != nil && !IsSignatureError(err) {
+				t.Errorf("got error: %v, want signature error", err)
+			}
+		})
+	}
+}
+
+func TestReadSignature(t *testing.T) {
+	archive, err := ioutil.ReadFile("./testdata/valid.tar.gz")
+	if err != nil {
+		t.Fatalf("Error reading archive: %s", err)
+	}
+	key, pub := newTestKey(t, elliptic.P256())
+
+	tests := []struct {
+		desc        string
+		sig         []byte
+		wantReason  string
+		wantObjects int
+	}{
+		{desc: "valid signature", sig: sign(t, key, archive), wantObjects: 2},
+		{desc: "missing signature", wantReason: "SignatureMissing"},
+		{desc: "bad signature", sig: sign(t, key, []byte("tampered")), wantReason: "SignatureInvalid"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/a-operator.tar.gz":
+					w.Write(archive)
+				case "/a-operator.tar.gz.sig":
+					if test.sig == nil {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					w.Write(test.sig)
+				}
+			}))
+			defer ts.Close()
+
+			v, err := NewVerifier(pub)
+			if err != nil {
+				t.Fatalf("Error creating verifier: %s", err)
+			}
+			channel := v1alpha1.OperatorChannel{
+				Name: "a-operator",
+				ChannelSpec: v1alpha1.ChannelSpec{
+					URL:     ts.URL + "/a-operator.tar.gz",
+					Version: "1.2.3",
+				},
+			}
+
+			b, requeue, err := newTestReader(t, ts.Client(), channel, ReaderOptions{Verifier: v}).Read()
+			if requeue {
+				t.Error("got requeue request, want none")
+			}
+			if test.wantReason == "" {
+				if err != nil {
+					t.Fatalf("got error: %s, want none", err)
+				}
+				if len(b.Objects) != test.wantObjects {
+					t.Errorf("got %d objects, want %d", len(b.Objects), test.wantObjects)
+				}
+				return
+			}
+
+			se, ok := err.(*SignatureError)
+			if !ok {
+				t.Fatalf("got error: %v, want signature error", err)
+			}
+			if se.Reason != test.wantReason {
+				t.Errorf("got reason: %s, want reason: %s", se.Reason, test.wantReason)
+			}
+			if b != nil {
+				t.Error("got bundle of refused archive")
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	"github.com/periklis/nop-operator/pkg/apply"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxSkippedFiles bounds the number of skipped files reported in a channel's status.
+const maxSkippedFiles = 20
+
+// Syncer installs channels into the cluster. It is shared by all controllers
+// reconciling channels, regardless whether they are embedded in a NopOperator
+// or standalone Channel objects.
+type Syncer struct {
+	client     *http.Client
+	kubeClient client.Client
+	cluster    ClusterInfo
+	applier    *apply.Applier
+	log        logr.Logger
+
+	// CheckDependencies, if set, is called with the dependencies declared by a channel and its
+	// bundle before anything of the bundle is applied. A non-nil error refuses the bundle.
+	CheckDependencies func(channel v1alpha1.OperatorChannel, deps []v1alpha1.Dependency) error
+
+	// Namespaced refuses bundles with cluster-scoped objects or objects in other namespaces than
+	// the one of the channel's owner with a ScopeError, before anything of the bundle is applied.
+	Namespaced bool
+}
+
+// NewSyncer returns a Syncer fetching channels with client and applying their objects with applier.
+// Keys and certificates referenced by channels are read with kubeClient from the namespace of the
+// channel's owner. The requirements of bundles are checked against cluster.
+func NewSyncer(client *http.Client, kubeClient client.Client, cluster ClusterInfo, applier *apply.Applier, log logr.Logger) *Syncer {
+	return &Syncer{client: client, kubeClient: kubeClient, cluster: cluster, applier: applier, log: log}
+}
+
+// Sync fetches the channel's bundle and applies all its objects on behalf of owner, recording
+// the outcome in status. It returns the references of the applied objects and whether a
+// failure is worth a requeue. Version changes that need an approval are refused with a
+// BlockedError before anything is fetched, archives not matching their pinned digest with
+// an IntegrityError and archives without a valid signature with a SignatureError before
+// anything is unpacked. Bundles whose metadata names another operator or version than the
+// channel are refused with a BlockedError, bundles the cluster does not meet the
+// requirements of are not installed until it does, just like bundles failing
+// CheckDependencies.
+func (s *Syncer) Sync(owner metav1.Object, channel v1alpha1.OperatorChannel, status *v1alpha1.OperatorChannelStatus) ([]apply.Ref, bool, error) {
+	status.Name = channel.Name
+	status.DesiredVersion = channel.Version
+
+	ctx := context.TODO()
+	httpClient, err := httpClientFor(ctx, s.kubeClient, owner.GetNamespace(), s.client, channel)
+	if err != nil {
+		status.LastError = err.Error()
+		return nil, true, err
+	}
+	status.InsecureSkipTLSVerify = channel.TLS != nil && channel.TLS.InsecureSkipTLSVerify
+	if status.InsecureSkipTLSVerify {
+		s.log.Info("Fetching channel without verifying server certificates", "Operator.Name", channel.Name)
+	}
+
+	header, err := loadAuth(ctx, s.kubeClient, owner.GetNamespace(), channel.AuthSecretRef)
+	if err != nil {
+		status.LastError = err.Error()
+		return nil, true, err
+	}
+
+	host := authHost(channel)
+	channel, heldBack, err := ResolveChannel(httpClient, channel, status.InstalledVersion, header)
+	if err != nil {
+		status.LastError = err.Error()
+		return nil, false, err
+	}
+	status.DesiredVersion = channel.Version
+	setUpgradeAvailable(status, owner.GetGeneration(), heldBack)
+
+	if err := checkVersion(channel, status.InstalledVersion); err != nil {
+		s.log.Info("Refusing version change of channel", "Operator.Name", channel.Name, "Reason", err.Error())
+		status.LastError = ""
+		return nil, false, err
+	}
+
+	s.log.Info("Processing operator from channel", "Operator.Name", channel.Name, "Operator.Version", channel.Version, "Operator.URL", channel.URL)
+	opts := ReaderOptions{Header: header, AuthHost: host, KubeClient: s.kubeClient, Namespace: owner.GetNamespace(), Cache: BundleCache}
+	if channel.Signature != nil {
+		key, err := loadKey(ctx, s.kubeClient, owner.GetNamespace(), channel.Signature.PublicKey)
+		if err == nil {
+			opts.Verifier, err = NewVerifier(key)
+		}
+		if err != nil {
+			status.LastError = err.Error()
+			return nil, true, err
+		}
+	}
+	reader, err := NewChannelReader(httpClient, s.log, channel, opts)
+	if err != nil {
+		status.LastError = err.Error()
+		return nil, false, err
+	}
+
+	bundle, shouldRequeue, err := reader.Read()
+	if IsIntegrityError(err) {
+		s.log.Info("Refusing tampered archive of channel", "Operator.Name", channel.Name, "Reason", err.Error())
+		setVerified(status, owner.GetGeneration(), corev1.ConditionFalse, "DigestMismatch", err.Error())
+	}
+	if se, ok := err.(*SignatureError); ok {
+		s.log.Info("Refusing archive of channel without valid signature", "Operator.Name", channel.Name, "Reason", err.Error())
+		setVerified(status, owner.GetGeneration(), corev1.ConditionFalse, se.Reason, err.Error())
+	}
+	if err != nil {
+		status.LastError = err.Error()
+		return nil, shouldRequeue, err
+	}
+
+	switch {
+	case opts.Verifier != nil && channel.SHA256 != "":
+		setVerified(status, owner.GetGeneration(), corev1.ConditionTrue, "SignatureVerified", fmt.Sprintf("Archive matches pinned digest %s and is signed by the channel's public key", bundle.Digest))
+	case opts.Verifier != nil:
+		setVerified(status, owner.GetGeneration(), corev1.ConditionTrue, "SignatureVerified", "Archive is signed by the channel's public key")
+	case channel.SHA256 != "":
+		setVerified(status, owner.GetGeneration(), corev1.ConditionTrue, "DigestVerified", fmt.Sprintf("Archive matches pinned digest %s", bundle.Digest))
+	default:
+		setVerified(status, owner.GetGeneration(), corev1.ConditionUnknown, "NotPinned", "No digest pinned and no signature required for the archive")
+	}
+
+	status.Bundle = bundle.Metadata
+	if md := bundle.Metadata; md != nil {
+		err := checkMetadata(md, channel)
+		if err == nil {
+			err = checkRequirements(md, s.cluster)
+		}
+		if err != nil {
+			s.log.Info("Refusing bundle of channel", "Operator.Name", channel.Name, "Reason", err.Error())
+			status.LastError = err.Error()
+			return nil, !IsPermanent(err), err
+		}
+	}
+
+	if s.CheckDependencies != nil {
+		deps := channel.Dependencies
+		if bundle.Metadata != nil {
+			deps = append(append([]v1alpha1.Dependency{}, deps...), bundle.Metadata.Dependencies...)
+		}
+		if err := s.CheckDependencies(channel, deps); err != nil {
+			s.log.Info("Deferring bundle of channel", "Operator.Name", channel.Name, "Reason", err.Error())
+			status.LastError = ""
+			return nil, IsWaiting(err), err
+		}
+	}
+
+	// Channels without a version are versioned by their metadata, commit or digest
+	if channel.Version == "" {
+		if bundle.Metadata != nil {
+			channel.Version = bundle.Metadata.Version
+		}
+		if channel.Version == "" {
+			channel.Version = bundle.Commit
+		}
+		if channel.Version == "" {
+			channel.Version = bundle.Digest
+		}
+		status.DesiredVersion = channel.Version
+	}
+
+	now := metav1.Now()
+	status.LastFetchTime = &now
+	status.Digest = bundle.Digest
+	status.Commit = bundle.Commit
+	status.ObjectCount = len(bundle.Objects)
+	status.SkippedFiles = skippedFiles(bundle.Skipped)
+	if len(bundle.Skipped) > 0 {
+		s.log.Info("Skipped files of channel", "Operator.Name", channel.Name, "Files", bundle.Skipped)
+	}
+
+	if s.Namespaced {
+		if err := s.checkScope(owner, bundle.Objects); err != nil {
+			s.log.Info("Refusing bundle of channel", "Operator.Name", channel.Name, "Reason", err.Error())
+			status.LastError = err.Error()
+			return nil, false, err
+		}
+	}
+
+	// A failing object does not keep the rest of the bundle from being applied
+	s.log.Info("Received objects ", "Count: ", len(bundle.Objects))
+	var refs []apply.Ref
+	var errs []error
+	for _, obj := range applyOrder(bundle.Objects) {
+		ref, err := s.applier.Apply(owner, apply.FieldManager(channel.Name), obj)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		status.LastError = err.Error()
+		return nil, false, err
+	}
+
+	status.InstalledVersion = channel.Version
+	status.LastError = ""
+	return refs, false, nil
+}
+
+// kindOrder ranks the kinds other objects depend on, these are applied first: namespaces, the
+// definitions of custom resources and the RBAC resources workloads run with.
+var kindOrder = map[string]int{
+	"Namespace":                1,
+	"CustomResourceDefinition": 2,
+	"ServiceAccount":           3,
+	"ClusterRole":              3,
+	"ClusterRoleBinding":       3,
+	"Role":                     3,
+	"RoleBinding":              3,
+}
+
+// applyOrder returns objects sorted by kindOrder, all other kinds last. Objects of the same rank
+// keep their order in the bundle.
+func applyOrder(objects []runtime.Object) []runtime.Object {
+	rank := func(obj runtime.Object) int {
+		if r, ok := kindOrder[obj.GetObjectKind().GroupVersionKind().Kind]; ok {
+			return r
+		}
+		return len(kindOrder)
+	}
+
+	sorted := append([]runtime.Object{}, objects...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return rank(sorted[i]) < rank(sorted[j])
+	})
+	return sorted
+}
+
+// checkScope returns a ScopeError naming the objects not applied to the namespace of owner.
+func (s *Syncer) checkScope(owner metav1.Object, objects []runtime.Object) error {
+	var outside []string
+	for _, obj := range objects {
+		namespace, err := s.applier.Namespace(owner, obj)
+		if err != nil {
+			return err
+		}
+		if namespace == owner.GetNamespace() {
+			continue
+		}
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return fmt.Errorf("Error accessing object metadata: %s", err)
+		}
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		if namespace == "" {
+			outside = append(outside, fmt.Sprintf("cluster-scoped %s %s", kind, accessor.GetName()))
+		} else {
+			outside = append(outside, fmt.Sprintf("%s %s/%s", kind, namespace, accessor.GetName()))
+		}
+	}
+	if len(outside) == 0 {
+		return nil
+	}
+	return &ScopeError{Message: fmt.Sprintf("objects outside of namespace %s: %s", owner.GetNamespace(), strings.Join(outside, ", "))}
+}
+
+// skippedFiles returns skipped shortened to maxSkippedFiles entries and a final one counting the rest.
+func skippedFiles(skipped []string) []string {
+	if len(skipped) <= maxSkippedFiles {
+		return skipped
+	}
+	files := append([]string{}, skipped[:maxSkippedFiles]...)
+	return append(files, fmt.Sprintf("... and %d more", len(skipped)-maxSkippedFiles))
+}
@@ -0,0 +1,36 @@
+package channels
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestApplyOrder(t *testing.T) {
+	object := func(kind, name string) runtime.Object {
+		u := &unstructured.Unstructured{}
+		u.SetKind(kind)
+		u.SetName(name)
+		return u
+	}
+
+	objects := []runtime.Object{
+		object("Deployment", "deployment"),
+		object("Widget", "widget"),
+		object("RoleBinding", "rolebinding"),
+		object("CustomResourceDefinition", "crd"),
+		object("Service", "service"),
+		object("Role", "role"),
+		object("Namespace", "namespace"),
+	}
+
+	want := []string{"namespace", "crd", "rolebinding", "role", "deployment", "widget", "service"}
+	if diff := cmp.Diff(want, names(t, applyOrder(objects))); diff != "" {
+		t.Errorf("got order diff (-want, +got): %s", diff)
+	}
+	if got := names(t, objects); got[0] != "deployment" {
+		t.Errorf("got objects of bundle reordered: %v", got)
+	}
+}
@@ -0,0 +1,105 @@
+package channels
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CABundles are the PEM encoded CA bundles trusted in addition to the system roots. They are
+// passed to NewHTTPClient and, along with the system roots, to git.
+var CABundles [][]byte
+
+// FetchTimeout bounds each request fetching a channel, including reading its response, and
+// each git command run for a channel, thus an unresponsive server does not stall the sync.
+var FetchTimeout = 5 * time.Minute
+
+// NewHTTPClient returns the client channels are fetched with by default. Server certificates
+// are verified against the system roots and the given PEM encoded CA bundles. Requests time
+// out after FetchTimeout.
+func NewHTTPClient(caBundles ...[]byte) (*http.Client, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	for _, bundle := range caBundles {
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("Error parsing CA bundle: no certificates found")
+		}
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: tr, Timeout: FetchTimeout}, nil
+}
+
+// httpClientFor returns the client to fetch channel with. Channels without TLS settings
+// share base, all others get a client of their own trusting the channel's CA instead of
+// the default ones and presenting its client certificate.
+func httpClientFor(ctx context.Context, c client.Client, namespace string, base *http.Client, channel v1alpha1.OperatorChannel) (*http.Client, error) {
+	spec := channel.TLS
+	if spec == nil {
+		return base, nil
+	}
+
+	tr, ok := base.Transport.(*http.Transport)
+	if !ok || tr == nil {
+		tr = http.DefaultTransport.(*http.Transport)
+	}
+	tr = tr.Clone()
+	// Per channel transports are not reused, their connections must not outlive the sync
+	tr.DisableKeepAlives = true
+
+	conf := &tls.Config{}
+	if tr.TLSClientConfig != nil {
+		conf = tr.TLSClientConfig.Clone()
+	}
+	tr.TLSClientConfig = conf
+
+	if spec.CA != nil {
+		ca, err := loadKey(ctx, c, namespace, *spec.CA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("Error parsing CA bundle of channel %s: no certificates found", channel.Name)
+		}
+		conf.RootCAs = pool
+	}
+
+	if spec.ClientCertSecretRef != nil {
+		certPEM, keyPEM, err := loadClientCert(ctx, c, namespace, spec.ClientCertSecretRef.Name)
+		if err != nil {
+			return nil, err
+		}
+		cert, _ := tls.X509KeyPair(certPEM, keyPEM)
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	conf.InsecureSkipVerify = spec.InsecureSkipTLSVerify
+
+	return &http.Client{Transport: tr, Timeout: base.Timeout}, nil
+}
+
+// loadClientCert reads the PEM encoded certificate and key of the kubernetes.io/tls Secret name.
+func loadClientCert(ctx context.Context, c client.Client, namespace, name string) ([]byte, []byte, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Name: name, Namespace: namespace}
+	if err := c.Get(ctx, key, secret); err != nil {
+		return nil, nil, fmt.Errorf("Error loading client certificate from secret %s: %s", name, err)
+	}
+	certPEM, keyPEM := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return nil, nil, fmt.Errorf("Error parsing client certificate of secret %s: %s", name, err)
+	}
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,215 @@
+package channels
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// newTestCert returns a self-signed certificate and its key, both PEM encoded.
+func newTestCert(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "nop-operator"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func serverCA(ts *httptest.Server) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	tests := []struct {
+		desc       string
+		bundles    [][]byte
+		wantErr    bool
+		wantGetErr bool
+	}{
+		{desc: "system roots only", wantGetErr: true},
+		{desc: "trusted ca bundle", bundles: [][]byte{serverCA(ts)}},
+		{desc: "broken ca bundle", bundles: [][]byte{[]byte("broken")}, wantErr: true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			c, err := NewHTTPClient(test.bundles...)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error: %v, want error: %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			resp, err := c.Get(ts.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != test.wantGetErr {
+				t.Errorf("got error: %v, want error: %t", err, test.wantGetErr)
+			}
+		})
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	defer func(d time.Duration) { FetchTimeout = d }(FetchTimeout)
+	FetchTimeout = 100 * time.Millisecond
+
+	// Never answers until the test is done
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	c, err := NewHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Get(ts.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("want timeout but got response")
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	cache, err := ioutil.TempDir("", "git-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+	GitCacheDir = cache
+
+	channel := v1alpha1.OperatorChannel{Name: "a-operator", ChannelSpec: v1alpha1.ChannelSpec{URL: "git+" + ts.URL + "/a-operator.git"}}
+	_, _, err = newGitReader(nil, logf.Log, channel, ReaderOptions{}).Read()
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("got error %v, want git timed out", err)
+	}
+}
+
+func TestHTTPClientFor(t *testing.T) {
+	certPEM, keyPEM := newTestCert(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(certPEM)
+
+	// Requires a client certificate signed by itself
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	ts.StartTLS()
+	defer ts.Close()
+
+	_, otherKeyPEM := newTestCert(t)
+	objs := []runtime.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "repo-ca", Namespace: "team-a"},
+			Data:       map[string][]byte{"ca.crt": serverCA(ts)},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "repo-client", Namespace: "team-a"},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "broken-client", Namespace: "team-a"},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: otherKeyPEM},
+		},
+	}
+	c := fake.NewFakeClientWithScheme(scheme.Scheme, objs...)
+
+	ca := &v1alpha1.KeySource{
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "repo-ca"},
+			Key:                  "ca.crt",
+		},
+	}
+	clientCert := &corev1.LocalObjectReference{Name: "repo-client"}
+
+	tests := []struct {
+		desc       string
+		tls        *v1alpha1.TLSSpec
+		wantErr    bool
+		wantGetErr bool
+	}{
+		{desc: "default client", wantGetErr: true},
+		{desc: "channel ca without client certificate", tls: &v1alpha1.TLSSpec{CA: ca}, wantGetErr: true},
+		{desc: "channel ca and client certificate", tls: &v1alpha1.TLSSpec{CA: ca, ClientCertSecretRef: clientCert}},
+		{desc: "insecure with client certificate", tls: &v1alpha1.TLSSpec{InsecureSkipTLSVerify: true, ClientCertSecretRef: clientCert}},
+		{desc: "missing client certificate secret", tls: &v1alpha1.TLSSpec{ClientCertSecretRef: &corev1.LocalObjectReference{Name: "missing"}}, wantErr: true},
+		{desc: "mismatching client key", tls: &v1alpha1.TLSSpec{ClientCertSecretRef: &corev1.LocalObjectReference{Name: "broken-client"}}, wantErr: true},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			base, err := NewHTTPClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			channel := v1alpha1.OperatorChannel{Name: "a-operator", ChannelSpec: v1alpha1.ChannelSpec{TLS: test.tls}}
+
+			hc, err := httpClientFor(context.TODO(), c, "team-a", base, channel)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error: %v, want error: %t", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if test.tls == nil && hc != base {
+				t.Error("got new client for channel without TLS settings, want the default one")
+			}
+
+			resp, err := hc.Get(ts.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != test.wantGetErr {
+				t.Errorf("got error: %v, want error: %t", err, test.wantGetErr)
+			}
+		})
+	}
+}
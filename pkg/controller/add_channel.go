@@ -0,0 +1,10 @@
+package controller
+
+import (
+	"github.com/periklis/nop-operator/pkg/controller/channel"
+)
+
+func init() {
+	// AddToManagerFuncs is a list of functions to create controllers and add them to a manager.
+	AddToManagerFuncs = append(AddToManagerFuncs, channel.Add)
+}
@@ -0,0 +1,214 @@
+package channel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	operatorsv1alpha1 "github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	"github.com/periklis/nop-operator/pkg/apply"
+	"github.com/periklis/nop-operator/pkg/channels"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var log = logf.Log.WithName("controller_channel")
+
+// kind is the kind of the objects reconciled by this controller.
+const kind = "Channel"
+
+// Add creates a new Channel Controller and adds it to the Manager. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+func Add(mgr manager.Manager, client *http.Client) error {
+	r, err := newReconciler(mgr, client)
+	if err != nil {
+		return err
+	}
+	return add(mgr, r)
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager, client *http.Client) (reconcile.Reconciler, error) {
+	dc, err := dynamic.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, fmt.Errorf("Error creating dynamic client: %s", err)
+	}
+	disco, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, fmt.Errorf("Error creating discovery client: %s", err)
+	}
+
+	return &ReconcileChannel{
+		client:     mgr.GetClient(),
+		scheme:     mgr.GetScheme(),
+		httpClient: client,
+		applier:    apply.NewApplier(dc, mgr.GetRESTMapper(), mgr.GetScheme(), log),
+		cluster:    disco,
+	}, nil
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("channel-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to primary resource Channel. Status updates written
+	// by the reconciler itself do not change the generation and are skipped.
+	err = c.Watch(&source.Kind{Type: &operatorsv1alpha1.Channel{}}, &handler.EnqueueRequestForObject{}, predicate.GenerationChangedPredicate{})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to Secrets and ConfigMaps referenced by Channels, e.g. rotated credentials
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: referencingChannels(mgr.GetClient(), channels.SecretNames),
+	})
+	if err != nil {
+		return err
+	}
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: referencingChannels(mgr.GetClient(), channels.ConfigMapNames),
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// referencingChannels maps a Secret or ConfigMap to the Channels in its namespace referencing
+// it according to names.
+func referencingChannels(c client.Client, names func(operatorsv1alpha1.ChannelSpec) []string) handler.ToRequestsFunc {
+	return func(o handler.MapObject) []reconcile.Request {
+		list := &operatorsv1alpha1.ChannelList{}
+		if err := c.List(context.TODO(), list, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+			log.Error(err, "Error listing Channels referencing object", "Name", o.Meta.GetName())
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for _, ch := range list.Items {
+			for _, name := range names(ch.Spec) {
+				if name == o.Meta.GetName() {
+					requests = append(requests, reconcile.Request{
+						NamespacedName: types.NamespacedName{Name: ch.Name, Namespace: ch.Namespace},
+					})
+					break
+				}
+			}
+		}
+		return requests
+	}
+}
+
+// blank assignment to verify that ReconcileChannel implements reconcile.Reconciler
+var _ reconcile.Reconciler = &ReconcileChannel{}
+
+// ReconcileChannel reconciles a Channel object
+type ReconcileChannel struct {
+	// This client, initialized using mgr.Client() above, is a split client
+	// that reads objects from the cache and writes to the apiserver
+	client     client.Client
+	scheme     *runtime.Scheme
+	httpClient *http.Client
+	applier    *apply.Applier
+	// cluster reports the Kubernetes version and API groups served, to check the requirements of bundles
+	cluster channels.ClusterInfo
+}
+
+// Reconcile installs the operator shipped by a Channel in the version of its spec, prunes
+// objects dropped from the channel and reports the outcome in the Channel's status.
+// Note:
+// The Controller will requeue the Request to be processed again if the returned error is non-nil or
+// Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
+func (r *ReconcileChannel) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	reqLogger := log.WithValues("Request.Namespace", request.Namespace, "Request.Name", request.Name)
+	reqLogger.Info("Reconciling Channel")
+
+	ctx := context.TODO()
+
+	// Fetch the Channel instance
+	instance := &operatorsv1alpha1.Channel{}
+	err := r.client.Get(ctx, request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// Request object not found, it was deleted after the finalizer pruned its objects.
+			// Return and don't requeue
+			return reconcile.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		return reconcile.Result{}, err
+	}
+
+	// Only objects in the namespace of the Channel are garbage collected along with it, its
+	// finalizer prunes all others recorded in its inventory before it is released.
+	if instance.GetDeletionTimestamp() != nil {
+		return reconcile.Result{}, r.applier.Finalize(ctx, r.client, kind, instance)
+	}
+	if apply.AddFinalizer(instance) {
+		if err := r.client.Update(ctx, instance); err != nil {
+			return reconcile.Result{}, fmt.Errorf("Error adding finalizer: %s", err)
+		}
+	}
+
+	prev, err := apply.LoadInventory(ctx, r.client, kind, instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	op := operatorsv1alpha1.OperatorChannel{Name: instance.Name, ChannelSpec: instance.Spec}
+	status := instance.Status.OperatorChannelStatus.DeepCopy()
+
+	// Anyone allowed to create a Channel in a namespace must not reach beyond it through the
+	// operator's service account
+	syncer := channels.NewSyncer(r.httpClient, r.client, r.cluster, r.applier, log)
+	syncer.Namespaced = true
+	refs, shouldRequeue, syncErr := syncer.Sync(instance, op, status)
+
+	// A failing channel keeps its objects until it succeeds again
+	var pruneErr error
+	if syncErr == nil {
+		applied := apply.Inventory{instance.Name: refs}
+		if err := r.applier.Prune(prev.Stale(applied)); err != nil {
+			pruneErr = err
+		} else if err := apply.SaveInventory(ctx, r.client, r.scheme, kind, instance, applied); err != nil {
+			pruneErr = err
+		}
+		if pruneErr != nil {
+			status.LastError = pruneErr.Error()
+		}
+	}
+
+	channels.SetConditions(status, instance.Generation, syncErr)
+	instance.Status.ObservedGeneration = instance.Generation
+	instance.Status.OperatorChannelStatus = *status
+	if err := r.client.Status().Update(ctx, instance); err != nil {
+		return reconcile.Result{}, fmt.Errorf("Error updating status: %s", err)
+	}
+
+	// Blocked channels wait for an approval, i.e. a spec change, or a new version in their
+	// index. Tampered archives are not fetched again until the channel changes or its index
+	// is polled again.
+	if channels.IsPermanent(syncErr) {
+		syncErr = nil
+	}
+
+	// Channels following an index are polled for new versions
+	result := reconcile.Result{Requeue: shouldRequeue, RequeueAfter: channels.PollInterval(instance.Spec)}
+	return result, utilerrors.NewAggregate([]error{syncErr, pruneErr})
+}
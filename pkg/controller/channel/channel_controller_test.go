@@ -0,0 +1,900 @@
+package channel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	operatorsv1alpha1 "github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	"github.com/periklis/nop-operator/pkg/apply"
+	"github.com/periklis/nop-operator/pkg/channels"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var logt = logf.Log.WithName("channel-controller-test")
+
+func newTestHttpServer(statusCode int, archive string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+		if archive != "" {
+			http.ServeFile(w, r, archive)
+		}
+	}))
+}
+
+func newTestApplier(s *runtime.Scheme, objs ...runtime.Object) (*apply.Applier, *dynamicfake.FakeDynamicClient) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ServiceAccount"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "Role"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+
+	// Server-side apply is rejected like by an apiserver without the ServerSideApply feature
+	dc := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objs...)
+	dc.PrependReactor("patch", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		pa := action.(clienttesting.PatchAction)
+		if pa.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		gr := pa.GetResource().GroupResource()
+		return true, nil, errors.NewGenericServerResponse(http.StatusUnsupportedMediaType, "patch", gr, pa.GetName(), "", 0, false)
+	})
+	return apply.NewApplier(dc, mapper, s, logt), dc
+}
+
+func TestReconcile(t *testing.T) {
+	scheme := scheme.Scheme
+	operatorsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	tests := []struct {
+		desc          string
+		statusCode    int
+		archive       string
+		wantErr       bool
+		want          reconcile.Result
+		wantInstalled string
+		wantObjects   int
+		wantReady     corev1.ConditionStatus
+		wantDegraded  corev1.ConditionStatus
+	}{
+		{
+			desc:          "reconcile success with valid archive",
+			statusCode:    http.StatusOK,
+			archive:       "./testdata/manifests.tar.gz",
+			want:          reconcile.Result{},
+			wantInstalled: "1.2.3",
+			wantObjects:   4,
+			wantReady:     corev1.ConditionTrue,
+			wantDegraded:  corev1.ConditionFalse,
+		},
+		{
+			desc:         "reconcile with requeue empty archive",
+			statusCode:   http.StatusOK,
+			wantErr:      true,
+			want:         reconcile.Result{Requeue: true},
+			wantReady:    corev1.ConditionFalse,
+			wantDegraded: corev1.ConditionTrue,
+		},
+		{
+			desc:         "reconcile failure channel server error",
+			statusCode:   http.StatusInternalServerError,
+			wantErr:      true,
+			want:         reconcile.Result{},
+			wantReady:    corev1.ConditionFalse,
+			wantDegraded: corev1.ConditionTrue,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			ts := newTestHttpServer(test.statusCode, test.archive)
+			defer ts.Close()
+
+			channel := &operatorsv1alpha1.Channel{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "a-operator",
+					Namespace:  "team-a",
+					Generation: 1,
+				},
+				Spec: operatorsv1alpha1.ChannelSpec{
+					URL:     ts.URL,
+					Version: "1.2.3",
+				},
+			}
+
+			cs := fake.NewFakeClientWithScheme(scheme, channel)
+			applier, _ := newTestApplier(scheme)
+			rc := &ReconcileChannel{
+				client:     cs,
+				scheme:     scheme,
+				httpClient: ts.Client(),
+				applier:    applier,
+			}
+
+			key := types.NamespacedName{Name: channel.Name, Namespace: channel.Namespace}
+			got, err := rc.Reconcile(reconcile.Request{NamespacedName: key})
+			if test.wantErr != (err != nil) {
+				t.Errorf("got err: %v, want err: %t", err, test.wantErr)
+			}
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("got diff: %s", diff)
+			}
+
+			instance := &operatorsv1alpha1.Channel{}
+			if err := cs.Get(context.TODO(), key, instance); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(instance.Finalizers, []string{apply.Finalizer}); diff != "" {
+				t.Errorf("got finalizers diff: %s", diff)
+			}
+			status := instance.Status
+			if status.ObservedGeneration != 1 || status.DesiredVersion != "1.2.3" {
+				t.Errorf("got observed generation %d and desired version %q", status.ObservedGeneration, status.DesiredVersion)
+			}
+			if status.InstalledVersion != test.wantInstalled || status.ObjectCount != test.wantObjects {
+				t.Errorf("got installed version %q with %d objects, want %q with %d objects",
+					status.InstalledVersion, status.ObjectCount, test.wantInstalled, test.wantObjects)
+			}
+			if (status.LastError != "") != test.wantErr {
+				t.Errorf("got last error: %q", status.LastError)
+			}
+			for ct, want := range map[operatorsv1alpha1.ConditionType]corev1.ConditionStatus{
+				operatorsv1alpha1.ConditionReady:    test.wantReady,
+				operatorsv1alpha1.ConditionDegraded: test.wantDegraded,
+			} {
+				c := operatorsv1alpha1.FindCondition(status.Conditions, ct)
+				if c == nil || c.Status != want {
+					t.Errorf("got condition %s: %v, want status: %s", ct, c, want)
+				}
+			}
+
+			inv, err := apply.LoadInventory(context.TODO(), cs, kind, instance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(inv[channel.Name]) != test.wantObjects {
+				t.Errorf("got %d inventory entries, want %d", len(inv[channel.Name]), test.wantObjects)
+			}
+		})
+	}
+}
+
+func TestReconcileIndex(t *testing.T) {
+	scheme := scheme.Scheme
+	operatorsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	index := "channels:\n  stable:\n  - version: 1.2.3\n    url: a-operator-1.2.3.tar.gz\n  - version: 1.1.0\n    url: a-operator-1.1.0.tar.gz\n"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/index.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(index))
+	})
+	mux.HandleFunc("/a-operator-1.2.3.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./testdata/manifests.tar.gz")
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	channel := &operatorsv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "a-operator",
+			Namespace: "team-a",
+		},
+		Spec: operatorsv1alpha1.ChannelSpec{
+			Index:        ts.URL + "/index.yaml",
+			Channel:      "stable",
+			PollInterval: &metav1.Duration{Duration: time.Minute},
+		},
+	}
+
+	cs := fake.NewFakeClientWithScheme(scheme, channel)
+	applier, _ := newTestApplier(scheme)
+	rc := &ReconcileChannel{
+		client:     cs,
+		scheme:     scheme,
+		httpClient: ts.Client(),
+		applier:    applier,
+	}
+
+	key := types.NamespacedName{Name: channel.Name, Namespace: channel.Namespace}
+	got, err := rc.Reconcile(reconcile.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if diff := cmp.Diff(got, reconcile.Result{RequeueAfter: time.Minute}); diff != "" {
+		t.Errorf("got diff: %s", diff)
+	}
+
+	instance := &operatorsv1alpha1.Channel{}
+	if err := cs.Get(context.TODO(), key, instance); err != nil {
+		t.Fatal(err)
+	}
+	if instance.Status.DesiredVersion != "1.2.3" || !instance.Status.IsReady() {
+		t.Errorf("got desired version %q, installed version %q, last error %q",
+			instance.Status.DesiredVersion, instance.Status.InstalledVersion, instance.Status.LastError)
+	}
+
+	// A new major version is reported, but not installed until approved
+	index += "  - version: 2.0.0\n    url: a-operator-2.0.0.tar.gz\n"
+	if _, err := rc.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if err := cs.Get(context.TODO(), key, instance); err != nil {
+		t.Fatal(err)
+	}
+	if instance.Status.DesiredVersion != "1.2.3" || !instance.Status.IsReady() {
+		t.Errorf("got desired version %q, installed version %q, last error %q, want 1.2.3 kept",
+			instance.Status.DesiredVersion, instance.Status.InstalledVersion, instance.Status.LastError)
+	}
+	c := operatorsv1alpha1.FindCondition(instance.Status.Conditions, operatorsv1alpha1.ConditionUpgradeAvailable)
+	if c == nil || c.Status != corev1.ConditionTrue || !strings.Contains(c.Message, "2.0.0") {
+		t.Errorf("got condition %s: %v, want 2.0.0 available", operatorsv1alpha1.ConditionUpgradeAvailable, c)
+	}
+	if operatorsv1alpha1.IsConditionTrue(instance.Status.Conditions, operatorsv1alpha1.ConditionBlocked) {
+		t.Error("got channel blocked, want it to stay on its major version")
+	}
+}
+
+func TestReconcileBlocked(t *testing.T) {
+	scheme := scheme.Scheme
+	operatorsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	ts := newTestHttpServer(http.StatusOK, "./testdata/manifests.tar.gz")
+	defer ts.Close()
+
+	tests := []struct {
+		desc          string
+		approved      string
+		wantInstalled string
+		wantBlocked   corev1.ConditionStatus
+	}{
+		{
+			desc:          "major upgrade without approval",
+			wantInstalled: "1.2.3",
+			wantBlocked:   corev1.ConditionTrue,
+		},
+		{
+			desc:          "major upgrade with approval",
+			approved:      "2.0.0",
+			wantInstalled: "2.0.0",
+			wantBlocked:   corev1.ConditionFalse,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			channel := &operatorsv1alpha1.Channel{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "a-operator",
+					Namespace: "team-a",
+				},
+				Spec: operatorsv1alpha1.ChannelSpec{
+					URL:             ts.URL,
+					Version:         "2.0.0",
+					ApprovedVersion: test.approved,
+				},
+				Status: operatorsv1alpha1.ChannelStatus{
+					OperatorChannelStatus: operatorsv1alpha1.OperatorChannelStatus{
+						Name:             "a-operator",
+						DesiredVersion:   "1.2.3",
+						InstalledVersion: "1.2.3",
+					},
+				},
+			}
+
+			cs := fake.NewFakeClientWithScheme(scheme, channel)
+			applier, dc := newTestApplier(scheme)
+			rc := &ReconcileChannel{
+				client:     cs,
+				scheme:     scheme,
+				httpClient: ts.Client(),
+				applier:    applier,
+			}
+
+			key := types.NamespacedName{Name: channel.Name, Namespace: channel.Namespace}
+			got, err := rc.Reconcile(reconcile.Request{NamespacedName: key})
+			if err != nil {
+				t.Fatalf("got unexpected error: %s", err)
+			}
+			if diff := cmp.Diff(got, reconcile.Result{}); diff != "" {
+				t.Errorf("got diff: %s", diff)
+			}
+
+			instance := &operatorsv1alpha1.Channel{}
+			if err := cs.Get(context.TODO(), key, instance); err != nil {
+				t.Fatal(err)
+			}
+			if instance.Status.InstalledVersion != test.wantInstalled {
+				t.Errorf("got installed version: %q, want installed version: %q", instance.Status.InstalledVersion, test.wantInstalled)
+			}
+			c := operatorsv1alpha1.FindCondition(instance.Status.Conditions, operatorsv1alpha1.ConditionBlocked)
+			if c == nil || c.Status != test.wantBlocked {
+				t.Errorf("got condition %s: %v, want status: %s", operatorsv1alpha1.ConditionBlocked, c, test.wantBlocked)
+			}
+			if test.wantBlocked == corev1.ConditionTrue && len(dc.Actions()) > 0 {
+				t.Errorf("got %d actions on blocked channel, want none", len(dc.Actions()))
+			}
+		})
+	}
+}
+
+func TestReconcileDigestMismatch(t *testing.T) {
+	scheme := scheme.Scheme
+	operatorsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	ts := newTestHttpServer(http.StatusOK, "./testdata/manifests.tar.gz")
+	defer ts.Close()
+
+	channel := &operatorsv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "a-operator",
+			Namespace: "team-a",
+		},
+		Spec: operatorsv1alpha1.ChannelSpec{
+			URL:     ts.URL,
+			Version: "1.2.3",
+			SHA256:  "0000000000000000000000000000000000000000000000000000000000000000",
+		},
+	}
+
+	cs := fake.NewFakeClientWithScheme(scheme, channel)
+	applier, dc := newTestApplier(scheme)
+	rc := &ReconcileChannel{
+		client:     cs,
+		scheme:     scheme,
+		httpClient: ts.Client(),
+		applier:    applier,
+	}
+
+	key := types.NamespacedName{Name: channel.Name, Namespace: channel.Namespace}
+	got, err := rc.Reconcile(reconcile.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if diff := cmp.Diff(got, reconcile.Result{}); diff != "" {
+		t.Errorf("got diff: %s", diff)
+	}
+	if len(dc.Actions()) > 0 {
+		t.Errorf("got %d actions for tampered archive, want none", len(dc.Actions()))
+	}
+
+	instance := &operatorsv1alpha1.Channel{}
+	if err := cs.Get(context.TODO(), key, instance); err != nil {
+		t.Fatal(err)
+	}
+	for ct, want := range map[operatorsv1alpha1.ConditionType]corev1.ConditionStatus{
+		operatorsv1alpha1.ConditionVerified: corev1.ConditionFalse,
+		operatorsv1alpha1.ConditionDegraded: corev1.ConditionTrue,
+		operatorsv1alpha1.ConditionReady:    corev1.ConditionFalse,
+	} {
+		c := operatorsv1alpha1.FindCondition(instance.Status.Conditions, ct)
+		if c == nil || c.Status != want || c.Reason != "DigestMismatch" {
+			t.Errorf("got condition %s: %v, want status %s with reason DigestMismatch", ct, c, want)
+		}
+	}
+}
+
+func TestReconcileUnsigned(t *testing.T) {
+	scheme := scheme.Scheme
+	operatorsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	// Serves the archive without a detached signature next to it
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/a-operator.tar.gz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeFile(w, r, "./testdata/manifests.tar.gz")
+	}))
+	defer ts.Close()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "signing-keys", Namespace: "team-a"},
+		Data:       map[string]string{"a-operator.pem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))},
+	}
+
+	channel := &operatorsv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "a-operator",
+			Namespace: "team-a",
+		},
+		Spec: operatorsv1alpha1.ChannelSpec{
+			URL:     ts.URL + "/a-operator.tar.gz",
+			Version: "1.2.3",
+			Signature: &operatorsv1alpha1.SignatureSpec{
+				PublicKey: operatorsv1alpha1.KeySource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "signing-keys"},
+						Key:                  "a-operator.pem",
+					},
+				},
+			},
+		},
+	}
+
+	cs := fake.NewFakeClientWithScheme(scheme, channel, keys)
+	applier, dc := newTestApplier(scheme)
+	rc := &ReconcileChannel{
+		client:     cs,
+		scheme:     scheme,
+		httpClient: ts.Client(),
+		applier:    applier,
+	}
+
+	key := types.NamespacedName{Name: channel.Name, Namespace: channel.Namespace}
+	if _, err := rc.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if len(dc.Actions()) > 0 {
+		t.Errorf("got %d actions for unsigned archive, want none", len(dc.Actions()))
+	}
+
+	instance := &operatorsv1alpha1.Channel{}
+	if err := cs.Get(context.TODO(), key, instance); err != nil {
+		t.Fatal(err)
+	}
+	for ct, want := range map[operatorsv1alpha1.ConditionType]corev1.ConditionStatus{
+		operatorsv1alpha1.ConditionVerified: corev1.ConditionFalse,
+		operatorsv1alpha1.ConditionDegraded: corev1.ConditionTrue,
+		operatorsv1alpha1.ConditionReady:    corev1.ConditionFalse,
+	} {
+		c := operatorsv1alpha1.FindCondition(instance.Status.Conditions, ct)
+		if c == nil || c.Status != want || c.Reason != "SignatureMissing" {
+			t.Errorf("got condition %s: %v, want status %s with reason SignatureMissing", ct, c, want)
+		}
+	}
+}
+
+func TestReconcileConfigMapSource(t *testing.T) {
+	scheme := scheme.Scheme
+	operatorsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	archive, err := ioutil.ReadFile("./testdata/manifests.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "a-operator-manifests", Namespace: "team-a"},
+		BinaryData: map[string][]byte{"manifests.tar.gz": archive},
+	}
+	channel := &operatorsv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "a-operator",
+			Namespace: "team-a",
+		},
+		Spec: operatorsv1alpha1.ChannelSpec{
+			Source: &operatorsv1alpha1.SourceSpec{
+				ConfigMap: &operatorsv1alpha1.ObjectSource{Name: source.Name, Key: "manifests.tar.gz"},
+			},
+		},
+	}
+
+	cs := fake.NewFakeClientWithScheme(scheme, channel, source)
+	applier, _ := newTestApplier(scheme)
+	rc := &ReconcileChannel{
+		client:     cs,
+		scheme:     scheme,
+		httpClient: http.DefaultClient,
+		applier:    applier,
+	}
+
+	key := types.NamespacedName{Name: channel.Name, Namespace: channel.Namespace}
+	if _, err := rc.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	instance := &operatorsv1alpha1.Channel{}
+	if err := cs.Get(context.TODO(), key, instance); err != nil {
+		t.Fatal(err)
+	}
+	status := instance.Status
+	if !status.IsReady() || status.InstalledVersion != status.Digest || status.ObjectCount == 0 {
+		t.Errorf("got status %+v, want channel installed in the version of its digest", status.OperatorChannelStatus)
+	}
+
+	// Updating the ConfigMap reconciles the Channel again
+	got := referencingChannels(cs, channels.ConfigMapNames)(handler.MapObject{Meta: &source.ObjectMeta})
+	want := []reconcile.Request{{NamespacedName: key}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got diff: %s", diff)
+	}
+}
+
+func TestReconcileUnversioned(t *testing.T) {
+	scheme := scheme.Scheme
+	operatorsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	ts := newTestHttpServer(http.StatusOK, "./testdata/manifests.tar.gz")
+	defer ts.Close()
+
+	channel := &operatorsv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "a-operator",
+			Namespace: "team-a",
+		},
+		Spec: operatorsv1alpha1.ChannelSpec{URL: ts.URL},
+	}
+
+	cs := fake.NewFakeClientWithScheme(scheme, channel)
+	applier, _ := newTestApplier(scheme)
+	rc := &ReconcileChannel{
+		client:     cs,
+		scheme:     scheme,
+		httpClient: ts.Client(),
+		applier:    applier,
+	}
+
+	key := types.NamespacedName{Name: channel.Name, Namespace: channel.Namespace}
+	if _, err := rc.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	instance := &operatorsv1alpha1.Channel{}
+	if err := cs.Get(context.TODO(), key, instance); err != nil {
+		t.Fatal(err)
+	}
+	status := instance.Status
+	if !status.IsReady() || status.InstalledVersion == "" || status.InstalledVersion != status.Digest || status.DesiredVersion != status.Digest {
+		t.Errorf("got status %+v, want URL channel without version installed in the version of its digest", status.OperatorChannelStatus)
+	}
+}
+
+func TestReconcileSkippedFiles(t *testing.T) {
+	scheme := scheme.Scheme
+	operatorsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "a-operator-manifests", Namespace: "team-a"},
+		Data: map[string]string{
+			"sa.yaml":   "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: a-operator\n",
+			"README.md": "# a-operator\n",
+		},
+	}
+	channel := &operatorsv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "a-operator",
+			Namespace: "team-a",
+		},
+		Spec: operatorsv1alpha1.ChannelSpec{
+			Source: &operatorsv1alpha1.SourceSpec{
+				ConfigMap: &operatorsv1alpha1.ObjectSource{Name: source.Name},
+			},
+		},
+	}
+
+	cs := fake.NewFakeClientWithScheme(scheme, channel, source)
+	applier, _ := newTestApplier(scheme)
+	rc := &ReconcileChannel{
+		client:     cs,
+		scheme:     scheme,
+		httpClient: http.DefaultClient,
+		applier:    applier,
+	}
+
+	key := types.NamespacedName{Name: channel.Name, Namespace: channel.Namespace}
+	if _, err := rc.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	instance := &operatorsv1alpha1.Channel{}
+	if err := cs.Get(context.TODO(), key, instance); err != nil {
+		t.Fatal(err)
+	}
+	status := instance.Status
+	if !status.IsReady() || status.ObjectCount != 1 {
+		t.Errorf("got status %+v, want channel installed with one object", status.OperatorChannelStatus)
+	}
+	if diff := cmp.Diff(status.SkippedFiles, []string{"README.md"}); diff != "" {
+		t.Errorf("got skipped files diff: %s", diff)
+	}
+}
+
+func TestReconcileBundleMetadata(t *testing.T) {
+	scheme := scheme.Scheme
+	operatorsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	tests := []struct {
+		desc        string
+		metadata    string
+		wantVersion string
+		wantBlocked bool
+	}{
+		{
+			desc:        "matching bundle",
+			metadata:    "name: a-operator\nversion: 1.2.0\ndescription: Installs a-operator\n",
+			wantVersion: "1.2.0",
+		},
+		{
+			desc:        "bundle of another operator",
+			metadata:    "name: b-operator\nversion: 1.2.0\n",
+			wantBlocked: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			source := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "a-operator-manifests", Namespace: "team-a"},
+				Data: map[string]string{
+					"bundle.yaml": test.metadata,
+					"sa.yaml":     "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: a-operator\n",
+				},
+			}
+			channel := &operatorsv1alpha1.Channel{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "a-operator",
+					Namespace: "team-a",
+				},
+				Spec: operatorsv1alpha1.ChannelSpec{
+					Source: &operatorsv1alpha1.SourceSpec{
+						ConfigMap: &operatorsv1alpha1.ObjectSource{Name: source.Name},
+					},
+				},
+			}
+
+			cs := fake.NewFakeClientWithScheme(scheme, channel, source)
+			applier, _ := newTestApplier(scheme)
+			rc := &ReconcileChannel{
+				client:     cs,
+				scheme:     scheme,
+				httpClient: http.DefaultClient,
+				applier:    applier,
+			}
+
+			key := types.NamespacedName{Name: channel.Name, Namespace: channel.Namespace}
+			if _, err := rc.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("got unexpected error: %s", err)
+			}
+
+			instance := &operatorsv1alpha1.Channel{}
+			if err := cs.Get(context.TODO(), key, instance); err != nil {
+				t.Fatal(err)
+			}
+			status := instance.Status
+			if status.Bundle == nil {
+				t.Fatalf("got no bundle metadata in status %+v", status.OperatorChannelStatus)
+			}
+			if got := operatorsv1alpha1.IsConditionTrue(status.Conditions, operatorsv1alpha1.ConditionBlocked); got != test.wantBlocked {
+				t.Errorf("got blocked %t, want %t", got, test.wantBlocked)
+			}
+			if status.InstalledVersion != test.wantVersion {
+				t.Errorf("got installed version %q, want %q", status.InstalledVersion, test.wantVersion)
+			}
+		})
+	}
+}
+
+func TestReconcileOutOfScope(t *testing.T) {
+	scheme := scheme.Scheme
+	operatorsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	tests := []struct {
+		desc     string
+		manifest string
+		wantErr  string
+	}{
+		{
+			desc:     "object in channel namespace",
+			manifest: "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: a-operator\n  namespace: team-a\n",
+		},
+		{
+			desc:     "object in other namespace",
+			manifest: "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: a-operator\n  namespace: kube-system\n",
+			wantErr:  "ServiceAccount kube-system/a-operator",
+		},
+		{
+			desc:     "cluster-scoped object",
+			manifest: "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: a-operator\n",
+			wantErr:  "cluster-scoped ClusterRole a-operator",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			source := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "a-operator-manifests", Namespace: "team-a"},
+				Data: map[string]string{
+					"sa.yaml":     "apiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: a-operator-installer\n",
+					"object.yaml": test.manifest,
+				},
+			}
+			channel := &operatorsv1alpha1.Channel{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "a-operator",
+					Namespace: "team-a",
+				},
+				Spec: operatorsv1alpha1.ChannelSpec{
+					Source: &operatorsv1alpha1.SourceSpec{
+						ConfigMap: &operatorsv1alpha1.ObjectSource{Name: source.Name},
+					},
+				},
+			}
+
+			cs := fake.NewFakeClientWithScheme(scheme, channel, source)
+			applier, dc := newTestApplier(scheme)
+			rc := &ReconcileChannel{
+				client:     cs,
+				scheme:     scheme,
+				httpClient: http.DefaultClient,
+				applier:    applier,
+			}
+
+			// Refused bundles are not retried until the channel changes
+			key := types.NamespacedName{Name: channel.Name, Namespace: channel.Namespace}
+			if _, err := rc.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("got unexpected error: %s", err)
+			}
+
+			instance := &operatorsv1alpha1.Channel{}
+			if err := cs.Get(context.TODO(), key, instance); err != nil {
+				t.Fatal(err)
+			}
+			status := instance.Status
+			degraded := operatorsv1alpha1.FindCondition(status.Conditions, operatorsv1alpha1.ConditionDegraded)
+			if test.wantErr == "" {
+				if !status.IsReady() {
+					t.Errorf("got status %+v, want channel installed", status.OperatorChannelStatus)
+				}
+				return
+			}
+
+			if degraded == nil || degraded.Status != corev1.ConditionTrue || degraded.Reason != "ObjectOutOfScope" || !strings.Contains(degraded.Message, test.wantErr) {
+				t.Errorf("got degraded condition %+v, want reason ObjectOutOfScope naming %q", degraded, test.wantErr)
+			}
+			if status.InstalledVersion != "" {
+				t.Errorf("got installed version %q, want none", status.InstalledVersion)
+			}
+			// Nothing of the bundle is applied, not even the objects in scope
+			for _, action := range dc.Actions() {
+				if action.GetVerb() != "get" {
+					t.Errorf("got action %s %s, want nothing applied", action.GetVerb(), action.GetResource().Resource)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileApplyFailure(t *testing.T) {
+	scheme := scheme.Scheme
+	operatorsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	ts := newTestHttpServer(http.StatusOK, "./testdata/manifests.tar.gz")
+	defer ts.Close()
+
+	channel := &operatorsv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "a-operator",
+			Namespace: "team-a",
+		},
+		Spec: operatorsv1alpha1.ChannelSpec{
+			URL:     ts.URL,
+			Version: "1.2.3",
+		},
+	}
+
+	cs := fake.NewFakeClientWithScheme(scheme, channel)
+	applier, dc := newTestApplier(scheme)
+	dc.PrependReactor("create", "roles", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		gr := action.GetResource().GroupResource()
+		return true, nil, errors.NewForbidden(gr, "a-operator", fmt.Errorf("attempt to grant extra privileges"))
+	})
+	rc := &ReconcileChannel{
+		client:     cs,
+		scheme:     scheme,
+		httpClient: ts.Client(),
+		applier:    applier,
+	}
+
+	key := types.NamespacedName{Name: channel.Name, Namespace: channel.Namespace}
+	if _, err := rc.Reconcile(reconcile.Request{NamespacedName: key}); err == nil {
+		t.Error("want error but got nothing")
+	}
+
+	instance := &operatorsv1alpha1.Channel{}
+	if err := cs.Get(context.TODO(), key, instance); err != nil {
+		t.Fatal(err)
+	}
+	status := instance.Status
+	if status.InstalledVersion != "" || !strings.Contains(status.LastError, "attempt to grant extra privileges") {
+		t.Errorf("got installed version %q and last error %q, want failing Role reported", status.InstalledVersion, status.LastError)
+	}
+
+	// The RBAC resources are applied before the Deployment, the failing Role does not keep the others
+	var created []string
+	for _, action := range dc.Actions() {
+		if action.GetVerb() == "create" {
+			created = append(created, action.GetResource().Resource)
+		}
+	}
+	want := []string{"roles", "rolebindings", "serviceaccounts", "deployments"}
+	if diff := cmp.Diff(want, created); diff != "" {
+		t.Errorf("got created resources diff (-want, +got): %s", diff)
+	}
+}
+
+func TestReconcileDeleted(t *testing.T) {
+	scheme := scheme.Scheme
+	operatorsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	now := metav1.Now()
+	channel := &operatorsv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "a-operator",
+			Namespace:         "team-a",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{apply.Finalizer},
+		},
+		Spec: operatorsv1alpha1.ChannelSpec{
+			URL:     "http://channels.invalid/a-operator.tar.gz",
+			Version: "1.2.3",
+		},
+	}
+	sa := &unstructured.Unstructured{}
+	sa.SetAPIVersion("v1")
+	sa.SetKind("ServiceAccount")
+	sa.SetNamespace("team-a")
+	sa.SetName("a-operator")
+
+	cs := fake.NewFakeClientWithScheme(scheme, channel)
+	applier, dc := newTestApplier(scheme, sa)
+	inv := apply.Inventory{channel.Name: {{Version: "v1", Kind: "ServiceAccount", Namespace: "team-a", Name: "a-operator"}}}
+	if err := apply.SaveInventory(context.TODO(), cs, scheme, kind, channel, inv); err != nil {
+		t.Fatal(err)
+	}
+	rc := &ReconcileChannel{
+		client:     cs,
+		scheme:     scheme,
+		httpClient: http.DefaultClient,
+		applier:    applier,
+	}
+
+	// The channel is not fetched again, its objects are pruned and the channel released
+	key := types.NamespacedName{Name: channel.Name, Namespace: channel.Namespace}
+	if _, err := rc.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"}
+	if _, err := dc.Resource(gvr).Namespace("team-a").Get("a-operator", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("got service account not pruned: %v", err)
+	}
+	instance := &operatorsv1alpha1.Channel{}
+	if err := cs.Get(context.TODO(), key, instance); err != nil {
+		t.Fatal(err)
+	}
+	if len(instance.Finalizers) != 0 {
+		t.Errorf("got finalizers %v, want none", instance.Finalizers)
+	}
+}
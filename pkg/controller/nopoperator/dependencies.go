@@ -0,0 +1,232 @@
+package nopoperator
+
+import (
+	"fmt"
+	"strings"
+
+	operatorsv1alpha1 "github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	"github.com/periklis/nop-operator/pkg/channels"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// Reasons of channels blocked by their dependencies.
+const (
+	reasonDependencyCycle         = "DependencyCycle"
+	reasonUnsatisfiableDependency = "UnsatisfiableDependency"
+)
+
+// dependencyGraph orders the channels of a NopOperator by their dependencies. Channels are
+// identified by their index in the spec.
+type dependencyGraph struct {
+	ops []operatorsv1alpha1.OperatorChannel
+	// index of every channel by its name
+	index map[string]int
+	// deps of every channel, declared by the channel and its bundle
+	deps [][]operatorsv1alpha1.Dependency
+	// dependents of every channel, channels depending on it
+	dependents [][]int
+	// levels of channels installed one after another, every channel depending on channels
+	// of earlier levels only
+	levels [][]int
+	// level of every channel, -1 for channels on or behind a dependency cycle
+	level []int
+	// blocked channels by index, see installOrder
+	blocked map[int]error
+	// unhealthy channels by index, installed but with workloads not yet rolled out
+	unhealthy map[int]string
+}
+
+// newDependencyGraph builds the graph of the channels of instance. Besides their own
+// dependencies, channels depend on the dependencies of their bundle as observed by previous
+// reconciliations, recorded in statuses.
+func newDependencyGraph(instance *operatorsv1alpha1.NopOperator, statuses []operatorsv1alpha1.OperatorChannelStatus) *dependencyGraph {
+	ops := instance.Spec.Operators
+	g := &dependencyGraph{
+		ops:        ops,
+		index:      map[string]int{},
+		deps:       make([][]operatorsv1alpha1.Dependency, len(ops)),
+		dependents: make([][]int, len(ops)),
+		level:      make([]int, len(ops)),
+		blocked:    map[int]error{},
+		unhealthy:  map[int]string{},
+	}
+	for i, op := range ops {
+		g.index[op.Name] = i
+		g.deps[i] = op.Dependencies
+		if md := statuses[i].Bundle; md != nil {
+			g.deps[i] = append(append([]operatorsv1alpha1.Dependency{}, op.Dependencies...), md.Dependencies...)
+		}
+	}
+	g.installOrder()
+	return g
+}
+
+// installOrder sorts the channels topologically into levels. Channels depending on channels
+// unknown to the NopOperator or on versions their dependencies cannot satisfy are blocked
+// with reason UnsatisfiableDependency, channels on or behind a dependency cycle with reason
+// DependencyCycle.
+func (g *dependencyGraph) installOrder() {
+	pending := make([]int, len(g.ops))
+	for i := range g.ops {
+		seen := map[int]bool{}
+		for _, d := range g.deps[i] {
+			if err := g.checkStatic(i, d); err != nil {
+				g.blocked[i] = err
+			}
+			j, ok := g.index[d.Name]
+			if !ok || seen[j] {
+				continue
+			}
+			seen[j] = true
+			pending[i]++
+			g.dependents[j] = append(g.dependents[j], i)
+		}
+	}
+
+	var next []int
+	for i := range g.ops {
+		g.level[i] = -1
+		if pending[i] == 0 {
+			next = append(next, i)
+		}
+	}
+	for len(next) > 0 {
+		level := next
+		next = nil
+		for _, i := range level {
+			g.level[i] = len(g.levels)
+			for _, j := range g.dependents[i] {
+				if pending[j]--; pending[j] == 0 {
+					next = append(next, j)
+				}
+			}
+		}
+		g.levels = append(g.levels, level)
+	}
+
+	for i := range g.ops {
+		if g.level[i] >= 0 {
+			continue
+		}
+		msg := "depends on a dependency cycle"
+		if cycle := g.cycle(i); cycle != nil {
+			msg = fmt.Sprintf("dependency cycle %s", strings.Join(cycle, " -> "))
+		}
+		g.blocked[i] = &channels.BlockedError{Reason: reasonDependencyCycle, Message: msg}
+	}
+}
+
+// checkStatic checks the dependency d of channel i regardless of what is installed. Channels
+// that are not part of the NopOperator and pinned versions not satisfying d's constraint are
+// unsatisfiable.
+func (g *dependencyGraph) checkStatic(i int, d operatorsv1alpha1.Dependency) error {
+	j, ok := g.index[d.Name]
+	if !ok {
+		return &channels.BlockedError{
+			Reason:  reasonUnsatisfiableDependency,
+			Message: fmt.Sprintf("dependency %s is not a channel of this NopOperator", d.Name),
+		}
+	}
+	if d.Constraint == "" {
+		return nil
+	}
+	c, err := channels.ParseConstraint(d.Constraint)
+	if err != nil {
+		return &channels.BlockedError{
+			Reason:  reasonUnsatisfiableDependency,
+			Message: fmt.Sprintf("invalid constraint of dependency %s: %s", d.Name, err),
+		}
+	}
+	// Versions resolved from an index are checked once installed
+	pinned := g.ops[j].Version
+	if pinned == "" {
+		return nil
+	}
+	if v, err := version.ParseSemantic(strings.TrimPrefix(pinned, "v")); err != nil || !c.Check(v) {
+		return &channels.BlockedError{
+			Reason:  reasonUnsatisfiableDependency,
+			Message: fmt.Sprintf("version %s of dependency %s does not satisfy constraint %q", pinned, d.Name, c),
+		}
+	}
+	return nil
+}
+
+// cycle returns the names along a dependency cycle from channel i back to itself, nil if i is
+// not on a cycle.
+func (g *dependencyGraph) cycle(i int) []string {
+	// Breadth first search for the shortest path back to i
+	prev := map[int]int{}
+	queue := []int{i}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, d := range g.deps[n] {
+			j, ok := g.index[d.Name]
+			if !ok {
+				continue
+			}
+			if j == i {
+				path := []string{g.ops[i].Name}
+				for m := n; m != i; m = prev[m] {
+					path = append([]string{g.ops[m].Name}, path...)
+				}
+				return append([]string{g.ops[i].Name}, path...)
+			}
+			if _, seen := prev[j]; !seen {
+				prev[j] = n
+				queue = append(queue, j)
+			}
+		}
+	}
+	return nil
+}
+
+// check returns the dependency check of channels installed in level, run by the Syncer once
+// their bundles are read. Dependencies of earlier levels have been reconciled already and must
+// be ready and healthy in a version satisfying their constraint, channels wait for all others,
+// e.g. dependencies newly declared by their bundle. Dependencies that are ready in another
+// version are unsatisfiable until their spec changes.
+func (g *dependencyGraph) check(statuses []operatorsv1alpha1.OperatorChannelStatus, level int) func(operatorsv1alpha1.OperatorChannel, []operatorsv1alpha1.Dependency) error {
+	return func(channel operatorsv1alpha1.OperatorChannel, deps []operatorsv1alpha1.Dependency) error {
+		var waiting []string
+		for _, d := range deps {
+			j, ok := g.index[d.Name]
+			if !ok {
+				return g.checkStatic(g.index[channel.Name], d)
+			}
+			if j == g.index[channel.Name] {
+				return &channels.BlockedError{
+					Reason:  reasonDependencyCycle,
+					Message: fmt.Sprintf("dependency cycle %s -> %s", channel.Name, channel.Name),
+				}
+			}
+			// Only statuses of earlier levels are final, the others are being reconciled
+			if g.level[j] < 0 || g.level[j] >= level || !statuses[j].IsReady() {
+				waiting = append(waiting, d.Name)
+				continue
+			}
+			if msg, ok := g.unhealthy[j]; ok {
+				waiting = append(waiting, fmt.Sprintf("%s (%s)", d.Name, msg))
+				continue
+			}
+			if d.Constraint == "" {
+				continue
+			}
+			c, err := channels.ParseConstraint(d.Constraint)
+			if err != nil {
+				return g.checkStatic(g.index[channel.Name], d)
+			}
+			installed := statuses[j].InstalledVersion
+			if v, err := version.ParseSemantic(strings.TrimPrefix(installed, "v")); err != nil || !c.Check(v) {
+				return &channels.BlockedError{
+					Reason:  reasonUnsatisfiableDependency,
+					Message: fmt.Sprintf("installed version %s of dependency %s does not satisfy constraint %q", installed, d.Name, c),
+				}
+			}
+		}
+		if len(waiting) > 0 {
+			return &channels.WaitingError{Message: fmt.Sprintf("waiting for dependencies to be ready: %s", strings.Join(waiting, ", "))}
+		}
+		return nil
+	}
+}
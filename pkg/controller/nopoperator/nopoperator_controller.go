@@ -4,37 +4,67 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	operatorsv1alpha1 "github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	"github.com/periklis/nop-operator/pkg/apply"
 	"github.com/periklis/nop-operator/pkg/channels"
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 var log = logf.Log.WithName("controller_nopoperator")
 
+// kind is the kind of the objects reconciled by this controller.
+const kind = "NopOperator"
+
+// defaultWorkers is the number of channels reconciled concurrently per NopOperator.
+const defaultWorkers = 4
+
+// dependencyPollInterval is the interval channels waiting for their dependencies are retried.
+const dependencyPollInterval = 10 * time.Second
+
 // Add creates a new NopOperator Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager, client *http.Client) error {
-	return add(mgr, newReconciler(mgr, client))
+	r, err := newReconciler(mgr, client)
+	if err != nil {
+		return err
+	}
+	return add(mgr, r)
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager, client *http.Client) reconcile.Reconciler {
-	return &ReconcileNopOperator{client: mgr.GetClient(), scheme: mgr.GetScheme(), httpClient: client}
+func newReconciler(mgr manager.Manager, client *http.Client) (reconcile.Reconciler, error) {
+	dc, err := dynamic.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, fmt.Errorf("Error creating dynamic client: %s", err)
+	}
+	disco, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, fmt.Errorf("Error creating discovery client: %s", err)
+	}
+
+	return &ReconcileNopOperator{
+		client:     mgr.GetClient(),
+		scheme:     mgr.GetScheme(),
+		httpClient: client,
+		applier:    apply.NewApplier(dc, mgr.GetRESTMapper(), mgr.GetScheme(), log),
+		cluster:    disco,
+	}, nil
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
@@ -45,8 +75,31 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
-	// Watch for changes to primary resource NopOperator
-	err = c.Watch(&source.Kind{Type: &operatorsv1alpha1.NopOperator{}}, &handler.EnqueueRequestForObject{})
+	// Watch for changes to primary resource NopOperator. Status updates written
+	// by the reconciler itself do not change the generation and are skipped.
+	err = c.Watch(&source.Kind{Type: &operatorsv1alpha1.NopOperator{}}, &handler.EnqueueRequestForObject{}, predicate.GenerationChangedPredicate{})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to Channels to report them in the status of the selecting NopOperators
+	err = c.Watch(&source.Kind{Type: &operatorsv1alpha1.Channel{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: selectingNopOperators(mgr.GetClient()),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to Secrets and ConfigMaps referenced by channels, e.g. rotated credentials
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: referencingNopOperators(mgr.GetClient(), channels.SecretNames),
+	})
+	if err != nil {
+		return err
+	}
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: referencingNopOperators(mgr.GetClient(), channels.ConfigMapNames),
+	})
 	if err != nil {
 		return err
 	}
@@ -63,6 +116,11 @@ type ReconcileNopOperator struct {
 	client     client.Client
 	scheme     *runtime.Scheme
 	httpClient *http.Client
+	applier    *apply.Applier
+	// cluster reports the Kubernetes version and API groups served, to check the requirements of bundles
+	cluster channels.ClusterInfo
+	// workers bounds the number of channels reconciled concurrently, defaults to defaultWorkers
+	workers int
 }
 
 // Reconcile reads that state of the cluster for a NopOperator object and makes changes based on the state read
@@ -81,8 +139,7 @@ func (r *ReconcileNopOperator) Reconcile(request reconcile.Request) (reconcile.R
 	err := r.client.Get(ctx, request.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			// Request object not found, could have been deleted after reconcile request.
-			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
+			// Request object not found, it was deleted after the finalizer pruned its objects.
 			// Return and don't requeue
 			return reconcile.Result{}, nil
 		}
@@ -90,88 +147,160 @@ func (r *ReconcileNopOperator) Reconcile(request reconcile.Request) (reconcile.R
 		return reconcile.Result{}, err
 	}
 
-	for _, op := range instance.Spec.Operators {
-		log.Info("Processing operator from channel", "Operator.Name", op.Name, "Operator.Version", op.Version, "Operator.URL", op.URL)
-		reader := channels.NewChannelReader(r.httpClient, log, op)
+	// Only objects in the namespace of the NopOperator are garbage collected along with it, its
+	// finalizer prunes all others recorded in its inventory before it is released.
+	if instance.GetDeletionTimestamp() != nil {
+		return reconcile.Result{}, r.applier.Finalize(ctx, r.client, kind, instance)
+	}
+	if apply.AddFinalizer(instance) {
+		if err := r.client.Update(ctx, instance); err != nil {
+			return reconcile.Result{}, fmt.Errorf("Error adding finalizer: %s", err)
+		}
+	}
+
+	prev, err := apply.LoadInventory(ctx, r.client, kind, instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	statuses := channelStatuses(instance)
+	outcomes := r.reconcileChannels(instance, statuses)
+
+	selected, err := r.selectedChannels(ctx, instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
 
-		objs, shouldRequeue, err := reader.Read()
-		if err != nil {
-			return reconcile.Result{Requeue: shouldRequeue}, err
+	// Channels failing this time keep their previous inventory entries, thus
+	// their objects are neither pruned nor forgotten until they succeed again.
+	var result reconcile.Result
+	var errs []error
+	applied := apply.Inventory{}
+	for i, op := range instance.Spec.Operators {
+		// Channels following an index are polled for new versions, the
+		// shortest poll interval of all channels wins.
+		if d := channels.PollInterval(op.ChannelSpec); d > 0 && (result.RequeueAfter == 0 || d < result.RequeueAfter) {
+			result.RequeueAfter = d
 		}
 
-		log.Info("Received objects ", "Count: ", len(objs))
-		for _, obj := range objs {
-			err := r.newObjectForCR(ctx, instance, op.Name, obj)
-			if err != nil {
-				return reconcile.Result{}, err
+		o := outcomes[i]
+		if o.err != nil {
+			// Blocked channels wait for an approval and tampered archives for
+			// a spec change, they are not retried. Channels waiting for their
+			// dependencies are polled without reporting a failure.
+			switch {
+			case channels.IsWaiting(o.err):
+				if result.RequeueAfter == 0 || dependencyPollInterval < result.RequeueAfter {
+					result.RequeueAfter = dependencyPollInterval
+				}
+			case !channels.IsPermanent(o.err):
+				result.Requeue = result.Requeue || o.requeue
+				errs = append(errs, o.err)
+			}
+			if refs, ok := prev[op.Name]; ok {
+				applied[op.Name] = refs
 			}
+			continue
 		}
+		applied[op.Name] = o.refs
 	}
 
-	return reconcile.Result{}, nil
-}
+	// Objects recorded by the previous reconciliation but no longer shipped
+	// by any channel are pruned before the new inventory replaces the old one.
+	var pruneErr error
+	if err := r.applier.Prune(prev.Stale(applied)); err != nil {
+		pruneErr = err
+	} else if err := apply.SaveInventory(ctx, r.client, r.scheme, kind, instance, applied); err != nil {
+		pruneErr = err
+	}
+	if pruneErr != nil {
+		errs = append(errs, pruneErr)
+	}
 
-func (r *ReconcileNopOperator) newObjectForCR(ctx context.Context, instance *operatorsv1alpha1.NopOperator, name string, obj runtime.Object) error {
-	mo := obj.(metav1.Object)
-	if err := controllerutil.SetControllerReference(instance, mo, r.scheme); err != nil {
-		return fmt.Errorf("Error setting controller reference: %s", err)
+	if err := r.updateStatus(ctx, instance, append(statuses, selected...), pruneErr); err != nil {
+		return reconcile.Result{}, err
 	}
 
-	key := types.NamespacedName{Name: mo.GetName(), Namespace: mo.GetNamespace()}
+	return result, utilerrors.NewAggregate(errs)
+}
 
-	switch o := mo.(type) {
-	case *corev1.ServiceAccount:
-		found := &corev1.ServiceAccount{}
-		err := r.client.Get(ctx, key, found)
-		if errors.IsNotFound(err) {
-			log.Info("Creating a new ServiceAccount", "Namespace", mo.GetNamespace(), "Name", mo.GetName())
-			err = r.client.Create(ctx, o)
-			if err != nil {
-				return fmt.Errorf("Error creating new ServiceAccount: %s", err)
-			}
-		} else if err != nil {
-			return err
-		}
+// channelOutcome is the result of reconciling a single channel.
+type channelOutcome struct {
+	refs    []apply.Ref
+	requeue bool
+	err     error
+}
 
-	case *rbacv1.Role:
-		found := &rbacv1.Role{}
-		err := r.client.Get(ctx, key, found)
-		if errors.IsNotFound(err) {
-			log.Info("Creating a new Role", "Namespace", mo.GetNamespace(), "Name", mo.GetName())
-			err = r.client.Create(ctx, o)
-			if err != nil {
-				return fmt.Errorf("Error creating new Role: %s", err)
-			}
-		} else if err != nil {
-			return err
-		}
+// reconcileChannels reconciles all channels of instance in the order of their dependencies,
+// level by level. The channels of a level are reconciled concurrently using at most r.workers
+// goroutines. Each channel records its outcome in its own entry of statuses, a failing channel
+// does not affect the others except for the channels depending on it.
+func (r *ReconcileNopOperator) reconcileChannels(instance *operatorsv1alpha1.NopOperator, statuses []operatorsv1alpha1.OperatorChannelStatus) []channelOutcome {
+	ops := instance.Spec.Operators
+	outcomes := make([]channelOutcome, len(ops))
 
-	case *rbacv1.RoleBinding:
-		found := &rbacv1.RoleBinding{}
-		err := r.client.Get(ctx, key, found)
-		if errors.IsNotFound(err) {
-			log.Info("Creating a new RoleBinding", "Namespace", mo.GetNamespace(), "Name", mo.GetName())
-			err = r.client.Create(ctx, o)
-			if err != nil {
-				return fmt.Errorf("Error creating new RoleBinding: %s", err)
+	graph := newDependencyGraph(instance, statuses)
+	for i, err := range graph.blocked {
+		log.Info("Refusing channel with unsatisfiable dependencies", "Operator.Name", ops[i].Name, "Reason", err.Error())
+		statuses[i].LastError = ""
+		channels.SetConditions(&statuses[i], instance.Generation, err)
+		outcomes[i] = channelOutcome{err: err}
+	}
+
+	for level, indices := range graph.levels {
+		var pending []int
+		for _, i := range indices {
+			if _, ok := graph.blocked[i]; !ok {
+				pending = append(pending, i)
 			}
-		} else if err != nil {
-			return err
 		}
 
-	case *appsv1.Deployment:
-		found := &appsv1.Deployment{}
-		err := r.client.Get(ctx, key, found)
-		if errors.IsNotFound(err) {
-			log.Info("Creating a new Deployment", "Namespace", mo.GetNamespace(), "Name", mo.GetName())
-			err = r.client.Create(ctx, o)
-			if err != nil {
-				return fmt.Errorf("Error creating new Deployment: %s", err)
+		syncer := channels.NewSyncer(r.httpClient, r.client, r.cluster, r.applier, log)
+		syncer.CheckDependencies = graph.check(statuses, level)
+		r.syncChannels(instance, syncer, pending, statuses, outcomes)
+
+		// Channels depending on channels of this level wait for their workloads
+		for _, i := range pending {
+			if len(graph.dependents[i]) == 0 || !statuses[i].IsReady() {
+				continue
+			}
+			if err := r.applier.CheckHealth(outcomes[i].refs); err != nil {
+				graph.unhealthy[i] = err.Error()
 			}
-		} else if err != nil {
-			return err
 		}
 	}
+	return outcomes
+}
 
-	return nil
+// syncChannels syncs the channels of instance at indices concurrently using at most r.workers
+// goroutines.
+func (r *ReconcileNopOperator) syncChannels(instance *operatorsv1alpha1.NopOperator, syncer *channels.Syncer, indices []int, statuses []operatorsv1alpha1.OperatorChannelStatus, outcomes []channelOutcome) {
+	ops := instance.Spec.Operators
+
+	workers := r.workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	if workers > len(indices) {
+		workers = len(indices)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				refs, requeue, err := syncer.Sync(instance, ops[i], &statuses[i])
+				channels.SetConditions(&statuses[i], instance.Generation, err)
+				outcomes[i] = channelOutcome{refs: refs, requeue: requeue, err: err}
+			}
+		}()
+	}
+	for _, i := range indices {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 }
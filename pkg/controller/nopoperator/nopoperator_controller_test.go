@@ -1,8 +1,10 @@
 package nopoperator
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 
 	"net/http/httptest"
@@ -10,14 +12,24 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
 	operatorsv1alpha1 "github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	"github.com/periklis/nop-operator/pkg/apply"
+	"github.com/periklis/nop-operator/pkg/channels"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -65,6 +77,26 @@ func newTestHttpServer(statusCode int, archive string) *httptest.Server {
 	}))
 }
 
+func newTestApplier(s *runtime.Scheme, objs ...runtime.Object) (*apply.Applier, *dynamicfake.FakeDynamicClient) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ServiceAccount"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "Role"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+
+	// Server-side apply is rejected like by an apiserver without the ServerSideApply feature
+	dc := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objs...)
+	dc.PrependReactor("patch", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		pa := action.(clienttesting.PatchAction)
+		if pa.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		gr := pa.GetResource().GroupResource()
+		return true, nil, errors.NewGenericServerResponse(http.StatusUnsupportedMediaType, "patch", gr, pa.GetName(), "", 0, false)
+	})
+	return apply.NewApplier(dc, mapper, s, logt), dc
+}
+
 func TestAddToManager(t *testing.T) {
 	testEnv := &envtest.Environment{
 		CRDDirectoryPaths: []string{"../../../deploy/crds"},
@@ -97,6 +129,9 @@ func TestReconcile(t *testing.T) {
 		archive    string
 		wantErr    bool
 		want       reconcile.Result
+		wantReady  int
+		wantTotal  int
+		wantConds  map[operatorsv1alpha1.ConditionType]corev1.ConditionStatus
 	}{
 		{
 			desc: "reconcile success empty channels",
@@ -111,6 +146,11 @@ func TestReconcile(t *testing.T) {
 			},
 			statusCode: 200,
 			want:       reconcile.Result{},
+			wantConds: map[operatorsv1alpha1.ConditionType]corev1.ConditionStatus{
+				operatorsv1alpha1.ConditionReady:       corev1.ConditionTrue,
+				operatorsv1alpha1.ConditionProgressing: corev1.ConditionFalse,
+				operatorsv1alpha1.ConditionDegraded:    corev1.ConditionFalse,
+			},
 		},
 		{
 			desc: "reconcile success with valid archive",
@@ -122,8 +162,10 @@ func TestReconcile(t *testing.T) {
 				Spec: operatorsv1alpha1.NopOperatorSpec{
 					Operators: []operatorsv1alpha1.OperatorChannel{
 						{
-							Name:    "a-operator",
-							Version: "1.2.3",
+							Name: "a-operator",
+							ChannelSpec: operatorsv1alpha1.ChannelSpec{
+								Version: "1.2.3",
+							},
 						},
 					},
 				},
@@ -131,6 +173,13 @@ func TestReconcile(t *testing.T) {
 			archive:    "./testdata/manifests.tar.gz",
 			statusCode: 200,
 			want:       reconcile.Result{},
+			wantReady:  1,
+			wantTotal:  1,
+			wantConds: map[operatorsv1alpha1.ConditionType]corev1.ConditionStatus{
+				operatorsv1alpha1.ConditionReady:       corev1.ConditionTrue,
+				operatorsv1alpha1.ConditionProgressing: corev1.ConditionFalse,
+				operatorsv1alpha1.ConditionDegraded:    corev1.ConditionFalse,
+			},
 		},
 		{
 			desc: "reconcile with requeue empty archive",
@@ -142,14 +191,21 @@ func TestReconcile(t *testing.T) {
 				Spec: operatorsv1alpha1.NopOperatorSpec{
 					Operators: []operatorsv1alpha1.OperatorChannel{
 						{
-							Name:    "a-operator",
-							Version: "1.2.3",
+							Name: "a-operator",
+							ChannelSpec: operatorsv1alpha1.ChannelSpec{
+								Version: "1.2.3",
+							},
 						},
 					},
 				},
 			},
 			statusCode: 200,
 			want:       reconcile.Result{Requeue: true},
+			wantTotal:  1,
+			wantConds: map[operatorsv1alpha1.ConditionType]corev1.ConditionStatus{
+				operatorsv1alpha1.ConditionReady:    corev1.ConditionFalse,
+				operatorsv1alpha1.ConditionDegraded: corev1.ConditionTrue,
+			},
 		},
 		{
 			desc: "reconcile failure channel server error",
@@ -161,8 +217,10 @@ func TestReconcile(t *testing.T) {
 				Spec: operatorsv1alpha1.NopOperatorSpec{
 					Operators: []operatorsv1alpha1.OperatorChannel{
 						{
-							Name:    "a-operator",
-							Version: "1.2.3",
+							Name: "a-operator",
+							ChannelSpec: operatorsv1alpha1.ChannelSpec{
+								Version: "1.2.3",
+							},
 						},
 					},
 				},
@@ -170,6 +228,11 @@ func TestReconcile(t *testing.T) {
 			statusCode: 500,
 			wantErr:    true,
 			want:       reconcile.Result{},
+			wantTotal:  1,
+			wantConds: map[operatorsv1alpha1.ConditionType]corev1.ConditionStatus{
+				operatorsv1alpha1.ConditionReady:    corev1.ConditionFalse,
+				operatorsv1alpha1.ConditionDegraded: corev1.ConditionTrue,
+			},
 		},
 	}
 	for _, test := range tests {
@@ -183,10 +246,12 @@ func TestReconcile(t *testing.T) {
 			}
 
 			cs := fake.NewFakeClientWithScheme(scheme, test.operator)
+			applier, _ := newTestApplier(scheme)
 			rc := &ReconcileNopOperator{
 				client:     cs,
 				scheme:     scheme,
 				httpClient: ts.Client(),
+				applier:    applier,
 			}
 
 			key := types.NamespacedName{Name: test.operator.Name, Namespace: test.operator.Namespace}
@@ -196,6 +261,577 @@ func TestReconcile(t *testing.T) {
 			} else if diff := cmp.Diff(got, test.want); diff != "" {
 				t.Errorf("got diff: %s", diff)
 			}
+
+			instance := &operatorsv1alpha1.NopOperator{}
+			if err := cs.Get(context.TODO(), key, instance); err != nil {
+				t.Fatal(err)
+			}
+			if instance.Status.ReadyChannels != test.wantReady || instance.Status.TotalChannels != test.wantTotal {
+				t.Errorf("got ready/total: %d/%d, want ready/total: %d/%d",
+					instance.Status.ReadyChannels, instance.Status.TotalChannels, test.wantReady, test.wantTotal)
+			}
+			for ct, want := range test.wantConds {
+				c := operatorsv1alpha1.FindCondition(instance.Status.Conditions, ct)
+				if c == nil || c.Status != want {
+					t.Errorf("got condition %s: %v, want status: %s", ct, c, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcilePrune(t *testing.T) {
+	scheme := scheme.Scheme
+	v1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	ts := newTestHttpServer(http.StatusOK, "./testdata/manifests.tar.gz")
+	defer ts.Close()
+
+	operator := &operatorsv1alpha1.NopOperator{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "prune-nop-operator",
+			Namespace: "test-namespace",
+		},
+		Spec: operatorsv1alpha1.NopOperatorSpec{
+			Operators: []operatorsv1alpha1.OperatorChannel{
+				{
+					Name: "a-operator",
+					ChannelSpec: operatorsv1alpha1.ChannelSpec{
+						Version: "1.2.4",
+						URL:     ts.URL,
+					},
+				},
+			},
+		},
+	}
+
+	// The previous version shipped an additional RoleBinding
+	inventory := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      apply.InventoryName(kind, operator),
+			Namespace: operator.Namespace,
+		},
+		Data: map[string]string{
+			"a-operator": "rbac.authorization.k8s.io/v1/RoleBinding/default/a-operator\nrbac.authorization.k8s.io/v1/RoleBinding/default/a-operator-legacy",
+		},
+	}
+	legacy := &unstructured.Unstructured{}
+	legacy.SetAPIVersion("rbac.authorization.k8s.io/v1")
+	legacy.SetKind("RoleBinding")
+	legacy.SetName("a-operator-legacy")
+	legacy.SetNamespace("default")
+
+	cs := fake.NewFakeClientWithScheme(scheme, operator, inventory)
+	applier, dc := newTestApplier(scheme, legacy)
+	rc := &ReconcileNopOperator{
+		client:     cs,
+		scheme:     scheme,
+		httpClient: ts.Client(),
+		applier:    applier,
+	}
+
+	key := types.NamespacedName{Name: operator.Name, Namespace: operator.Namespace}
+	if _, err := rc.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	gvr := schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}
+	if _, err := dc.Resource(gvr).Namespace("default").Get("a-operator-legacy", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("want legacy RoleBinding pruned, got: %v", err)
+	}
+	if _, err := dc.Resource(gvr).Namespace("default").Get("a-operator", metav1.GetOptions{}); err != nil {
+		t.Errorf("want RoleBinding applied, got: %s", err)
+	}
+
+	got, err := apply.LoadInventory(context.TODO(), cs, kind, operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got["a-operator"]) != 4 {
+		t.Errorf("got %d inventory entries, want 4", len(got["a-operator"]))
+	}
+}
+
+func TestReconcileIsolatesChannels(t *testing.T) {
+	scheme := scheme.Scheme
+	v1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	ok := newTestHttpServer(http.StatusOK, "./testdata/manifests.tar.gz")
+	defer ok.Close()
+	broken := newTestHttpServer(http.StatusInternalServerError, "")
+	defer broken.Close()
+
+	operator := &operatorsv1alpha1.NopOperator{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "isolated-nop-operator",
+			Namespace: "test-namespace",
+		},
+		Spec: operatorsv1alpha1.NopOperatorSpec{
+			Operators: []operatorsv1alpha1.OperatorChannel{
+				{
+					Name: "b-operator",
+					ChannelSpec: operatorsv1alpha1.ChannelSpec{
+						Version: "0.1.0",
+						URL:     broken.URL,
+					},
+				},
+				{
+					Name: "a-operator",
+					ChannelSpec: operatorsv1alpha1.ChannelSpec{
+						Version: "1.2.3",
+						URL:     ok.URL,
+					},
+				},
+			},
+		},
+	}
+
+	// Objects of the failing channel must survive until it succeeds again
+	inventory := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      apply.InventoryName(kind, operator),
+			Namespace: operator.Namespace,
+		},
+		Data: map[string]string{
+			"b-operator": "/v1/ServiceAccount/test-namespace/b-operator",
+		},
+	}
+	sa := &unstructured.Unstructured{}
+	sa.SetAPIVersion("v1")
+	sa.SetKind("ServiceAccount")
+	sa.SetName("b-operator")
+	sa.SetNamespace("test-namespace")
+
+	cs := fake.NewFakeClientWithScheme(scheme, operator, inventory)
+	applier, dc := newTestApplier(scheme, sa)
+	rc := &ReconcileNopOperator{
+		client:     cs,
+		scheme:     scheme,
+		httpClient: ok.Client(),
+		applier:    applier,
+		workers:    2,
+	}
+
+	key := types.NamespacedName{Name: operator.Name, Namespace: operator.Namespace}
+	if _, err := rc.Reconcile(reconcile.Request{NamespacedName: key}); err == nil {
+		t.Error("want err but got nothing")
+	}
+
+	gvr := schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}
+	if _, err := dc.Resource(gvr).Namespace("default").Get("a-operator", metav1.GetOptions{}); err != nil {
+		t.Errorf("want RoleBinding of healthy channel applied, got: %s", err)
+	}
+	gvr = schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"}
+	if _, err := dc.Resource(gvr).Namespace("test-namespace").Get("b-operator", metav1.GetOptions{}); err != nil {
+		t.Errorf("want ServiceAccount of failing channel kept, got: %s", err)
+	}
+
+	got, err := apply.LoadInventory(context.TODO(), cs, kind, operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got["a-operator"]) != 4 || len(got["b-operator"]) != 1 {
+		t.Errorf("got %d/%d inventory entries, want 4/1", len(got["a-operator"]), len(got["b-operator"]))
+	}
+
+	instance := &operatorsv1alpha1.NopOperator{}
+	if err := cs.Get(context.TODO(), key, instance); err != nil {
+		t.Fatal(err)
+	}
+	if instance.Status.ReadyChannels != 1 || instance.Status.TotalChannels != 2 {
+		t.Errorf("got ready/total: %d/%d, want ready/total: 1/2", instance.Status.ReadyChannels, instance.Status.TotalChannels)
+	}
+	for _, cs := range instance.Status.Channels {
+		if failed := cs.LastError != ""; failed != (cs.Name == "b-operator") {
+			t.Errorf("got channel %s last error: %q", cs.Name, cs.LastError)
+		}
+	}
+}
+
+func TestReconcileSelector(t *testing.T) {
+	scheme := scheme.Scheme
+	v1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	operator := &operatorsv1alpha1.NopOperator{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "team-nop-operator",
+			Namespace: "team-a",
+		},
+		Spec: operatorsv1alpha1.NopOperatorSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"team": "a"},
+			},
+		},
+	}
+
+	newChannel := func(name, namespace, team, installed string) *operatorsv1alpha1.Channel {
+		return &operatorsv1alpha1.Channel{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{"team": team},
+			},
+			Spec: operatorsv1alpha1.ChannelSpec{Version: "1.0.0"},
+			Status: operatorsv1alpha1.ChannelStatus{
+				OperatorChannelStatus: operatorsv1alpha1.OperatorChannelStatus{
+					DesiredVersion:   "1.0.0",
+					InstalledVersion: installed,
+				},
+			},
+		}
+	}
+
+	cs := fake.NewFakeClientWithScheme(scheme, operator,
+		newChannel("a-operator", "team-a", "a", "1.0.0"),
+		newChannel("b-operator", "team-a", "a", ""),
+		newChannel("c-operator", "team-a", "b", "1.0.0"),
+		newChannel("d-operator", "team-b", "a", "1.0.0"),
+	)
+	applier, _ := newTestApplier(scheme)
+	rc := &ReconcileNopOperator{
+		client:  cs,
+		scheme:  scheme,
+		applier: applier,
+	}
+
+	key := types.NamespacedName{Name: operator.Name, Namespace: operator.Namespace}
+	if _, err := rc.Reconcile(reconcile.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	instance := &operatorsv1alpha1.NopOperator{}
+	if err := cs.Get(context.TODO(), key, instance); err != nil {
+		t.Fatal(err)
+	}
+	if instance.Status.ReadyChannels != 1 || instance.Status.TotalChannels != 2 {
+		t.Errorf("got ready/total: %d/%d, want ready/total: 1/2", instance.Status.ReadyChannels, instance.Status.TotalChannels)
+	}
+	if !operatorsv1alpha1.IsConditionTrue(instance.Status.Conditions, operatorsv1alpha1.ConditionProgressing) {
+		t.Errorf("want condition %s true, got: %v", operatorsv1alpha1.ConditionProgressing, instance.Status.Conditions)
+	}
+
+	got := selectingNopOperators(cs)(handler.MapObject{Meta: &metav1.ObjectMeta{
+		Name:      "b-operator",
+		Namespace: "team-a",
+		Labels:    map[string]string{"team": "a"},
+	}})
+	want := []reconcile.Request{{NamespacedName: key}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got diff: %s", diff)
+	}
+}
+
+func TestReferencingNopOperators(t *testing.T) {
+	scheme := scheme.Scheme
+	operatorsv1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	newNop := func(name, namespace, secret string) *operatorsv1alpha1.NopOperator {
+		return &operatorsv1alpha1.NopOperator{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: operatorsv1alpha1.NopOperatorSpec{
+				Operators: []operatorsv1alpha1.OperatorChannel{
+					{
+						Name: "a-operator",
+						ChannelSpec: operatorsv1alpha1.ChannelSpec{
+							URL:           "https://example.com/a-operator.tar.gz",
+							AuthSecretRef: &corev1.LocalObjectReference{Name: secret},
+						},
+					},
+				},
+			},
+		}
+	}
+	cs := fake.NewFakeClientWithScheme(scheme,
+		newNop("referencing", "team-a", "repo-auth"),
+		newNop("other-secret", "team-a", "other-auth"),
+		newNop("other-namespace", "team-b", "repo-auth"),
+	)
+
+	got := referencingNopOperators(cs, channels.SecretNames)(handler.MapObject{Meta: &metav1.ObjectMeta{Name: "repo-auth", Namespace: "team-a"}})
+	want := []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "referencing", Namespace: "team-a"}}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got diff: %s", diff)
+	}
+}
+
+func TestInstallOrder(t *testing.T) {
+	dep := func(name, constraint string) operatorsv1alpha1.Dependency {
+		return operatorsv1alpha1.Dependency{Name: name, Constraint: constraint}
+	}
+
+	tests := []struct {
+		desc        string
+		ops         []operatorsv1alpha1.OperatorChannel
+		bundleDeps  map[string][]operatorsv1alpha1.Dependency
+		wantLevels  [][]string
+		wantBlocked map[string]string
+	}{
+		{
+			desc: "no dependencies",
+			ops: []operatorsv1alpha1.OperatorChannel{
+				{Name: "a-operator"},
+				{Name: "b-operator"},
+			},
+			wantLevels: [][]string{{"a-operator", "b-operator"}},
+		},
+		{
+			desc: "dependencies of channels and bundles",
+			ops: []operatorsv1alpha1.OperatorChannel{
+				{Name: "c-operator", Dependencies: []operatorsv1alpha1.Dependency{dep("b-operator", ""), dep("a-operator", "")}},
+				{Name: "b-operator"},
+				{Name: "a-operator", ChannelSpec: operatorsv1alpha1.ChannelSpec{Version: "1.2.3"}},
+			},
+			bundleDeps: map[string][]operatorsv1alpha1.Dependency{
+				"b-operator": {dep("a-operator", ">=1.2")},
+			},
+			wantLevels: [][]string{{"a-operator"}, {"b-operator"}, {"c-operator"}},
+		},
+		{
+			desc: "unsatisfiable dependencies",
+			ops: []operatorsv1alpha1.OperatorChannel{
+				{Name: "a-operator", ChannelSpec: operatorsv1alpha1.ChannelSpec{Version: "1.2.3"}},
+				{Name: "b-operator", Dependencies: []operatorsv1alpha1.Dependency{dep("a-operator", ">=2.0")}},
+				{Name: "c-operator", Dependencies: []operatorsv1alpha1.Dependency{dep("x-operator", "")}},
+				{Name: "d-operator", Dependencies: []operatorsv1alpha1.Dependency{dep("a-operator", "~>1")}},
+			},
+			wantLevels: [][]string{{"a-operator", "c-operator"}, {"b-operator", "d-operator"}},
+			wantBlocked: map[string]string{
+				"b-operator": "version 1.2.3 of dependency a-operator does not satisfy constraint \">=2.0\"",
+				"c-operator": "dependency x-operator is not a channel of this NopOperator",
+				"d-operator": "invalid constraint of dependency a-operator",
+			},
+		},
+		{
+			desc: "dependency cycles",
+			ops: []operatorsv1alpha1.OperatorChannel{
+				{Name: "a-operator", Dependencies: []operatorsv1alpha1.Dependency{dep("c-operator", "")}},
+				{Name: "b-operator", Dependencies: []operatorsv1alpha1.Dependency{dep("a-operator", "")}},
+				{Name: "c-operator", Dependencies: []operatorsv1alpha1.Dependency{dep("b-operator", "")}},
+				{Name: "d-operator", Dependencies: []operatorsv1alpha1.Dependency{dep("c-operator", "")}},
+				{Name: "e-operator", Dependencies: []operatorsv1alpha1.Dependency{dep("e-operator", "")}},
+				{Name: "f-operator"},
+			},
+			wantLevels: [][]string{{"f-operator"}},
+			wantBlocked: map[string]string{
+				"a-operator": "dependency cycle a-operator -> c-operator -> b-operator -> a-operator",
+				"b-operator": "dependency cycle b-operator -> a-operator -> c-operator -> b-operator",
+				"c-operator": "dependency cycle c-operator -> b-operator -> a-operator -> c-operator",
+				"d-operator": "depends on a dependency cycle",
+				"e-operator": "dependency cycle e-operator -> e-operator",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			instance := &operatorsv1alpha1.NopOperator{Spec: operatorsv1alpha1.NopOperatorSpec{Operators: test.ops}}
+			statuses := channelStatuses(instance)
+			for i := range statuses {
+				if deps, ok := test.bundleDeps[statuses[i].Name]; ok {
+					statuses[i].Bundle = &operatorsv1alpha1.BundleMetadata{Name: statuses[i].Name, Dependencies: deps}
+				}
+			}
+
+			g := newDependencyGraph(instance, statuses)
+			var levels [][]string
+			for _, level := range g.levels {
+				var names []string
+				for _, i := range level {
+					names = append(names, test.ops[i].Name)
+				}
+				levels = append(levels, names)
+			}
+			if diff := cmp.Diff(levels, test.wantLevels); diff != "" {
+				t.Errorf("got levels diff: %s", diff)
+			}
+
+			if len(g.blocked) != len(test.wantBlocked) {
+				t.Errorf("got %d blocked channels, want %d", len(g.blocked), len(test.wantBlocked))
+			}
+			for i, err := range g.blocked {
+				want, ok := test.wantBlocked[test.ops[i].Name]
+				if !ok || !strings.Contains(err.Error(), want) {
+					t.Errorf("got channel %s blocked with %q, want %q", test.ops[i].Name, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileDependencies(t *testing.T) {
+	scheme := scheme.Scheme
+	v1alpha1.SchemeBuilder.AddToScheme(scheme)
+
+	ok := newTestHttpServer(http.StatusOK, "./testdata/manifests.tar.gz")
+	defer ok.Close()
+	broken := newTestHttpServer(http.StatusInternalServerError, "")
+	defer broken.Close()
+
+	operator := &operatorsv1alpha1.NopOperator{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "dependent-nop-operator",
+			Namespace: "test-namespace",
+		},
+		Spec: operatorsv1alpha1.NopOperatorSpec{
+			Operators: []operatorsv1alpha1.OperatorChannel{
+				{
+					Name:        "c-operator",
+					ChannelSpec: operatorsv1alpha1.ChannelSpec{Version: "0.1.0", URL: ok.URL},
+					Dependencies: []operatorsv1alpha1.Dependency{
+						{Name: "a-operator", Constraint: ">=1.2"},
+						{Name: "b-operator"},
+					},
+				},
+				{
+					Name:         "d-operator",
+					ChannelSpec:  operatorsv1alpha1.ChannelSpec{Version: "0.1.0", URL: ok.URL},
+					Dependencies: []operatorsv1alpha1.Dependency{{Name: "a-operator", Constraint: "~1.2"}},
+				},
+				{
+					Name:         "e-operator",
+					ChannelSpec:  operatorsv1alpha1.ChannelSpec{Version: "0.1.0", URL: ok.URL},
+					Dependencies: []operatorsv1alpha1.Dependency{{Name: "e-operator"}},
+				},
+				{
+					Name:        "a-operator",
+					ChannelSpec: operatorsv1alpha1.ChannelSpec{Version: "1.2.3", URL: ok.URL},
+				},
+				{
+					Name:        "b-operator",
+					ChannelSpec: operatorsv1alpha1.ChannelSpec{Version: "0.1.0", URL: broken.URL},
+				},
+			},
+		},
+	}
+
+	cs := fake.NewFakeClientWithScheme(scheme, operator)
+	applier, dc := newTestApplier(scheme)
+	rc := &ReconcileNopOperator{
+		client:     cs,
+		scheme:     scheme,
+		httpClient: ok.Client(),
+		applier:    applier,
+	}
+
+	type channelWant struct {
+		ready   bool
+		reason  string
+		blocked bool
+	}
+	key := types.NamespacedName{Name: operator.Name, Namespace: operator.Namespace}
+	reconcileAndCheck := func(want map[string]channelWant) *operatorsv1alpha1.NopOperator {
+		if _, err := rc.Reconcile(reconcile.Request{NamespacedName: key}); err == nil {
+			t.Error("want err of failing b-operator but got nothing")
+		}
+
+		instance := &operatorsv1alpha1.NopOperator{}
+		if err := cs.Get(context.TODO(), key, instance); err != nil {
+			t.Fatal(err)
+		}
+		for _, cs := range instance.Status.Channels {
+			w := want[cs.Name]
+			ready := operatorsv1alpha1.FindCondition(cs.Conditions, operatorsv1alpha1.ConditionReady)
+			if cs.IsReady() != w.ready || ready == nil || ready.Reason != w.reason {
+				t.Errorf("got channel %s ready %t with condition %+v, want ready %t with reason %s", cs.Name, cs.IsReady(), ready, w.ready, w.reason)
+			}
+			if got := operatorsv1alpha1.IsConditionTrue(cs.Conditions, operatorsv1alpha1.ConditionBlocked); got != w.blocked {
+				t.Errorf("got channel %s blocked %t, want %t", cs.Name, got, w.blocked)
+			}
+		}
+		return instance
+	}
+
+	// d-operator waits for the Deployment of a-operator to become available
+	instance := reconcileAndCheck(map[string]channelWant{
+		"a-operator": {ready: true, reason: "Installed"},
+		"b-operator": {reason: "ReconcileFailed"},
+		"c-operator": {reason: "WaitingForDependencies"},
+		"d-operator": {reason: "WaitingForDependencies"},
+		"e-operator": {reason: "Blocked", blocked: true},
+	})
+	for _, cs := range instance.Status.Channels {
+		if cs.Name != "d-operator" {
+			continue
+		}
+		progress := operatorsv1alpha1.FindCondition(cs.Conditions, operatorsv1alpha1.ConditionProgressing)
+		if progress == nil || !strings.Contains(progress.Message, "a-operator (Deployment default/a-operator") {
+			t.Errorf("got channel d-operator progressing condition %+v, want Deployment of a-operator reported", progress)
+		}
+	}
+
+	c := operatorsv1alpha1.FindCondition(instance.Status.Conditions, operatorsv1alpha1.ConditionBlocked)
+	if c == nil || c.Reason != "DependenciesUnsatisfiable" || !strings.Contains(c.Message, "dependency cycle e-operator -> e-operator") {
+		t.Errorf("got blocked condition %+v, want dependency cycle of e-operator reported", c)
+	}
+
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	deployment, err := dc.Resource(deployments).Namespace("default").Get("a-operator", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unstructured.SetNestedField(deployment.Object, map[string]interface{}{
+		"observedGeneration": deployment.GetGeneration(),
+		"updatedReplicas":    int64(1),
+		"conditions":         []interface{}{map[string]interface{}{"type": "Available", "status": "True"}},
+	}, "status")
+	if _, err := dc.Resource(deployments).Namespace("default").Update(deployment, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	reconcileAndCheck(map[string]channelWant{
+		"a-operator": {ready: true, reason: "Installed"},
+		"b-operator": {reason: "ReconcileFailed"},
+		"c-operator": {reason: "WaitingForDependencies"},
+		"d-operator": {ready: true, reason: "Installed"},
+		"e-operator": {reason: "Blocked", blocked: true},
+	})
+}
+
+func TestSetStatusBlockedReason(t *testing.T) {
+	blocked := func(name, reason string) operatorsv1alpha1.OperatorChannelStatus {
+		return operatorsv1alpha1.OperatorChannelStatus{
+			Name: name,
+			Conditions: []operatorsv1alpha1.Condition{{
+				Type:    operatorsv1alpha1.ConditionBlocked,
+				Status:  corev1.ConditionTrue,
+				Reason:  reason,
+				Message: "blocked for " + reason,
+			}},
+		}
+	}
+
+	tests := []struct {
+		desc     string
+		statuses []operatorsv1alpha1.OperatorChannelStatus
+		want     string
+	}{
+		{desc: "nothing blocked", statuses: []operatorsv1alpha1.OperatorChannelStatus{{Name: "a-operator"}}, want: "NoBlockedChannels"},
+		{desc: "major upgrade", statuses: []operatorsv1alpha1.OperatorChannelStatus{blocked("a-operator", "MajorUpgrade")}, want: "ApprovalRequired"},
+		{desc: "downgrade", statuses: []operatorsv1alpha1.OperatorChannelStatus{blocked("a-operator", "Downgrade")}, want: "ApprovalRequired"},
+		{desc: "bundle mismatch", statuses: []operatorsv1alpha1.OperatorChannelStatus{blocked("a-operator", "BundleMismatch")}, want: "BundleMismatch"},
+		{desc: "invalid constraint", statuses: []operatorsv1alpha1.OperatorChannelStatus{blocked("a-operator", "InvalidConstraint")}, want: "InvalidConstraint"},
+		{desc: "constraint not satisfied", statuses: []operatorsv1alpha1.OperatorChannelStatus{blocked("a-operator", "ConstraintNotSatisfied")}, want: "ConstraintNotSatisfied"},
+		{desc: "dependency cycle", statuses: []operatorsv1alpha1.OperatorChannelStatus{blocked("a-operator", "DependencyCycle")}, want: "DependenciesUnsatisfiable"},
+		{
+			desc:     "first blocked channel",
+			statuses: []operatorsv1alpha1.OperatorChannelStatus{{Name: "a-operator"}, blocked("b-operator", "BundleMismatch"), blocked("c-operator", "MajorUpgrade")},
+			want:     "BundleMismatch",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			instance := &operatorsv1alpha1.NopOperator{}
+			setStatus(instance, test.statuses, nil)
+			c := operatorsv1alpha1.FindCondition(instance.Status.Conditions, operatorsv1alpha1.ConditionBlocked)
+			if c == nil || c.Reason != test.want {
+				t.Errorf("got blocked condition %+v, want reason %s", c, test.want)
+			}
+			for _, cs := range test.statuses {
+				if operatorsv1alpha1.IsConditionTrue(cs.Conditions, operatorsv1alpha1.ConditionBlocked) && !strings.Contains(c.Message, cs.Name) {
+					t.Errorf("got blocked condition message %q, want %s listed", c.Message, cs.Name)
+				}
+			}
 		})
 	}
 }
@@ -0,0 +1,46 @@
+package nopoperator
+
+import (
+	"context"
+
+	operatorsv1alpha1 "github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// referencingNopOperators maps a Secret or ConfigMap to the NopOperators in its namespace with
+// a channel referencing it according to names, e.g. for credentials or as source. Rotated
+// credentials and updated sources are used right away.
+func referencingNopOperators(c client.Client, names func(operatorsv1alpha1.ChannelSpec) []string) handler.ToRequestsFunc {
+	return func(o handler.MapObject) []reconcile.Request {
+		list := &operatorsv1alpha1.NopOperatorList{}
+		if err := c.List(context.TODO(), list, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+			log.Error(err, "Error listing NopOperators referencing object", "Name", o.Meta.GetName())
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for _, nop := range list.Items {
+			if references(nop.Spec.Operators, names, o.Meta.GetName()) {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Name: nop.Name, Namespace: nop.Namespace},
+				})
+			}
+		}
+		return requests
+	}
+}
+
+// references reports whether any of ops references the object name according to names.
+func references(ops []operatorsv1alpha1.OperatorChannel, names func(operatorsv1alpha1.ChannelSpec) []string, name string) bool {
+	for _, op := range ops {
+		for _, n := range names(op.ChannelSpec) {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package nopoperator
+
+import (
+	"context"
+	"fmt"
+
+	operatorsv1alpha1 "github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// selectedChannels returns the status of every Channel in the namespace of instance matched
+// by its selector. The Channels themselves are reconciled by the channel controller.
+func (r *ReconcileNopOperator) selectedChannels(ctx context.Context, instance *operatorsv1alpha1.NopOperator) ([]operatorsv1alpha1.OperatorChannelStatus, error) {
+	if instance.Spec.Selector == nil {
+		return nil, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(instance.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing channel selector: %s", err)
+	}
+
+	list := &operatorsv1alpha1.ChannelList{}
+	if err := r.client.List(ctx, list, client.InNamespace(instance.Namespace)); err != nil {
+		return nil, fmt.Errorf("Error listing channels: %s", err)
+	}
+
+	var statuses []operatorsv1alpha1.OperatorChannelStatus
+	for _, ch := range list.Items {
+		if !selector.Matches(labels.Set(ch.Labels)) {
+			continue
+		}
+		cs := *ch.Status.OperatorChannelStatus.DeepCopy()
+		cs.Name = ch.Name
+		statuses = append(statuses, cs)
+	}
+	return statuses, nil
+}
+
+// selectingNopOperators maps a Channel to the NopOperators in its namespace selecting it.
+func selectingNopOperators(c client.Client) handler.ToRequestsFunc {
+	return func(o handler.MapObject) []reconcile.Request {
+		list := &operatorsv1alpha1.NopOperatorList{}
+		if err := c.List(context.TODO(), list, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+			log.Error(err, "Error listing NopOperators selecting channel", "Channel.Name", o.Meta.GetName())
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for _, nop := range list.Items {
+			if nop.Spec.Selector == nil {
+				continue
+			}
+			selector, err := metav1.LabelSelectorAsSelector(nop.Spec.Selector)
+			if err != nil || !selector.Matches(labels.Set(o.Meta.GetLabels())) {
+				continue
+			}
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: nop.Name, Namespace: nop.Namespace},
+			})
+		}
+		return requests
+	}
+}
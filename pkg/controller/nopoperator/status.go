@@ -0,0 +1,138 @@
+package nopoperator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	operatorsv1alpha1 "github.com/periklis/nop-operator/pkg/apis/operators/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// channelStatuses returns a status entry per embedded channel of the spec, carrying
+// over what was observed for the same channel by previous reconciliations.
+func channelStatuses(instance *operatorsv1alpha1.NopOperator) []operatorsv1alpha1.OperatorChannelStatus {
+	prev := map[string]operatorsv1alpha1.OperatorChannelStatus{}
+	for _, cs := range instance.Status.Channels {
+		prev[cs.Name] = cs
+	}
+
+	statuses := make([]operatorsv1alpha1.OperatorChannelStatus, 0, len(instance.Spec.Operators))
+	for _, op := range instance.Spec.Operators {
+		cs, ok := prev[op.Name]
+		if !ok {
+			cs = operatorsv1alpha1.OperatorChannelStatus{Name: op.Name}
+		}
+		cs.DesiredVersion = op.Version
+		statuses = append(statuses, *cs.DeepCopy())
+	}
+	return statuses
+}
+
+// setStatus records the statuses of the embedded and selected channels on instance and
+// derives the top-level conditions.
+// A non-nil err reports a failure not bound to a single channel (e.g. pruning).
+func setStatus(instance *operatorsv1alpha1.NopOperator, statuses []operatorsv1alpha1.OperatorChannelStatus, err error) {
+	status := &instance.Status
+	status.ObservedGeneration = instance.Generation
+	status.Channels = statuses
+	status.TotalChannels = len(statuses)
+	status.ReadyChannels = 0
+
+	var progressing, failed, blocked []string
+	var reason string
+	for _, cs := range statuses {
+		switch {
+		case operatorsv1alpha1.IsConditionTrue(cs.Conditions, operatorsv1alpha1.ConditionBlocked):
+			c := operatorsv1alpha1.FindCondition(cs.Conditions, operatorsv1alpha1.ConditionBlocked)
+			blocked = append(blocked, fmt.Sprintf("%s: %s", cs.Name, c.Message))
+			if reason == "" {
+				reason = blockedReason(c.Reason)
+			}
+		case cs.IsReady():
+			status.ReadyChannels++
+		case cs.LastError != "":
+			failed = append(failed, fmt.Sprintf("%s: %s", cs.Name, cs.LastError))
+		default:
+			progressing = append(progressing, cs.Name)
+		}
+	}
+	if err != nil {
+		failed = append(failed, err.Error())
+	}
+
+	ready := operatorsv1alpha1.Condition{
+		Type:               operatorsv1alpha1.ConditionReady,
+		Status:             corev1.ConditionTrue,
+		ObservedGeneration: instance.Generation,
+		Reason:             "AllChannelsReady",
+		Message:            fmt.Sprintf("%d/%d channels ready", status.ReadyChannels, status.TotalChannels),
+	}
+	if status.ReadyChannels != status.TotalChannels || err != nil {
+		ready.Status = corev1.ConditionFalse
+		ready.Reason = "ChannelsNotReady"
+	}
+
+	progress := operatorsv1alpha1.Condition{
+		Type:               operatorsv1alpha1.ConditionProgressing,
+		Status:             corev1.ConditionFalse,
+		ObservedGeneration: instance.Generation,
+		Reason:             "NoPendingChannels",
+	}
+	if len(progressing) > 0 {
+		progress.Status = corev1.ConditionTrue
+		progress.Reason = "ChannelsPending"
+		progress.Message = fmt.Sprintf("Channels not yet installed: %s", strings.Join(progressing, ", "))
+	}
+
+	degraded := operatorsv1alpha1.Condition{
+		Type:               operatorsv1alpha1.ConditionDegraded,
+		Status:             corev1.ConditionFalse,
+		ObservedGeneration: instance.Generation,
+		Reason:             "NoFailures",
+	}
+	if len(failed) > 0 {
+		degraded.Status = corev1.ConditionTrue
+		degraded.Reason = "ReconcileFailed"
+		degraded.Message = strings.Join(failed, "; ")
+	}
+
+	block := operatorsv1alpha1.Condition{
+		Type:               operatorsv1alpha1.ConditionBlocked,
+		Status:             corev1.ConditionFalse,
+		ObservedGeneration: instance.Generation,
+		Reason:             "NoBlockedChannels",
+	}
+	if len(blocked) > 0 {
+		block.Status = corev1.ConditionTrue
+		block.Reason = reason
+		block.Message = strings.Join(blocked, "; ")
+	}
+
+	for _, c := range []operatorsv1alpha1.Condition{ready, progress, degraded, block} {
+		status.Conditions = operatorsv1alpha1.SetCondition(status.Conditions, c)
+	}
+}
+
+// blockedReason returns the reason of the Blocked condition of a NopOperator whose first
+// blocked channel is blocked for reason. Refused major upgrades and downgrades await an
+// approvedVersion, unsatisfiable dependencies a spec change, other reasons, e.g. a
+// BundleMismatch or ConstraintNotSatisfied, are passed through.
+func blockedReason(reason string) string {
+	switch reason {
+	case "MajorUpgrade", "Downgrade":
+		return "ApprovalRequired"
+	case reasonDependencyCycle, reasonUnsatisfiableDependency:
+		return "DependenciesUnsatisfiable"
+	}
+	return reason
+}
+
+// updateStatus writes the status of instance through the status subresource.
+func (r *ReconcileNopOperator) updateStatus(ctx context.Context, instance *operatorsv1alpha1.NopOperator, statuses []operatorsv1alpha1.OperatorChannelStatus, err error) error {
+	setStatus(instance, statuses, err)
+	if err := r.client.Status().Update(ctx, instance); err != nil {
+		return fmt.Errorf("Error updating status: %s", err)
+	}
+	return nil
+}